@@ -0,0 +1,275 @@
+// Package alarm starts a station at set times of day (alarm clock mode).
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"radiko-tui/config"
+)
+
+const (
+	checkInterval = 5 * time.Second // How often the wall clock is checked
+	resumeGap     = 3 * checkInterval
+)
+
+// Ring is an alarm going off
+type Ring struct {
+	Alarm   config.Alarm
+	Due     time.Time // When the alarm was due (the end of the snooze for a snoozed alarm)
+	Snoozed bool      // Rings again after a snooze
+}
+
+// schedule is an alarm with its time of day and days parsed
+type schedule struct {
+	alarm  config.Alarm
+	hour   int
+	minute int
+	days   map[time.Weekday]bool // nil = every day
+}
+
+// Clock rings alarms. It compares the wall clock at short intervals instead of
+// sleeping until the alarm, because Go timers do not advance while the machine is
+// suspended; an alarm that fell due during a suspend rings on resume if it is at
+// most late_minutes late.
+type Clock struct {
+	mu        sync.Mutex
+	schedules []schedule
+	snooze    time.Duration
+	late      time.Duration
+	ring      func(Ring)
+	logf      func(format string, args ...any)
+	lastCheck time.Time
+	ringing   *Ring     // Last alarm rung, for Snooze
+	snoozeAt  time.Time // When the snoozed alarm rings again (zero if none)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	started   bool
+}
+
+// NewClock creates a clock for the alarms of cfg. ring is called from the clock's
+// goroutine and must not block. Alarms that cannot be parsed are skipped and
+// reported in the returned error.
+func NewClock(cfg config.AlarmConfig, ring func(Ring)) (*Clock, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Clock{
+		snooze: time.Duration(cfg.SnoozeMinutes) * time.Minute,
+		late:   time.Duration(cfg.LateMinutes) * time.Minute,
+		ring:   ring,
+		logf:   func(string, ...any) {},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if c.snooze <= 0 {
+		c.snooze = 9 * time.Minute
+	}
+
+	var errs []error
+	for i, a := range cfg.Alarms {
+		s, err := parseAlarm(a)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alarm %d (%s): %w", i+1, a.Time, err))
+			continue
+		}
+		c.schedules = append(c.schedules, s)
+	}
+	return c, errors.Join(errs...)
+}
+
+// SetLogger sets the function used to report alarms (silent by default)
+func (c *Clock) SetLogger(logf func(format string, args ...any)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logf = logf
+}
+
+// Start starts checking the alarms in the background
+func (c *Clock) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	c.lastCheck = wallNow()
+	go c.run()
+}
+
+// Stop stops the clock
+func (c *Clock) Stop() {
+	c.cancel()
+}
+
+// Snooze silences the last alarm rung and rings it again after the snooze length.
+// It returns when, or false if no alarm has rung.
+func (c *Clock) Snooze() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ringing == nil {
+		return time.Time{}, false
+	}
+	c.snoozeAt = wallNow().Add(c.snooze)
+	c.logf("💤 スヌーズ: %s に再開", c.snoozeAt.Format("15:04"))
+	return c.snoozeAt, true
+}
+
+// Dismiss ends the last alarm rung, cancelling its snooze
+func (c *Clock) Dismiss() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ringing = nil
+	c.snoozeAt = time.Time{}
+}
+
+// Snoozed returns when the snoozed alarm rings again, or false if none is snoozed
+func (c *Clock) Snoozed() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snoozeAt, !c.snoozeAt.IsZero()
+}
+
+// Next returns the next alarm and when it rings, or false if there is none
+func (c *Clock) Next() (config.Alarm, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := wallNow()
+	var next time.Time
+	var alarm config.Alarm
+	for _, s := range c.schedules {
+		if s.alarm.Disabled {
+			continue
+		}
+		if at := s.next(now); next.IsZero() || at.Before(next) {
+			next, alarm = at, s.alarm
+		}
+	}
+	return alarm, next, !next.IsZero()
+}
+
+// run checks the alarms until the clock is stopped
+func (c *Clock) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(wallNow())
+		}
+	}
+}
+
+// check rings the alarms that fell due since the last check
+func (c *Clock) check(now time.Time) {
+	c.mu.Lock()
+	last := c.lastCheck
+	c.lastCheck = now
+	if now.Before(last) {
+		// The clock was set back
+		c.mu.Unlock()
+		return
+	}
+	if now.Sub(last) > resumeGap {
+		c.logf("⏰ スリープからの復帰を検出しました (%s 停止)", now.Sub(last).Round(time.Second))
+	}
+
+	var ring *Ring
+	if !c.snoozeAt.IsZero() && !now.Before(c.snoozeAt) {
+		ring = &Ring{Alarm: c.ringing.Alarm, Due: c.snoozeAt, Snoozed: true}
+		c.snoozeAt = time.Time{}
+	}
+	for _, s := range c.schedules {
+		if s.alarm.Disabled {
+			continue
+		}
+		due := s.next(last)
+		if due.After(now) {
+			continue
+		}
+		// The polling delay is always tolerated, a suspend up to late_minutes
+		if now.Sub(due) > c.late+resumeGap {
+			c.logf("⏰ スリープ中のため %s のアラームを鳴らしませんでした [%s]", due.Format("15:04"), s.alarm.StationID)
+			continue
+		}
+		if ring == nil {
+			ring = &Ring{Alarm: s.alarm, Due: due}
+		}
+	}
+	if ring != nil {
+		c.ringing = ring
+		c.logf("⏰ アラーム: %s [%s]", ring.Due.Format("15:04"), ring.Alarm.StationID)
+	}
+	onRing := c.ring
+	c.mu.Unlock()
+
+	if ring != nil && onRing != nil {
+		onRing(*ring)
+	}
+}
+
+// next returns the first time the alarm is due after t
+func (s schedule) next(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), s.hour, s.minute, 0, 0, t.Location())
+	for i := 0; i < 8; i++ {
+		at := day.AddDate(0, 0, i)
+		if at.After(t) && (s.days == nil || s.days[at.Weekday()]) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// weekdays maps the accepted day names to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"日": time.Sunday, "月": time.Monday, "火": time.Tuesday, "水": time.Wednesday,
+	"木": time.Thursday, "金": time.Friday, "土": time.Saturday,
+}
+
+// parseAlarm checks an alarm and parses its time and days
+func parseAlarm(a config.Alarm) (schedule, error) {
+	s := schedule{alarm: a}
+	t, err := time.Parse("15:04", strings.TrimSpace(a.Time))
+	if err != nil {
+		return s, fmt.Errorf("時刻は HH:MM で指定してください")
+	}
+	s.hour, s.minute = t.Hour(), t.Minute()
+
+	if a.StationID == "" {
+		return s, fmt.Errorf("放送局を指定してください")
+	}
+	if a.Volume <= 0 || a.Volume > config.MaxVolume {
+		return s, fmt.Errorf("音量は 0 より大きく %.0f 以下で指定してください", config.MaxVolume)
+	}
+
+	for _, name := range a.Days {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if len(key) > 3 && key[0] < 0x80 {
+			key = key[:3] // "monday" -> "mon"
+		}
+		day, ok := weekdays[key]
+		if !ok {
+			return s, fmt.Errorf("不明な曜日です: %s", name)
+		}
+		if s.days == nil {
+			s.days = make(map[time.Weekday]bool)
+		}
+		s.days[day] = true
+	}
+	return s, nil
+}
+
+// wallNow returns the current time without its monotonic reading, so that
+// differences include time spent suspended
+func wallNow() time.Time {
+	return time.Now().Round(0)
+}
@@ -0,0 +1,86 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"radiko-tui/api"
+	"radiko-tui/config"
+	"radiko-tui/model"
+	"radiko-tui/player"
+)
+
+// rampStep is how often the volume is raised during the ramp-up
+const rampStep = time.Second
+
+// Wake authenticates for the area of the alarm's station, plays its live stream on p
+// from volume 0 and raises the volume to the alarm's volume over its ramp. It returns
+// the area the token was issued for. The ramp stops when ctx is cancelled or the
+// volume is changed by someone else.
+func Wake(ctx context.Context, p player.Player, a config.Alarm) (areaID string, err error) {
+	areaID, err = api.GetStationArea(a.StationID)
+	if err != nil {
+		return "", fmt.Errorf("放送局のエリアを取得できません: %w", err)
+	}
+	authToken := api.Auth(areaID)
+	if authToken == "" {
+		return "", fmt.Errorf("認証に失敗しました")
+	}
+
+	playlistURLs, err := api.GetStreamURLs(a.StationID)
+	if err != nil {
+		return "", fmt.Errorf("ストリームURLを取得できません: %w", err)
+	}
+	if len(playlistURLs) == 0 {
+		return "", fmt.Errorf("利用可能なストリームがありません")
+	}
+	lsid := model.GenLsid()
+	lastURL := playlistURLs[len(playlistURLs)-1]
+	streamURL := fmt.Sprintf("%s?station_id=%s&l=30&lsid=%s&type=b", lastURL, a.StationID, lsid)
+
+	p.Stop()
+	p.UpdateAuthToken(authToken)
+	ramp := time.Duration(a.RampMinutes) * time.Minute
+	if ramp > 0 {
+		p.SetVolume(0)
+	} else {
+		p.SetVolume(a.Volume)
+	}
+	if err := p.Play(streamURL); err != nil {
+		return areaID, err
+	}
+
+	if ramp > 0 {
+		go rampVolume(ctx, p, a.Volume, ramp)
+	}
+	return areaID, nil
+}
+
+// rampVolume raises the volume of p from 0 to target over d
+func rampVolume(ctx context.Context, p player.Player, target float64, d time.Duration) {
+	ticker := time.NewTicker(rampStep)
+	defer ticker.Stop()
+
+	start := time.Now()
+	last := 0.0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if math.Abs(p.GetVolume()-last) > 0.001 || p.IsMuted() {
+			// Changed by the user: leave the volume to them
+			return
+		}
+		progress := float64(time.Since(start)) / float64(d)
+		if progress >= 1 {
+			p.SetVolume(target)
+			return
+		}
+		last = target * progress
+		p.SetVolume(last)
+	}
+}
@@ -42,7 +42,9 @@ func GetStations(areaID string) ([]model.Station, error) {
 	return radikoStations.Stations, nil
 }
 
-func GetStreamURLs(stationID string) ([]string, error) {
+// fetchStreamXML retrieves the stream XML of a station, which lists its live
+// and timefree playlist URLs
+func fetchStreamXML(stationID string) (*model.RadikoURLs, error) {
 	url := fmt.Sprintf(StreamURLFmt, stationID)
 	resp, err := http.Get(url)
 	if err != nil {
@@ -64,6 +66,15 @@ func GetStreamURLs(stationID string) ([]string, error) {
 		return nil, fmt.Errorf("failed to parse stream URL XML: %w", err)
 	}
 
+	return &radikoURLs, nil
+}
+
+func GetStreamURLs(stationID string) ([]string, error) {
+	radikoURLs, err := fetchStreamXML(stationID)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(radikoURLs.URLs) == 0 {
 		return nil, fmt.Errorf("no stream URLs found for station %s", stationID)
 	}
@@ -78,6 +89,64 @@ func GetStreamURLs(stationID string) ([]string, error) {
 	return urls, nil
 }
 
+// TimefreePlaylistURL is the legacy timefree playlist endpoint, used when the
+// stream XML does not list any timefree entry for a station
+const TimefreePlaylistURL = "https://radiko.jp/v2/api/ts/playlist.m3u8"
+
+// GetTimefreeStreamURLs retrieves the timefree playlist URLs for a station.
+// Entries that do not require areafree are listed first.
+func GetTimefreeStreamURLs(stationID string) ([]string, error) {
+	radikoURLs, err := fetchStreamXML(stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls, areafreeURLs []string
+	for _, u := range radikoURLs.URLs {
+		if u.TimeFree != 1 || u.PlaylistCreateURL == "" {
+			continue
+		}
+		if u.AreaFree == 1 {
+			areafreeURLs = append(areafreeURLs, u.PlaylistCreateURL)
+		} else {
+			urls = append(urls, u.PlaylistCreateURL)
+		}
+	}
+
+	return append(urls, areafreeURLs...), nil
+}
+
+// GetTimefreeURL builds the playlist URL of a past broadcast of a station.
+// ft and to are the program's start and end times in YYYYMMDDHHMMSS format.
+// The returned URL has no seek parameter; the player appends one when seeking.
+func GetTimefreeURL(stationID, ft, to string) (string, error) {
+	if _, err := time.ParseInLocation(model.RadikoTimeLayout, ft, jst); err != nil {
+		return "", fmt.Errorf("invalid start time %q: %w", ft, err)
+	}
+	if _, err := time.ParseInLocation(model.RadikoTimeLayout, to, jst); err != nil {
+		return "", fmt.Errorf("invalid end time %q: %w", to, err)
+	}
+	if ft >= to {
+		return "", fmt.Errorf("invalid time range: %s - %s", ft, to)
+	}
+	if now := time.Now().In(jst).Format(model.RadikoTimeLayout); to > now {
+		return "", fmt.Errorf("program has not finished yet: ends at %s", to)
+	}
+
+	playlistURLs, err := GetTimefreeStreamURLs(stationID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(playlistURLs) == 0 {
+		return fmt.Sprintf("%s?station_id=%s&l=15&ft=%s&to=%s", TimefreePlaylistURL, stationID, ft, to), nil
+	}
+
+	lsid := model.GenLsid()
+	return fmt.Sprintf("%s?station_id=%s&start_at=%s&ft=%s&end_at=%s&to=%s&l=15&lsid=%s&type=b",
+		playlistURLs[0], stationID, ft, ft, to, to, lsid), nil
+}
+
 // ProgramURLFmt is the program info API URL format
 const ProgramURLFmt = "https://api.radiko.jp/program/v4/date/%s/station/%s.json"
 
@@ -85,42 +154,34 @@ var jst *time.Location
 
 func init() {
 	// Use Japan timezone (UTC+9)
-	jst = time.FixedZone("JST", 9*60*60)
+	jst = model.JST
 }
 
 // GetCurrentProgram retrieves the current program for a station
 func GetCurrentProgram(stationID string) (*model.Program, error) {
 	now := time.Now().In(jst)
-	dateStr := now.Format("20060102")
-	timeStr := now.Format("20060102150405")
+	timeStr := now.Format(model.RadikoTimeLayout)
 
-	// Try to get program for current date
-	prog, err := getProgramForDate(stationID, dateStr, timeStr)
+	// The date API returns a broadcast day (05:00 - 29:00), so programs
+	// airing after midnight are found in the previous day's data
+	programs, err := getProgramsForDate(stationID, model.BroadcastDate(now))
 	if err != nil {
 		return nil, err
 	}
 
-	// If program found, return it
-	if prog != nil {
-		return prog, nil
-	}
-
-	// If no program found, the API might have returned next day's data
-	// Try fetching previous day's data
-	yesterday := now.AddDate(0, 0, -1)
-	yesterdayStr := yesterday.Format("20060102")
-
-	prog, err = getProgramForDate(stationID, yesterdayStr, timeStr)
-	if err != nil {
-		return nil, err
+	// Find the program that matches current time
+	for _, prog := range programs {
+		if prog.Ft <= timeStr && timeStr < prog.To {
+			return &prog, nil
+		}
 	}
 
-	return prog, nil
+	return nil, nil
 }
 
-// getProgramForDate retrieves program data for a specific date and finds the current program
-func getProgramForDate(stationID, dateStr, timeStr string) (*model.Program, error) {
-	url := fmt.Sprintf(ProgramURLFmt, dateStr, stationID)
+// getProgramsForDate retrieves the raw program list of a station for a broadcast date
+func getProgramsForDate(stationID string, date time.Time) ([]model.Program, error) {
+	url := fmt.Sprintf(ProgramURLFmt, date.In(jst).Format("20060102"), stationID)
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
@@ -141,26 +202,9 @@ func getProgramForDate(stationID, dateStr, timeStr string) (*model.Program, erro
 		return nil, err
 	}
 
-	// Find the program for the current time
 	for _, station := range progResp.Stations {
 		if station.StationID == stationID {
-			// Check if the first program starts after current time
-			// This indicates the current program data is in the previous day's API data
-			if len(station.Programs.Program) > 0 {
-				firstProgram := station.Programs.Program[0]
-				if firstProgram.Ft > timeStr {
-					// First program is in the future, current program data is from previous day
-					return nil, nil
-				}
-			}
-
-			// Find the program that matches current time
-			for _, prog := range station.Programs.Program {
-				// Check if current time is within the program's time range
-				if prog.Ft <= timeStr && timeStr < prog.To {
-					return &prog, nil
-				}
-			}
+			return station.Programs.Program, nil
 		}
 	}
 
@@ -180,35 +224,45 @@ type BatchStationInfo struct {
 	PrefecturesList []string `json:"prefecturesList"`
 }
 
-// GetStationArea retrieves the area ID for a given station
-// Returns the first available prefecture from prefecturesList
-func GetStationArea(stationID string) (string, error) {
+// GetStationInfo retrieves the name and available prefectures of a station
+func GetStationInfo(stationID string) (*BatchStationInfo, error) {
 	url := fmt.Sprintf("https://radiko.jp/api/stations/batchGetStations?stationId=%s", stationID)
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch station info: %w", err)
+		return nil, fmt.Errorf("failed to fetch station info: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch station info: status code %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to fetch station info: status code %d", resp.StatusCode)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var batchResp BatchStationResponse
 	if err := json.Unmarshal(data, &batchResp); err != nil {
-		return "", fmt.Errorf("failed to parse station info JSON: %w", err)
+		return nil, fmt.Errorf("failed to parse station info JSON: %w", err)
 	}
 
 	if !batchResp.OK || len(batchResp.StationList) == 0 {
-		return "", fmt.Errorf("station not found: %s", stationID)
+		return nil, fmt.Errorf("station not found: %s", stationID)
+	}
+
+	return &batchResp.StationList[0], nil
+}
+
+// GetStationArea retrieves the area ID for a given station
+// Returns the first available prefecture from prefecturesList
+func GetStationArea(stationID string) (string, error) {
+	info, err := GetStationInfo(stationID)
+	if err != nil {
+		return "", err
 	}
 
-	prefectures := batchResp.StationList[0].PrefecturesList
+	prefectures := info.PrefecturesList
 	if len(prefectures) == 0 {
 		return "", fmt.Errorf("no available prefectures for station: %s", stationID)
 	}
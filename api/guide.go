@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"radiko-tui/model"
+)
+
+// GuideDays is the number of broadcast days returned by GetWeeklyGuide
+const GuideDays = 7
+
+// GetDailyGuide retrieves all programs of a station for the broadcast day that t belongs to.
+// Times are in JST and the day runs from 05:00 to 05:00 of the next calendar day.
+func GetDailyGuide(stationID string, t time.Time) ([]model.GuideProgram, error) {
+	date := model.BroadcastDate(t)
+	programs, err := getProgramsForDate(stationID, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch program guide for %s (%s): %w", stationID, date.Format("2006-01-02"), err)
+	}
+
+	guide := make([]model.GuideProgram, 0, len(programs))
+	for _, p := range programs {
+		g, err := model.NewGuideProgram(stationID, p)
+		if err != nil {
+			continue
+		}
+		guide = append(guide, g)
+	}
+
+	sort.Slice(guide, func(i, j int) bool {
+		return guide[i].Start.Before(guide[j].Start)
+	})
+	return guide, nil
+}
+
+// GetGuide retrieves the programs of a station for days broadcast days,
+// starting with the broadcast day that from belongs to.
+// Days that fail to load are skipped unless no day could be loaded at all.
+func GetGuide(stationID string, from time.Time, days int) ([]model.GuideProgram, error) {
+	if days <= 0 {
+		days = 1
+	}
+
+	start := model.BroadcastDate(from)
+	var guide []model.GuideProgram
+	var lastErr error
+	loaded := 0
+
+	for i := 0; i < days; i++ {
+		// Use noon to stay clear of the 05:00 day boundary
+		day := start.AddDate(0, 0, i).Add(12 * time.Hour)
+		programs, err := GetDailyGuide(stationID, day)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		loaded++
+
+		for _, p := range programs {
+			// Programs crossing the day boundary can appear in both days
+			if n := len(guide); n > 0 && !p.Start.After(guide[n-1].Start) {
+				continue
+			}
+			guide = append(guide, p)
+		}
+	}
+
+	if loaded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return guide, nil
+}
+
+// GetWeeklyGuide retrieves the programs of a station from today's broadcast day for a week
+func GetWeeklyGuide(stationID string) ([]model.GuideProgram, error) {
+	return GetGuide(stationID, time.Now().In(jst), GuideDays)
+}
+
+// GetProgramAt retrieves the program of a station on air at t
+func GetProgramAt(stationID string, t time.Time) (*model.GuideProgram, error) {
+	guide, err := GetDailyGuide(stationID, t)
+	if err != nil {
+		return nil, err
+	}
+	return model.FindProgramAt(guide, t), nil
+}
+
+// FindProgram searches the guide of a station, from yesterday to a week ahead, for a program ID
+func FindProgram(stationID, programID string) (*model.GuideProgram, error) {
+	guide, err := GetGuide(stationID, time.Now().In(jst).AddDate(0, 0, -1), GuideDays+1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range guide {
+		if guide[i].ID == programID {
+			return &guide[i], nil
+		}
+	}
+	return nil, fmt.Errorf("program %s not found for station %s", programID, stationID)
+}
@@ -4,13 +4,95 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 // Config represents application configuration
 type Config struct {
-	LastStationID string  `json:"last_station_id"` // Last played station ID
-	Volume        float64 `json:"volume"`          // Volume 0.0-1.0
-	AreaID        string  `json:"area_id"`         // Current area ID
+	LastStationID    string          `json:"last_station_id"`   // Last played station ID
+	Volume           float64         `json:"volume"`            // Volume 0.0-2.0 on the perceptual scale (see VolumeGain)
+	VolumeCurve      string          `json:"volume_curve"`      // Scale of the volumes, empty in files saved with the old linear scale
+	AreaID           string          `json:"area_id"`           // Current area ID
+	Recording        RecordingConfig `json:"recording"`         // Recording options
+	TimeshiftMinutes int             `json:"timeshift_minutes"` // Length of the live time-shift buffer (0 = disabled)
+	Reconnect        ReconnectConfig `json:"reconnect"`         // Retries after playback failed
+	Sleep            SleepConfig     `json:"sleep"`             // Sleep timer settings
+	Alarm            AlarmConfig     `json:"alarm"`             // Alarm clock
+	Audio            AudioConfig     `json:"audio"`             // Processing of the played audio
+	Silence          SilenceConfig   `json:"silence"`           // Detection of dead air
+	Server           ServerConfig    `json:"server"`            // Streaming server (-server)
+}
+
+// AudioConfig represents the processing of the played audio
+type AudioConfig struct {
+	Normalize  bool              `json:"normalize"`            // Even out the loudness of stations
+	TargetLUFS float64           `json:"target_lufs"`          // Loudness the normalization aims at
+	EQ         string            `json:"eq"`                   // EQ preset: flat, speech, music
+	StationEQ  map[string]string `json:"station_eq,omitempty"` // EQ preset per station ID
+	Mono       bool              `json:"mono"`                 // Downmix to mono
+	Balance    float64           `json:"balance"`              // -1.0 (left) to 1.0 (right)
+	Limiter    bool              `json:"limiter"`              // Keep peaks from clipping
+	Meter      string            `json:"meter"`                // Level display: off, vu, spectrum (VU meter and spectrum)
+}
+
+// SilenceConfig represents how dead air (silence or looping audio) is detected and handled
+type SilenceConfig struct {
+	ThresholdDB   float64 `json:"threshold_db"`   // Audio quieter than this (dBFS) is silence
+	NotifySec     int     `json:"notify_sec"`     // Report dead air after this long
+	ReconnectSec  int     `json:"reconnect_sec"`  // Reconnect once after this long (0 = never)
+	MarkRecording bool    `json:"mark_recording"` // Note dead air in the tags of the recording
+}
+
+// ServerConfig represents how the streaming server feeds its clients
+type ServerConfig struct {
+	ClientQueue int    `json:"client_queue"` // Chunks (8KB at most) queued per client
+	SlowClient  string `json:"slow_client"`  // A client that cannot keep up: drop (oldest data) or disconnect
+	MaxLagSec   int    `json:"max_lag_sec"`  // Lag at which a slow client is disconnected (disconnect only)
+	BurstSec    int    `json:"burst_sec"`    // Recent audio sent to a new client at once, so that it starts quickly (0 = none)
+}
+
+// AlarmConfig represents the alarm clock
+type AlarmConfig struct {
+	Alarms        []Alarm `json:"alarms"`
+	SnoozeMinutes int     `json:"snooze_minutes"` // Length of a snooze
+	LateMinutes   int     `json:"late_minutes"`   // An alarm missed while the machine was suspended still rings this late
+}
+
+// Alarm starts a station at a time of day
+type Alarm struct {
+	Time        string   `json:"time"`                   // Time of day in local time, "HH:MM"
+	Days        []string `json:"days,omitempty"`         // Days of week ("mon", "tue", ...), empty = every day
+	StationID   string   `json:"station_id"`             // e.g. "TBS"
+	Volume      float64  `json:"volume"`                 // Volume reached after the ramp-up (0.0-2.0)
+	RampMinutes int      `json:"ramp_minutes,omitempty"` // Minutes to raise the volume from 0 to Volume (0 = at once)
+	Disabled    bool     `json:"disabled,omitempty"`
+}
+
+// SleepConfig represents the choices of the sleep timer
+type SleepConfig struct {
+	Minutes       []int `json:"minutes"`        // Durations offered by the timer key, before "end of program"
+	StopRecording bool  `json:"stop_recording"` // Stop an active recording along with playback by default
+}
+
+// ReconnectConfig represents how playback is retried after the stream failed
+type ReconnectConfig struct {
+	InitialDelaySec float64 `json:"initial_delay_sec"` // Wait before the first attempt
+	MaxDelaySec     float64 `json:"max_delay_sec"`     // Upper bound of the wait, which doubles per attempt
+	Jitter          float64 `json:"jitter"`            // Random variation of the wait (0-1)
+	MaxAttempts     int     `json:"max_attempts"`      // Attempts before giving up (0 = unlimited)
+	CooldownSec     int     `json:"cooldown_sec"`      // Wait after giving up before starting over (0 = stay stopped)
+}
+
+// RecordingConfig represents how recordings are named, split and encoded
+type RecordingConfig struct {
+	SplitByProgram bool   `json:"split_by_program"`  // Name files after the program and split at program boundaries
+	MaxMinutes     int    `json:"max_minutes"`       // Split after N minutes (0 = no limit)
+	MaxSizeMB      int    `json:"max_size_mb"`       // Split after N MB (0 = no limit)
+	Format         string `json:"format"`            // Output format: aac, m4a, mp3, opus, flac
+	Copy           bool   `json:"copy"`              // Keep the original AAC stream without re-encoding (aac/m4a)
+	Bitrate        string `json:"bitrate,omitempty"` // Bitrate of lossy re-encoding (e.g. "128k")
+	RetroMinutes   int    `json:"retro_minutes"`     // Minutes saved by retroactive recording
+	RetroContinue  bool   `json:"retro_continue"`    // Keep recording after the retroactive minutes instead of saving a clip
 }
 
 // DefaultConfig returns the default configuration
@@ -19,11 +101,51 @@ func DefaultConfig() Config {
 		LastStationID: "QRR",  // Default station
 		Volume:        0.8,    // Default volume 80%
 		AreaID:        "JP13", // Default area: Tokyo
+		Recording: RecordingConfig{
+			SplitByProgram: false, // One file per recording, as before
+			Format:         "aac", // Raw AAC, as before
+			RetroMinutes:   5,     // Save the last 5 minutes
+		},
+		TimeshiftMinutes: 30, // Rewind live radio up to 30 minutes
+		Reconnect: ReconnectConfig{
+			InitialDelaySec: 0.5, // First retry almost immediately, as before
+			MaxDelaySec:     60,
+			Jitter:          0.2,
+			MaxAttempts:     8,
+			CooldownSec:     300, // Try again every 5 minutes after giving up
+		},
+		Sleep: SleepConfig{
+			Minutes: []int{15, 30, 60, 90},
+		},
+		Alarm: AlarmConfig{
+			SnoozeMinutes: 9,
+			LateMinutes:   30,
+		},
+		Audio: AudioConfig{
+			Normalize:  true,
+			TargetLUFS: -18,
+			EQ:         "flat",
+			Limiter:    true,
+			Meter:      "vu",
+		},
+		Silence: SilenceConfig{
+			ThresholdDB:   -60,
+			NotifySec:     15,
+			ReconnectSec:  60,
+			MarkRecording: true,
+		},
+		Server: ServerConfig{
+			ClientQueue: 256,
+			SlowClient:  "drop",
+			MaxLagSec:   15,
+			BurstSec:    5,
+		},
+		VolumeCurve: VolumeCurveDB,
 	}
 }
 
-// getConfigPath returns the configuration file path
-func getConfigPath() (string, error) {
+// Dir returns the application config directory, creating it if needed
+func Dir() (string, error) {
 	// Get user config directory
 	configDir, err := os.UserConfigDir()
 	if err != nil {
@@ -37,9 +159,25 @@ func getConfigPath() (string, error) {
 		return "", err
 	}
 
+	return appConfigDir, nil
+}
+
+// getConfigPath returns the configuration file path
+func getConfigPath() (string, error) {
+	appConfigDir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
 	return filepath.Join(appConfigDir, "config.json"), nil
 }
 
+// DownloadsDir returns the directory recordings are saved to (the user's Downloads directory)
+func DownloadsDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "Downloads")
+}
+
 // Load loads the configuration
 func Load() (Config, error) {
 	configPath, err := getConfigPath()
@@ -56,18 +194,25 @@ func Load() (Config, error) {
 		return DefaultConfig(), err
 	}
 
-	var cfg Config
+	// Start from defaults so that fields missing in older config files keep their default
+	cfg := DefaultConfig()
+	cfg.VolumeCurve = ""
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return DefaultConfig(), err
 	}
 
-	// Validate volume range
-	if cfg.Volume < 0 {
-		cfg.Volume = 0
-	} else if cfg.Volume > 1 {
-		cfg.Volume = 1
+	// Volumes were linear gains before the perceptual scale: keep their loudness
+	if cfg.VolumeCurve == "" {
+		cfg.Volume = VolumePosition(cfg.Volume)
+		for i := range cfg.Alarm.Alarms {
+			cfg.Alarm.Alarms[i].Volume = VolumePosition(cfg.Alarm.Alarms[i].Volume)
+		}
+		cfg.VolumeCurve = VolumeCurveDB
 	}
 
+	// Validate volume range
+	cfg.Volume = ClampVolume(cfg.Volume)
+
 	// Validate area ID, use default if empty
 	if cfg.AreaID == "" {
 		cfg.AreaID = "JP13"
@@ -76,8 +221,20 @@ func Load() (Config, error) {
 	return cfg, nil
 }
 
+// saveMu serializes the writes of the config file, so that partial saves running
+// at the same time do not undo each other
+var saveMu sync.Mutex
+
 // Save saves the configuration
 func Save(cfg Config) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	return save(cfg)
+}
+
+// save writes the configuration atomically, so that a concurrent Load never reads
+// a partly written file. saveMu must be held.
+func save(cfg Config) error {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return err
@@ -88,22 +245,47 @@ func Save(cfg Config) error {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, configPath)
 }
 
-// SaveConfig saves the configuration (station, volume, area)
-func SaveConfig(stationID string, volume float64, areaID string) error {
-	cfg := Config{
-		LastStationID: stationID,
-		Volume:        volume,
-		AreaID:        areaID,
+// update loads the configuration, applies change and saves it. If the file cannot
+// be loaded nothing is saved, so that the other settings are never replaced by defaults.
+func update(change func(cfg *Config)) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	cfg, err := Load()
+	if err != nil {
+		return err
 	}
-	return Save(cfg)
+	change(&cfg)
+	return save(cfg)
+}
+
+// SaveConfig saves the configuration (station, volume, area), keeping the other settings
+func SaveConfig(stationID string, volume float64, areaID string) error {
+	return update(func(cfg *Config) {
+		cfg.LastStationID = stationID
+		cfg.Volume = volume
+		cfg.AreaID = areaID
+	})
+}
+
+// SaveAudio saves the audio processing settings, keeping the other settings
+func SaveAudio(audio AudioConfig) error {
+	return update(func(cfg *Config) {
+		cfg.Audio = audio
+	})
 }
 
-// SaveLastStation saves the last played station (backwards compatible)
+// SaveLastStation saves the last played station (backwards compatible), keeping the area
 func SaveLastStation(stationID string, volume float64) error {
-	// Load existing config first to preserve AreaID
-	existing, _ := Load()
-	return SaveConfig(stationID, volume, existing.AreaID)
+	return update(func(cfg *Config) {
+		cfg.LastStationID = stationID
+		cfg.Volume = volume
+	})
 }
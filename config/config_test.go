@@ -0,0 +1,136 @@
+package config
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// useTempConfigDir points the config directory at a temporary directory
+func useTempConfigDir(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	dir, err := Dir()
+	if err != nil {
+		t.Fatalf("Dir: %v", err)
+	}
+	return dir
+}
+
+func TestLoadMigratesLinearVolume(t *testing.T) {
+	dir := useTempConfigDir(t)
+	// Saved before the perceptual scale: no volume_curve
+	old := `{
+		"last_station_id": "TBS",
+		"volume": 0.5,
+		"area_id": "JP13",
+		"alarm": {"alarms": [{"time": "07:00", "station_id": "TBS", "volume": 1.0}, {"time": "08:00", "station_id": "QRR", "volume": 0.25}]}
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.VolumeCurve != VolumeCurveDB {
+		t.Errorf("VolumeCurve = %q, want %q", cfg.VolumeCurve, VolumeCurveDB)
+	}
+	if math.Abs(cfg.Volume-0.849) > 0.001 {
+		t.Errorf("Volume = %.4f, want ~0.849", cfg.Volume)
+	}
+	if math.Abs(VolumeGain(cfg.Volume)-0.5) > 1e-9 {
+		t.Errorf("migrated volume has gain %v, want 0.5", VolumeGain(cfg.Volume))
+	}
+	if got := cfg.Alarm.Alarms[0].Volume; got != 1 {
+		t.Errorf("alarm volume 1.0 migrated to %v", got)
+	}
+	if got := VolumeGain(cfg.Alarm.Alarms[1].Volume); math.Abs(got-0.25) > 1e-9 {
+		t.Errorf("alarm volume 0.25 migrated to gain %v", got)
+	}
+
+	// Saved again, the file is on the new scale and is not converted twice
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	again, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if again.Volume != cfg.Volume || again.Alarm.Alarms[1].Volume != cfg.Alarm.Alarms[1].Volume {
+		t.Errorf("reloaded volumes %v, %v, want %v, %v", again.Volume, again.Alarm.Alarms[1].Volume, cfg.Volume, cfg.Alarm.Alarms[1].Volume)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	useTempConfigDir(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.VolumeCurve != VolumeCurveDB || cfg.Volume != DefaultConfig().Volume {
+		t.Errorf("Load without a file = volume %v (%q), want the defaults", cfg.Volume, cfg.VolumeCurve)
+	}
+}
+
+func TestConcurrentSavesKeepSettings(t *testing.T) {
+	useTempConfigDir(t)
+	cfg := DefaultConfig()
+	cfg.Alarm.Alarms = []Alarm{{Time: "07:00", StationID: "TBS", Volume: 1}}
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// As the TUI saves on every volume key and audio setting change
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := SaveConfig("QRR", float64(i)/50, "JP13"); err != nil {
+				t.Errorf("SaveConfig: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			audio := DefaultConfig().Audio
+			audio.Mono = true
+			if err := SaveAudio(audio); err != nil {
+				t.Errorf("SaveAudio: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got.Alarm.Alarms) != 1 || got.Alarm.Alarms[0].StationID != "TBS" {
+		t.Errorf("alarms = %+v, want the one saved before", got.Alarm.Alarms)
+	}
+	if got.LastStationID != "QRR" || !got.Audio.Mono {
+		t.Errorf("station %q, mono %v: a save was lost", got.LastStationID, got.Audio.Mono)
+	}
+}
+
+func TestSaveConfigKeepsUnreadableFile(t *testing.T) {
+	dir := useTempConfigDir(t)
+	path := filepath.Join(dir, "config.json")
+	broken := []byte(`{"last_station_id": "TBS", "alarm": {`)
+	if err := os.WriteFile(path, broken, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveConfig("QRR", 1, "JP13"); err == nil {
+		t.Error("SaveConfig saved over a config it could not load")
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(broken) {
+		t.Error("the unreadable config was replaced")
+	}
+}
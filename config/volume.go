@@ -0,0 +1,52 @@
+package config
+
+import "math"
+
+// The volume is a position on a perceptual scale: 0 is silent, 1 (100%) plays the
+// stream as is and MaxVolume boosts quiet stations. Steps are even in dB, so 1%
+// sounds about the same at the top and the bottom of the range.
+const (
+	MaxVolume = 2.0 // 200%
+
+	VolumeCurveDB = "db" // Value of Config.VolumeCurve for the perceptual scale
+
+	volumeRangeDB = 40.0 // Attenuation at 0%, 0.4 dB per 1%
+	volumeBoostDB = 12.0 // Gain at MaxVolume
+	volumeFadeEnd = 0.1  // Below 10% the gain falls linearly to silence
+)
+
+// VolumeGain returns the linear gain of a volume position
+func VolumeGain(volume float64) float64 {
+	volume = ClampVolume(volume)
+	if volume == 0 {
+		return 0
+	}
+	if volume > 1 {
+		return math.Pow(10, volumeBoostDB*(volume-1)/(MaxVolume-1)/20)
+	}
+	gain := math.Pow(10, volumeRangeDB*(volume-1)/20)
+	if volume < volumeFadeEnd {
+		// The dB curve never reaches silence: fade out the last steps
+		gain *= volume / volumeFadeEnd
+	}
+	return gain
+}
+
+// VolumePosition returns the volume position whose gain is the given linear gain.
+// It converts volumes saved on the old linear scale.
+func VolumePosition(gain float64) float64 {
+	if gain <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(gain)
+	if db > 0 {
+		return ClampVolume(1 + db/volumeBoostDB*(MaxVolume-1))
+	}
+	// The fade below 10% is not inverted: very low gains end up at 1%, still audible
+	return ClampVolume(math.Max(1+db/volumeRangeDB, 0.01))
+}
+
+// ClampVolume limits a volume position to 0-MaxVolume
+func ClampVolume(volume float64) float64 {
+	return math.Max(0, math.Min(MaxVolume, volume))
+}
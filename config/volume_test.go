@@ -0,0 +1,57 @@
+package config
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVolumeGain(t *testing.T) {
+	tests := []struct {
+		volume float64
+		gain   float64
+	}{
+		{0, 0},
+		{-1, 0},
+		{0.05, math.Pow(10, -38.0/20) * 0.5}, // Fading out below 10%
+		{0.5, math.Pow(10, -20.0/20)},
+		{1, 1},
+		{1.5, math.Pow(10, 6.0/20)},
+		{MaxVolume, math.Pow(10, volumeBoostDB/20)},
+		{3, math.Pow(10, volumeBoostDB/20)},
+	}
+	for _, tt := range tests {
+		if got := VolumeGain(tt.volume); math.Abs(got-tt.gain) > 1e-9 {
+			t.Errorf("VolumeGain(%v) = %v, want %v", tt.volume, got, tt.gain)
+		}
+	}
+}
+
+func TestVolumePositionRoundTrip(t *testing.T) {
+	// Positions from 10% up map back exactly; the fade below is not inverted
+	for pos := 0.10; pos <= MaxVolume+1e-9; pos += 0.01 {
+		if got := VolumePosition(VolumeGain(pos)); math.Abs(got-pos) > 1e-9 {
+			t.Errorf("VolumePosition(VolumeGain(%.2f)) = %v", pos, got)
+		}
+	}
+
+	tests := []struct {
+		name string
+		gain float64
+		want float64
+	}{
+		{"silent", 0, 0},
+		{"negative", -0.5, 0},
+		{"unchanged", 1, 1},
+		{"max boost", VolumeGain(MaxVolume), MaxVolume},
+		{"beyond max boost", 100, MaxVolume},
+		{"very low gain stays audible", 1e-6, 0.01},
+		{"old linear 50%", 0.5, 1 + 20*math.Log10(0.5)/volumeRangeDB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VolumePosition(tt.gain); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("VolumePosition(%v) = %v, want %v", tt.gain, got, tt.want)
+			}
+		})
+	}
+}
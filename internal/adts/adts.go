@@ -0,0 +1,91 @@
+// Package adts splits an ADTS AAC stream, as ffmpeg writes it with -f adts, into
+// whole frames. The player's time-shift buffer and recordings and the server's
+// burst all work on frames, so that audio is never cut inside one.
+package adts
+
+import "time"
+
+// sampleRates are the sampling frequencies indexed by the header field
+var sampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// headerSize is the size of a header without CRC
+const headerSize = 7
+
+// Frame is one ADTS frame
+type Frame struct {
+	Data     []byte
+	Duration time.Duration
+}
+
+// Splitter splits a stream received in chunks of any size into frames. Bytes before
+// a sync word, and sync words that do not start a valid header, are skipped. After
+// skipping, a header only counts once the next frame follows it, since the audio
+// data may contain sync words.
+type Splitter struct {
+	pending []byte // Incomplete frame
+	synced  bool   // The pending data starts where the last frame ended
+}
+
+// Split returns the frames completed by data, joined in one new buffer which the
+// frames' Data point into
+func (s *Splitter) Split(data []byte) ([]byte, []Frame) {
+	buf := append(s.pending, data...)
+	out := make([]byte, 0, len(buf))
+	var frames []Frame
+	for {
+		// Resynchronize on the sync word
+		i := 0
+		for i+1 < len(buf) && !isSync(buf[i:]) {
+			i++
+		}
+		if i > 0 {
+			s.synced = false
+		}
+		buf = buf[i:]
+		if len(buf) < headerSize {
+			break
+		}
+
+		length, duration, ok := parseHeader(buf)
+		if ok && !s.synced && len(buf) >= length+2 && !isSync(buf[length:]) {
+			ok = false
+		}
+		if !ok {
+			// Not a frame header, skip the false sync word
+			s.synced = false
+			buf = buf[1:]
+			continue
+		}
+		if len(buf) < length {
+			break
+		}
+
+		out = append(out, buf[:length]...)
+		frames = append(frames, Frame{Data: out[len(out)-length:], Duration: duration})
+		buf = buf[length:]
+		s.synced = true
+	}
+	s.pending = append(s.pending[:0], buf...)
+	return out, frames
+}
+
+// Pending returns the start of the incomplete frame received last
+func (s *Splitter) Pending() []byte {
+	return s.pending
+}
+
+// isSync reports whether b starts with the 12-bit sync word and layer 0
+func isSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xF6 == 0xF0
+}
+
+// parseHeader returns the frame length and audio duration of the header at the start of b
+func parseHeader(b []byte) (length int, duration time.Duration, ok bool) {
+	length = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+	rateIndex := int(b[2]>>2) & 0x0F
+	if length < headerSize || rateIndex >= len(sampleRates) {
+		return 0, 0, false
+	}
+	blocks := int(b[6]&0x03) + 1
+	return length, time.Duration(blocks*1024) * time.Second / time.Duration(sampleRates[rateIndex]), true
+}
@@ -0,0 +1,145 @@
+package adts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"radiko-tui/internal/adts/adtstest"
+)
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// splitAll feeds chunks to a splitter and returns the frames
+func splitAll(chunks ...[]byte) ([]byte, []Frame, *Splitter) {
+	var s Splitter
+	var out []byte
+	var frames []Frame
+	for _, chunk := range chunks {
+		joined, f := s.Split(chunk)
+		out = append(out, joined...)
+		frames = append(frames, f...)
+	}
+	return out, frames, &s
+}
+
+func TestSplitWholeFrames(t *testing.T) {
+	a, b, c := adtstest.Frame(100, 0x11), adtstest.Frame(120, 0x22), adtstest.Frame(90, 0x33)
+	out, frames, s := splitAll(concat(a, b, c))
+
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	for i, want := range [][]byte{a, b, c} {
+		if !bytes.Equal(frames[i].Data, want) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+	if !bytes.Equal(out, concat(a, b, c)) {
+		t.Error("joined output differs from the frames")
+	}
+	if len(s.Pending()) != 0 {
+		t.Errorf("%d bytes pending, want 0", len(s.Pending()))
+	}
+}
+
+func TestSplitAcrossChunks(t *testing.T) {
+	a, b := adtstest.Frame(100, 0x11), adtstest.Frame(120, 0x22)
+	stream := concat(a, b)
+
+	// Every cut, including inside a header
+	for cut := 1; cut < len(stream); cut++ {
+		var s Splitter
+		_, first := s.Split(stream[:cut])
+		_, second := s.Split(stream[cut:])
+		frames := append(first, second...)
+		if len(frames) != 2 || !bytes.Equal(frames[0].Data, a) || !bytes.Equal(frames[1].Data, b) {
+			t.Fatalf("cut at %d: got %d frames", cut, len(frames))
+		}
+		if cut < len(a) && len(first) != 0 {
+			t.Fatalf("cut at %d: frame returned before it was complete", cut)
+		}
+	}
+
+	// Byte by byte
+	chunks := make([][]byte, len(stream))
+	for i := range stream {
+		chunks[i] = stream[i : i+1]
+	}
+	if _, frames, _ := splitAll(chunks...); len(frames) != 2 {
+		t.Errorf("byte by byte: got %d frames, want 2", len(frames))
+	}
+}
+
+func TestSplitKeepsIncompleteFrame(t *testing.T) {
+	a, b := adtstest.Frame(100, 0x11), adtstest.Frame(120, 0x22)
+	_, frames, s := splitAll(concat(a, b[:50]))
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(frames))
+	}
+	if !bytes.Equal(s.Pending(), b[:50]) {
+		t.Error("pending bytes are not the start of the incomplete frame")
+	}
+}
+
+func TestSplitResyncsAfterJunk(t *testing.T) {
+	a, b, c := adtstest.Frame(100, 0x11), adtstest.Frame(120, 0x22), adtstest.Frame(90, 0x33)
+	junk := []byte{0x00, 0x12, 0xFF, 0x00, 0xFF, 0x34, 0x56}
+
+	_, frames, _ := splitAll(concat(junk, a, b, junk, c))
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want the 3 frames around the junk", len(frames))
+	}
+	for i, want := range [][]byte{a, b, c} {
+		if !bytes.Equal(frames[i].Data, want) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+func TestSplitSkipsFalseSync(t *testing.T) {
+	a := adtstest.Frame(100, 0x11)
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"length below the header", []byte{0xFF, 0xF1, 0x4C, 0x80, 0x00, 0x1F, 0xFC}},
+		{"reserved sample rate", []byte{0xFF, 0xF1, 0x7C, 0x80, 0x0C, 0x9F, 0xFC}},
+		{"layer not 0", []byte{0xFF, 0xF3, 0x4C, 0x80, 0x0C, 0x9F, 0xFC}},
+		// A plausible header of 100 bytes not followed by a frame
+		{"not followed by a frame", concat(adtstest.Frame(100, 0x00)[:7], bytes.Repeat([]byte{0x55}, 100))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, frames, _ := splitAll(concat(tt.header, a, a))
+			if len(frames) != 2 || !bytes.Equal(frames[0].Data, a) || !bytes.Equal(frames[1].Data, a) {
+				t.Fatalf("got %d frames, want the 2 real frames", len(frames))
+			}
+		})
+	}
+}
+
+func TestFrameDuration(t *testing.T) {
+	tests := []struct {
+		rateIndex, blocks int
+		want              time.Duration
+	}{
+		{3, 1, 1024 * time.Second / 48000}, // 21.33ms
+		{4, 1, 1024 * time.Second / 44100},
+		{6, 1, 1024 * time.Second / 24000},
+		{3, 2, 2048 * time.Second / 48000},
+		{8, 4, 4096 * time.Second / 16000},
+		{12, 1, 1024 * time.Second / 7350},
+	}
+	for _, tt := range tests {
+		_, frames, _ := splitAll(adtstest.FrameWith(64, tt.rateIndex, tt.blocks, 0))
+		if len(frames) != 1 {
+			t.Fatalf("rate %d, %d blocks: got %d frames", tt.rateIndex, tt.blocks, len(frames))
+		}
+		if frames[0].Duration != tt.want {
+			t.Errorf("rate %d, %d blocks: duration %v, want %v", tt.rateIndex, tt.blocks, frames[0].Duration, tt.want)
+		}
+	}
+}
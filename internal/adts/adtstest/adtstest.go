@@ -0,0 +1,30 @@
+// Package adtstest builds ADTS frames for the tests of the packages that split them
+package adtstest
+
+import (
+	"bytes"
+	"time"
+)
+
+// FrameDuration is the duration of a frame built by Frame: one block of 1024 samples at 48kHz
+const FrameDuration = 1024 * time.Second / 48000
+
+// Frame builds a 48kHz ADTS frame of one block of length bytes (header included),
+// filled with fill
+func Frame(length int, fill byte) []byte {
+	return FrameWith(length, 3, 1, fill)
+}
+
+// FrameWith builds an ADTS frame of length bytes (header included) at sample rate
+// index rateIndex with blocks raw data blocks, filled with fill
+func FrameWith(length, rateIndex, blocks int, fill byte) []byte {
+	f := bytes.Repeat([]byte{fill}, length)
+	f[0] = 0xFF
+	f[1] = 0xF1 // MPEG-4, layer 0, no CRC
+	f[2] = 0x40 | byte(rateIndex)<<2
+	f[3] = 0x80 | byte(length>>11)&0x03 // Stereo
+	f[4] = byte(length >> 3)
+	f[5] = byte(length&0x07)<<5 | 0x1F
+	f[6] = 0xFC | byte(blocks-1)
+	return f
+}
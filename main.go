@@ -1,24 +1,47 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"radiko-tui/alarm"
 	"radiko-tui/api"
 	"radiko-tui/config"
+	"radiko-tui/player"
+	"radiko-tui/recorder"
 	"radiko-tui/server"
 	"radiko-tui/tui"
 )
 
 func main() {
 	// Parse command line arguments
-	volumePercent := flag.Int("volume", -1, "Initial volume (0-100), -1 means use saved config")
+	volumePercent := flag.Int("volume", -1, "Initial volume (0-200, 100 = unchanged), -1 means use saved config")
 	serverMode := flag.Bool("server", false, "Run in server mode (HTTP streaming)")
 	port := flag.Int("port", 8080, "Server port (server mode only)")
 	graceSeconds := flag.Int("grace", 10, "Seconds to keep ffmpeg alive after last client disconnects (server mode only)")
+	previewRules := flag.Bool("preview-rules", false, "List upcoming programs matching the auto-recording rules and exit")
+	daemonMode := flag.Bool("daemon", false, "Run headless: recording reservations and alarms without the TUI")
 	flag.Parse()
 
+	// Rule preview
+	if *previewRules {
+		runPreviewRules()
+		return
+	}
+
+	// Headless mode
+	if *daemonMode {
+		runDaemon()
+		return
+	}
+
 	// Server mode
 	if *serverMode {
 		runServer(*port, *graceSeconds)
@@ -32,13 +55,142 @@ func main() {
 // runServer starts the HTTP streaming server
 func runServer(port int, graceSeconds int) {
 	fmt.Println("🚀 サーバーモードで起動中...")
-	s := server.NewServer(port, graceSeconds)
-	if err := s.Start(); err != nil {
+
+	// Start the recording scheduler
+	scheduler, err := recorder.NewScheduler()
+	reportSchedulerError(err)
+	scheduler.SetLogger(log.Printf)
+	cfg, _ := config.Load()
+	scheduler.SetOutputOptions(recorder.OutputOptionsFromConfig(cfg.Recording))
+	scheduler.Start()
+
+	s := server.NewServer(port, graceSeconds, scheduler)
+	s.SetClientPolicy(server.ClientPolicyFromConfig(cfg.Server))
+	err = s.Start()
+	// Stopped before os.Exit, which skips deferred calls
+	scheduler.Stop()
+	if err != nil {
 		fmt.Printf("❌ サーバーエラー: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// runDaemon runs the recording scheduler and the alarm clock without the TUI until interrupted
+func runDaemon() {
+	fmt.Println("🚀 デーモンモードで起動中...")
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("⚠ 設定の読み込みに失敗しました。デフォルト設定を使用します: %v\n", err)
+		cfg = config.DefaultConfig()
+	}
+
+	// Start the recording scheduler
+	scheduler, err := recorder.NewScheduler()
+	reportSchedulerError(err)
+	scheduler.SetLogger(log.Printf)
+	scheduler.SetOutputOptions(recorder.OutputOptionsFromConfig(cfg.Recording))
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// Alarms play through a local player, authenticated for the alarm station's area
+	p := player.NewFFmpegPlayer("", cfg.Volume)
+	p.SetReconnectPolicy(player.ReconnectPolicyFromConfig(cfg.Reconnect))
+	p.SetSilencePolicy(player.SilencePolicyFromConfig(cfg.Silence))
+	var mu sync.Mutex
+	var areaID string
+	var stopRamp context.CancelFunc
+	p.SetReconnectCallback(func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return api.Auth(areaID)
+	})
+
+	clock, err := alarm.NewClock(cfg.Alarm, func(ring alarm.Ring) {
+		go func() {
+			mu.Lock()
+			if stopRamp != nil {
+				stopRamp()
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			stopRamp = cancel
+			mu.Unlock()
+
+			area, err := alarm.Wake(ctx, p, ring.Alarm)
+			if err != nil {
+				log.Printf("❌ アラーム再生失敗 [%s]: %v", ring.Alarm.StationID, err)
+				return
+			}
+			mu.Lock()
+			areaID = area
+			mu.Unlock()
+			log.Printf("▶ アラーム再生中: %s", ring.Alarm.StationID)
+		}()
+	})
+	if err != nil {
+		fmt.Printf("⚠ アラーム設定エラー: %v\n", err)
+	}
+	clock.SetLogger(log.Printf)
+	clock.Start()
+	defer clock.Stop()
+	if a, at, ok := clock.Next(); ok {
+		fmt.Printf("⏰ 次のアラーム: %s [%s]\n", at.Format("01/02 15:04"), a.StationID)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	fmt.Println("👋 終了します")
+	p.Stop()
+}
+
+// reportSchedulerError warns that the reservations could not be loaded, or that another
+// process runs them and this one only shows them
+func reportSchedulerError(err error) {
+	switch {
+	case errors.Is(err, recorder.ErrLocked):
+		fmt.Println("⚠ 別のプロセスが録音予約を実行中です。終了するまで予約とルールは変更できません")
+	case err != nil:
+		fmt.Printf("⚠ 録音予約の読み込みに失敗しました: %v\n", err)
+	}
+}
+
+// runPreviewRules prints the upcoming programs matching the auto-recording rules
+func runPreviewRules() {
+	// Previewing only reads the rules, also while another process runs them
+	scheduler, err := recorder.NewScheduler()
+	if err != nil && !errors.Is(err, recorder.ErrLocked) {
+		fmt.Printf("❌ 自動録音ルールの読み込みに失敗しました: %v\n", err)
+		os.Exit(1)
+	}
+
+	rules := scheduler.Rules()
+	if len(rules) == 0 {
+		fmt.Println("自動録音ルールがありません")
+		return
+	}
+	fmt.Printf("📋 %d 件のルールを評価中...\n", len(rules))
+
+	matches, err := scheduler.PreviewRules()
+	if err != nil {
+		fmt.Printf("❌ 番組表の取得に失敗しました: %v\n", err)
+		os.Exit(1)
+	}
+	if len(matches) == 0 {
+		fmt.Println("一致する番組はありません")
+		return
+	}
+
+	for _, match := range matches {
+		prog := match.Program
+		fmt.Printf("%s-%s  %-4s %s", prog.Start.Format("01/02 15:04"), prog.End.Format("15:04"), prog.StationID, prog.Title)
+		if prog.Performer != "" {
+			fmt.Printf(" (%s)", prog.Performer)
+		}
+		fmt.Printf("  [%s]\n", match.Rule.Name)
+	}
+}
+
 // runTUI starts the terminal UI mode
 func runTUI(volumePercent int) {
 	// Load configuration
@@ -50,12 +202,7 @@ func runTUI(volumePercent int) {
 
 	// If volume is specified via command line, override config
 	if volumePercent >= 0 {
-		cfg.Volume = float64(volumePercent) / 100.0
-		if cfg.Volume < 0 {
-			cfg.Volume = 0
-		} else if cfg.Volume > 1 {
-			cfg.Volume = 1
-		}
+		cfg.Volume = config.ClampVolume(float64(volumePercent) / 100.0)
 	}
 
 	// Get authentication token
@@ -82,9 +229,16 @@ func runTUI(volumePercent int) {
 		fmt.Printf("📻 前回再生: %s\n", cfg.LastStationID)
 	}
 
+	// Start the recording scheduler
+	scheduler, err := recorder.NewScheduler()
+	reportSchedulerError(err)
+	scheduler.SetOutputOptions(recorder.OutputOptionsFromConfig(cfg.Recording))
+	scheduler.Start()
+
 	// Run TUI
 	fmt.Println("🚀 インターフェースを起動中...")
-	err = tui.Run(stations, authToken, cfg)
+	err = tui.Run(stations, authToken, cfg, scheduler)
+	scheduler.Stop()
 	if err != nil {
 		fmt.Printf("❌ インターフェースエラー: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BroadcastDayStartHour is the hour (JST) at which a Radiko broadcast day starts.
+// Programs between 00:00 and 05:00 belong to the previous day's timetable.
+const BroadcastDayStartHour = 5
+
+// GuideProgram represents a program of the program guide with typed times
+type GuideProgram struct {
+	ID          string    // Program ID
+	StationID   string    // Station ID
+	Start       time.Time // Start time (JST)
+	End         time.Time // End time (JST)
+	Title       string    // Program title
+	Performer   string    // Host/Performer
+	Description string    // Short description
+	Info        string    // Detailed information (HTML)
+	ImageURL    string    // Program image
+	URL         string    // Program website
+}
+
+// NewGuideProgram converts a raw API program into a GuideProgram
+func NewGuideProgram(stationID string, p Program) (GuideProgram, error) {
+	start, err := ParseRadikoTime(p.Ft)
+	if err != nil {
+		return GuideProgram{}, fmt.Errorf("invalid start time %q: %w", p.Ft, err)
+	}
+	end, err := ParseRadikoTime(p.To)
+	if err != nil {
+		return GuideProgram{}, fmt.Errorf("invalid end time %q: %w", p.To, err)
+	}
+
+	return GuideProgram{
+		ID:          p.ID,
+		StationID:   stationID,
+		Start:       start,
+		End:         end,
+		Title:       p.Title,
+		Performer:   p.Pfm,
+		Description: p.Desc,
+		Info:        p.Info,
+		ImageURL:    p.Img,
+		URL:         p.URL,
+	}, nil
+}
+
+// Duration returns the length of the program
+func (g GuideProgram) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// IsOnAir reports whether the program is on air at t
+func (g GuideProgram) IsOnAir(t time.Time) bool {
+	return !t.Before(g.Start) && t.Before(g.End)
+}
+
+// IsPast reports whether the program has finished at t
+func (g GuideProgram) IsPast(t time.Time) bool {
+	return !t.Before(g.End)
+}
+
+// htmlTagPattern matches HTML tags in program descriptions
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// PlainDescription returns the description (or the info if there is none)
+// with HTML tags removed and whitespace collapsed
+func (g GuideProgram) PlainDescription() string {
+	desc := g.Description
+	if desc == "" {
+		desc = g.Info
+	}
+	return strings.Join(strings.Fields(htmlTagPattern.ReplaceAllString(desc, " ")), " ")
+}
+
+// Ft returns the start time in YYYYMMDDHHMMSS format
+func (g GuideProgram) Ft() string {
+	return FormatRadikoTime(g.Start)
+}
+
+// To returns the end time in YYYYMMDDHHMMSS format
+func (g GuideProgram) To() string {
+	return FormatRadikoTime(g.End)
+}
+
+// ParseRadikoTime parses a YYYYMMDDHHMMSS timestamp in JST
+func ParseRadikoTime(s string) (time.Time, error) {
+	return time.ParseInLocation(RadikoTimeLayout, s, JST)
+}
+
+// FormatRadikoTime formats t as a YYYYMMDDHHMMSS timestamp in JST
+func FormatRadikoTime(t time.Time) string {
+	return t.In(JST).Format(RadikoTimeLayout)
+}
+
+// BroadcastDate returns the broadcast day (midnight JST) that t belongs to.
+// For example, 2024-01-02 01:30 JST belongs to the broadcast day 2024-01-01.
+func BroadcastDate(t time.Time) time.Time {
+	t = t.In(JST)
+	if t.Hour() < BroadcastDayStartHour {
+		t = t.AddDate(0, 0, -1)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, JST)
+}
+
+// FindProgramAt returns the program on air at t, or nil if there is none
+func FindProgramAt(programs []GuideProgram, t time.Time) *GuideProgram {
+	for i := range programs {
+		if programs[i].IsOnAir(t) {
+			return &programs[i]
+		}
+	}
+	return nil
+}
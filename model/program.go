@@ -1,5 +1,13 @@
 package model
 
+import "time"
+
+// RadikoTimeLayout is the YYYYMMDDHHMMSS layout used by Radiko program and timefree APIs
+const RadikoTimeLayout = "20060102150405"
+
+// JST is Japan Standard Time (UTC+9), the zone of all Radiko timestamps
+var JST = time.FixedZone("JST", 9*60*60)
+
 // ProgramResponse represents the program API response
 type ProgramResponse struct {
 	Stations []StationProgram `json:"stations"`
@@ -19,8 +27,13 @@ type Programs struct {
 
 // Program represents a single program
 type Program struct {
+	ID    string `json:"id"`    // Program ID
 	Ft    string `json:"ft"`    // Start time YYYYMMDDHHMMSS
 	To    string `json:"to"`    // End time YYYYMMDDHHMMSS
 	Title string `json:"title"` // Program title
 	Pfm   string `json:"pfm"`   // Host/Performer
+	Desc  string `json:"desc"`  // Short description
+	Info  string `json:"info"`  // Detailed information (HTML)
+	Img   string `json:"img"`   // Program image URL
+	URL   string `json:"url"`   // Program website URL
 }
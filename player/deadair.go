@@ -0,0 +1,234 @@
+package player
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"radiko-tui/config"
+)
+
+// SilencePolicy controls how dead air (a stream that delivers silence, or the same
+// audio over and over) is detected and handled
+type SilencePolicy struct {
+	ThresholdDB    float64       // RMS level (dBFS) below which audio counts as silence
+	NotifyAfter    time.Duration // Dead air this long raises EventDeadAir
+	ReconnectAfter time.Duration // Dead air this long reconnects once (0 = never)
+	MarkRecording  bool          // Note dead air in the tags of an ongoing recording of the station
+}
+
+// DefaultSilencePolicy returns the policy used unless SetSilencePolicy is called
+func DefaultSilencePolicy() SilencePolicy {
+	return SilencePolicyFromConfig(config.DefaultConfig().Silence)
+}
+
+// SilencePolicyFromConfig builds a policy from the silence section of the config
+func SilencePolicyFromConfig(cfg config.SilenceConfig) SilencePolicy {
+	return SilencePolicy{
+		ThresholdDB:    cfg.ThresholdDB,
+		NotifyAfter:    time.Duration(cfg.NotifySec) * time.Second,
+		ReconnectAfter: time.Duration(cfg.ReconnectSec) * time.Second,
+		MarkRecording:  cfg.MarkRecording,
+	}
+}
+
+// Dead air detection settings
+const (
+	deadAirBlock     = 1024                               // Frames per block (one AAC frame)
+	deadAirBlockSize = deadAirBlock * pcmFrameSize        // Bytes per block
+	loopMemory       = 2 * 60 * sampleRate / deadAirBlock // Blocks searched for repeated audio (2 minutes)
+	deadAirEnd       = time.Second                        // Normal audio this long ends the dead air
+	minNotifyAfter   = 2 * time.Second                    // Shorter pauses are normal between segments
+)
+
+var (
+	errSilent  = errors.New("音声が無音のままです")
+	errLooping = errors.New("同じ音声が繰り返されています")
+)
+
+// deadAirDetector watches the decoded PCM for silence and for audio that repeats
+// (a stuck encoder looping a segment). Repeats are found by hashing blocks of one
+// AAC frame: a looped segment decodes to the same samples at the same offsets.
+// process runs on the goroutine reading the audio output; the counters are read
+// by the monitor.
+type deadAirDetector struct {
+	threshold float64 // Mean square of a silent block (full scale = 1)
+	block     []byte
+	seen      map[uint64]int // Blocks of the last loopMemory, by hash
+	history   []uint64       // Hashes of the last loopMemory blocks, circular
+	next      int
+
+	// Consecutive frames of each kind, in audio time so that pauses do not count
+	silentFrames  atomic.Int64
+	loopFrames    atomic.Int64
+	audibleFrames atomic.Int64
+}
+
+func newDeadAirDetector(thresholdDB float64) *deadAirDetector {
+	return &deadAirDetector{
+		threshold: math.Pow(10, thresholdDB/10),
+		block:     make([]byte, 0, deadAirBlockSize),
+		seen:      make(map[uint64]int),
+		history:   make([]uint64, 0, loopMemory),
+	}
+}
+
+// process adds s16le stereo PCM to the detection
+func (d *deadAirDetector) process(pcm []byte) {
+	for len(pcm) > 0 {
+		n := copy(d.block[len(d.block):cap(d.block)], pcm)
+		d.block = d.block[:len(d.block)+n]
+		pcm = pcm[n:]
+		if len(d.block) == cap(d.block) {
+			d.endBlock()
+			d.block = d.block[:0]
+		}
+	}
+}
+
+// endBlock classifies a full block as silent, repeated or audible
+func (d *deadAirDetector) endBlock() {
+	var sum float64
+	for i := 0; i+1 < len(d.block); i += 2 {
+		s := float64(int16(d.block[i])|int16(d.block[i+1])<<8) / 32768
+		sum += s * s
+	}
+	if sum/float64(len(d.block)/2) < d.threshold {
+		d.silentFrames.Add(deadAirBlock)
+		d.loopFrames.Store(0)
+		d.audibleFrames.Store(0)
+		return
+	}
+	d.silentFrames.Store(0)
+
+	h := fnv.New64a()
+	h.Write(d.block)
+	hash := h.Sum64()
+	repeated := d.seen[hash] > 0
+
+	if len(d.history) < cap(d.history) {
+		d.history = append(d.history, hash)
+	} else {
+		old := d.history[d.next]
+		if d.seen[old]--; d.seen[old] == 0 {
+			delete(d.seen, old)
+		}
+		d.history[d.next] = hash
+		d.next = (d.next + 1) % len(d.history)
+	}
+	d.seen[hash]++
+
+	if repeated {
+		d.loopFrames.Add(deadAirBlock)
+		d.audibleFrames.Store(0)
+	} else {
+		d.loopFrames.Store(0)
+		d.audibleFrames.Add(deadAirBlock)
+	}
+}
+
+// deadAirState is what the detector currently hears
+type deadAirState struct {
+	kind    ErrorKind     // ErrorSilent or ErrorLooping, ErrorUnknown while the audio is normal
+	length  time.Duration // How long the dead air has lasted
+	audible time.Duration // How long the audio has been normal
+}
+
+func (d *deadAirDetector) state() deadAirState {
+	toDuration := func(frames int64) time.Duration {
+		return time.Duration(frames) * time.Second / sampleRate
+	}
+	st := deadAirState{audible: toDuration(d.audibleFrames.Load())}
+	if silent := d.silentFrames.Load(); silent > 0 {
+		st.kind, st.length = ErrorSilent, toDuration(silent)
+	} else if loop := d.loopFrames.Load(); loop > 0 {
+		st.kind, st.length = ErrorLooping, toDuration(loop)
+	}
+	return st
+}
+
+// SetSilencePolicy sets how dead air is detected and handled. The threshold
+// applies from the next decoder start.
+func (p *FFmpegPlayer) SetSilencePolicy(policy SilencePolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.silencePolicy = policy
+}
+
+// checkDeadAirLocked follows the dead air heard by the current decoder: it reports
+// it once it lasts NotifyAfter, notes it in the recording when it ends, and returns
+// the cause of a reconnect once it lasts ReconnectAfter. Only one reconnect is made
+// per dead air, since a station may really be silent. p.mu must be held.
+func (p *FFmpegPlayer) checkDeadAirLocked() error {
+	if p.volumeReader == nil || p.sinceLastData() > time.Second {
+		// Paused or stalled: nothing to judge
+		return nil
+	}
+	st := p.volumeReader.deadAir.state()
+	policy := p.silencePolicy
+	notifyAfter := max(policy.NotifyAfter, minNotifyAfter)
+
+	if p.deadAirKind == ErrorUnknown {
+		if st.length < notifyAfter {
+			return nil
+		}
+		p.deadAirKind = st.kind
+		p.deadAirStart = time.Now().Add(-st.length)
+		p.deadAirLength = st.length
+		p.events.emit(Event{
+			Type:      EventDeadAir,
+			StreamURL: p.streamURL,
+			Since:     p.deadAirStart,
+			Err:       &PlaybackError{Kind: st.kind, Err: deadAirError(st.kind)},
+		})
+	}
+
+	if st.length > 0 {
+		p.deadAirLength = max(p.deadAirLength, st.length)
+	}
+	if st.audible >= deadAirEnd {
+		p.endDeadAirLocked()
+		return nil
+	}
+	if policy.ReconnectAfter > 0 && st.length >= policy.ReconnectAfter && !p.deadAirReconnected {
+		p.deadAirReconnected = true
+		return &PlaybackError{Kind: st.kind, Err: deadAirError(st.kind)}
+	}
+	return nil
+}
+
+// endDeadAirLocked reports the end of the dead air and notes it in the recording. p.mu must be held.
+func (p *FFmpegPlayer) endDeadAirLocked() {
+	ev := Event{
+		Type:      EventDeadAirEnded,
+		StreamURL: p.streamURL,
+		Since:     p.deadAirStart,
+		Err:       &PlaybackError{Kind: p.deadAirKind, Err: deadAirError(p.deadAirKind)},
+	}
+	if p.silencePolicy.MarkRecording && p.recording && p.recordAttached && !p.recordTimefree {
+		// The recording receives the live stream: move the span back by the time-shift
+		start := p.deadAirStart.Add(-p.behindLiveLocked())
+		ev.Gap = p.addRecordGapLocked(start, start.Add(p.deadAirLength), true)
+		ev.Path = p.recordFilePath
+	}
+	p.events.emit(ev)
+	p.resetDeadAirLocked()
+}
+
+// resetDeadAirLocked forgets the dead air being followed. p.mu must be held.
+func (p *FFmpegPlayer) resetDeadAirLocked() {
+	p.deadAirKind = ErrorUnknown
+	p.deadAirStart = time.Time{}
+	p.deadAirLength = 0
+	p.deadAirReconnected = false
+}
+
+// deadAirError returns the sentinel error of a kind of dead air
+func deadAirError(kind ErrorKind) error {
+	if kind == ErrorLooping {
+		return errLooping
+	}
+	return errSilent
+}
@@ -0,0 +1,123 @@
+package player
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// blocksOf returns the duration of n detection blocks
+func blocksOf(n int) time.Duration {
+	return time.Duration(n*deadAirBlock) * time.Second / sampleRate
+}
+
+// silence returns n blocks of PCM at level (full scale = 32767)
+func silence(n int, level int16) []byte {
+	pcm := make([]byte, n*deadAirBlockSize)
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := level
+		if i/2%2 == 1 {
+			v = -level
+		}
+		pcm[i], pcm[i+1] = byte(v), byte(v>>8)
+	}
+	return pcm
+}
+
+// ramp returns n blocks of audible PCM that never repeats a block
+func ramp(n int, start int) []byte {
+	pcm := make([]byte, n*deadAirBlockSize)
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := int16((start + i/2) * 7 % 20000)
+		pcm[i], pcm[i+1] = byte(v), byte(v>>8)
+	}
+	return pcm
+}
+
+func TestDeadAirDetector(t *testing.T) {
+	segment := ramp(50, 0)
+
+	tests := []struct {
+		name        string
+		feed        [][]byte
+		wantKind    ErrorKind
+		wantLength  time.Duration
+		wantAudible time.Duration
+	}{
+		{"digital silence", [][]byte{silence(100, 0)}, ErrorSilent, blocksOf(100), 0},
+		{"noise below the threshold", [][]byte{silence(100, 10)}, ErrorSilent, blocksOf(100), 0},
+		{"audio", [][]byte{ramp(100, 0)}, ErrorUnknown, 0, blocksOf(100)},
+		{"looped segment", [][]byte{segment, segment, segment[:30*deadAirBlockSize]}, ErrorLooping, blocksOf(80), 0},
+		{"audio after silence", [][]byte{silence(100, 0), ramp(20, 0)}, ErrorUnknown, 0, blocksOf(20)},
+		{"silence after a loop", [][]byte{segment, segment, silence(10, 0)}, ErrorSilent, blocksOf(10), 0},
+		{"new audio after a loop", [][]byte{segment, segment, ramp(5, 1000)}, ErrorUnknown, 0, blocksOf(5)},
+		{"partial block", [][]byte{silence(10, 0)[:deadAirBlockSize*10-4]}, ErrorSilent, blocksOf(9), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeadAirDetector(-50)
+			for _, pcm := range tt.feed {
+				// In reads that do not line up with the blocks
+				for len(pcm) > 0 {
+					n := min(len(pcm), 3000)
+					d.process(pcm[:n])
+					pcm = pcm[n:]
+				}
+			}
+
+			st := d.state()
+			if st.kind != tt.wantKind || st.length != tt.wantLength || st.audible != tt.wantAudible {
+				t.Errorf("state = %+v, want kind %v, length %v, audible %v", st, tt.wantKind, tt.wantLength, tt.wantAudible)
+			}
+		})
+	}
+}
+
+func TestDeadAirEndsAfterNormalAudio(t *testing.T) {
+	p := NewPlayerWithPipeline("", 1, Pipeline{})
+	p.SetSilencePolicy(SilencePolicy{ThresholdDB: -50, NotifyAfter: 2 * time.Second})
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	d := newDeadAirDetector(-50)
+	p.volumeReader = &VolumeReader{deadAir: d}
+	check := func(pcm []byte) {
+		d.process(pcm)
+		p.lastDataTime.Store(time.Now().UnixNano())
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if err := p.checkDeadAirLocked(); err != nil {
+			t.Fatalf("reconnect for %v without ReconnectAfter", err)
+		}
+	}
+	next := func() (Event, bool) {
+		select {
+		case ev := <-events:
+			return ev, true
+		default:
+			return Event{}, false
+		}
+	}
+
+	check(silence(150, 0)) // About 3.2s
+	ev, ok := next()
+	if !ok || ev.Type != EventDeadAir || !errors.Is(ev.Err, errSilent) {
+		t.Fatalf("event = %+v, want EventDeadAir for silence", ev)
+	}
+
+	// Normal audio shorter than deadAirEnd does not end it
+	check(ramp(int(deadAirEnd/blocksOf(1))-1, 0))
+	if ev, ok := next(); ok {
+		t.Fatalf("event %v before deadAirEnd of normal audio", ev.Type)
+	}
+	check(ramp(2, 1))
+	ev, ok = next()
+	if !ok || ev.Type != EventDeadAirEnded || !errors.Is(ev.Err, errSilent) {
+		t.Fatalf("event = %+v, want EventDeadAirEnded", ev)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.deadAirKind != ErrorUnknown || p.deadAirLength != 0 {
+		t.Errorf("dead air %v of %v still followed after it ended", p.deadAirKind, p.deadAirLength)
+	}
+}
@@ -0,0 +1,78 @@
+package player
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// FFmpegDecoder decodes the compressed stream with an ffmpeg process
+type FFmpegDecoder struct{}
+
+// ffmpegDecodeSession is a running decoder ffmpeg
+type ffmpegDecodeSession struct {
+	in     io.WriteCloser
+	out    io.Reader
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when ffmpeg has exited
+}
+
+// Start starts ffmpeg reading ADTS AAC from stdin and writing PCM to stdout
+func (FFmpegDecoder) Start() (DecodeSession, error) {
+	if err := lookFFmpeg(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-probesize", "32768",
+		"-f", "aac",
+		"-i", "pipe:0",
+		"-f", "s16le",
+		"-ar", "48000",
+		"-ac", "2",
+		"-loglevel", "error",
+		"pipe:1",
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	s := &ffmpegDecodeSession{
+		in:     stdin,
+		out:    stdout,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *ffmpegDecodeSession) Input() io.WriteCloser { return s.in }
+
+func (s *ffmpegDecodeSession) Output() io.Reader { return s.out }
+
+// Stop kills ffmpeg and waits for it to exit
+func (s *ffmpegDecodeSession) Stop() {
+	s.in.Close()
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,413 @@
+package player
+
+import (
+	"math"
+	"net/url"
+	"sync"
+
+	"radiko-tui/config"
+)
+
+// Processor is a stage of the PCM processing chain. Process works in place on
+// interleaved stereo samples scaled to -1..1. A processor is only used by the
+// goroutine reading the audio output, so it may keep state without locking.
+type Processor interface {
+	Process(samples []float32)
+}
+
+// EQPreset names a tone preset of the equalizer
+type EQPreset string
+
+const (
+	EQFlat   EQPreset = "flat"
+	EQSpeech EQPreset = "speech" // Less rumble, clearer voices (AM talk)
+	EQMusic  EQPreset = "music"  // Fuller bass and treble (FM music)
+)
+
+// EQPresets lists the presets in the order the TUI cycles through them
+var EQPresets = []EQPreset{EQFlat, EQSpeech, EQMusic}
+
+// DSPOptions selects the stages of the processing chain
+type DSPOptions struct {
+	Normalize  bool                // Adjust each station toward TargetLUFS
+	TargetLUFS float64             // Loudness target of the normalization
+	EQ         EQPreset            // Default preset
+	StationEQ  map[string]EQPreset // Preset per station ID, overriding EQ
+	Mono       bool                // Downmix to mono
+	Balance    float64             // -1 (left) to 1 (right)
+	Limiter    bool                // Keep peaks below full scale
+
+	// Extra creates additional stages for each chain, run after the EQ
+	Extra []func() Processor
+}
+
+// DSPOptionsFromConfig builds the options from the audio section of the config
+func DSPOptionsFromConfig(cfg config.AudioConfig) DSPOptions {
+	opts := DSPOptions{
+		Normalize:  cfg.Normalize,
+		TargetLUFS: cfg.TargetLUFS,
+		EQ:         EQPreset(cfg.EQ),
+		Mono:       cfg.Mono,
+		Balance:    cfg.Balance,
+		Limiter:    cfg.Limiter,
+	}
+	if len(cfg.StationEQ) > 0 {
+		opts.StationEQ = make(map[string]EQPreset, len(cfg.StationEQ))
+		for id, preset := range cfg.StationEQ {
+			opts.StationEQ[id] = EQPreset(preset)
+		}
+	}
+	return opts
+}
+
+// eqFor returns the preset used for a station
+func (o DSPOptions) eqFor(stationID string) EQPreset {
+	if preset, ok := o.StationEQ[stationID]; ok {
+		return preset
+	}
+	return o.EQ
+}
+
+// dspChain is the processing applied to the decoded PCM before it is played
+type dspChain struct {
+	meter   *levelMeter // Measures the PCM as decoded (may be nil)
+	stages  []Processor // Before the volume
+	limiter *limiter    // After the volume (nil if disabled)
+	buf     []float32
+}
+
+// newDSPChain builds the chain for a station. The normalizer starts from the
+// loudness last measured for the station.
+func newDSPChain(opts DSPOptions, stationID string, memory *loudnessMemory) *dspChain {
+	c := &dspChain{}
+	if opts.Normalize {
+		c.stages = append(c.stages, newNormalizer(opts.TargetLUFS, stationID, memory))
+	}
+	if eq := newEqualizer(opts.eqFor(stationID)); eq != nil {
+		c.stages = append(c.stages, eq)
+	}
+	for _, extra := range opts.Extra {
+		c.stages = append(c.stages, extra())
+	}
+	if opts.Mono || opts.Balance != 0 {
+		c.stages = append(c.stages, stereoStage{mono: opts.Mono, balance: math.Max(-1, math.Min(1, opts.Balance))})
+	}
+	if opts.Limiter {
+		c.limiter = newLimiter()
+	}
+	return c
+}
+
+// process runs the chain on s16le stereo PCM in place, applying gain after the stages.
+// A gain above 1 (boost) is soft-clipped. pcm must hold whole frames.
+func (c *dspChain) process(pcm []byte, gain float64) {
+	n := len(pcm) / 2
+	if cap(c.buf) < n {
+		c.buf = make([]float32, n)
+	}
+	samples := c.buf[:n]
+	for i := range samples {
+		samples[i] = float32(int16(pcm[2*i])|int16(pcm[2*i+1])<<8) / 32768
+	}
+
+	if c.meter != nil {
+		c.meter.Process(samples)
+	}
+	for _, stage := range c.stages {
+		stage.Process(samples)
+	}
+	g := float32(gain)
+	for i := range samples {
+		samples[i] *= g
+	}
+	if c.limiter != nil {
+		c.limiter.Process(samples)
+	}
+	if gain > 1 {
+		softClip(samples)
+	}
+
+	for i, s := range samples {
+		v := int16(math.Max(-32768, math.Min(32767, float64(s)*32768)))
+		pcm[2*i] = byte(v)
+		pcm[2*i+1] = byte(v >> 8)
+	}
+}
+
+// stationIDFromURL returns the station_id parameter of a stream URL, or the URL itself
+func stationIDFromURL(streamURL string) string {
+	if u, err := url.Parse(streamURL); err == nil {
+		if id := u.Query().Get("station_id"); id != "" {
+			return id
+		}
+	}
+	return streamURL
+}
+
+// stereoStage downmixes to mono and applies the balance
+type stereoStage struct {
+	mono    bool
+	balance float64
+}
+
+func (s stereoStage) Process(samples []float32) {
+	left := float32(math.Min(1, 1-s.balance))
+	right := float32(math.Min(1, 1+s.balance))
+	for i := 0; i+1 < len(samples); i += 2 {
+		l, r := samples[i], samples[i+1]
+		if s.mono {
+			l = (l + r) / 2
+			r = l
+		}
+		samples[i] = l * left
+		samples[i+1] = r * right
+	}
+}
+
+// biquad is a second-order IIR filter with its state for both channels
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             [2]float64
+}
+
+// filter runs the biquad on one sample of channel ch (transposed direct form II)
+func (f *biquad) filter(ch int, x float64) float64 {
+	y := f.b0*x + f.z1[ch]
+	f.z1[ch] = f.b1*x - f.a1*y + f.z2[ch]
+	f.z2[ch] = f.b2*x - f.a2*y
+	return y
+}
+
+// shelf and peaking filters of the Audio EQ Cookbook at 48kHz
+const sampleRate = 48000
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) *biquad {
+	return &biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+func lowShelf(freq, gainDB float64) *biquad {
+	a := math.Pow(10, gainDB/40)
+	w := 2 * math.Pi * freq / sampleRate
+	cos, alpha := math.Cos(w), math.Sin(w)/2*math.Sqrt2
+	sq := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)-(a-1)*cos+sq), 2*a*((a-1)-(a+1)*cos), a*((a+1)-(a-1)*cos-sq),
+		(a+1)+(a-1)*cos+sq, -2*((a-1)+(a+1)*cos), (a+1)+(a-1)*cos-sq,
+	)
+}
+
+func highShelf(freq, gainDB float64) *biquad {
+	a := math.Pow(10, gainDB/40)
+	w := 2 * math.Pi * freq / sampleRate
+	cos, alpha := math.Cos(w), math.Sin(w)/2*math.Sqrt2
+	sq := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)+(a-1)*cos+sq), -2*a*((a-1)+(a+1)*cos), a*((a+1)+(a-1)*cos-sq),
+		(a+1)-(a-1)*cos+sq, 2*((a-1)-(a+1)*cos), (a+1)-(a-1)*cos-sq,
+	)
+}
+
+func peaking(freq, gainDB, q float64) *biquad {
+	a := math.Pow(10, gainDB/40)
+	w := 2 * math.Pi * freq / sampleRate
+	cos, alpha := math.Cos(w), math.Sin(w)/(2*q)
+	return newBiquad(1+alpha*a, -2*cos, 1-alpha*a, 1+alpha/a, -2*cos, 1-alpha/a)
+}
+
+// equalizer is a low shelf, a peaking band and a high shelf
+type equalizer struct {
+	bands []*biquad
+}
+
+// newEqualizer returns the equalizer of a preset, or nil for flat
+func newEqualizer(preset EQPreset) *equalizer {
+	switch preset {
+	case EQSpeech:
+		return &equalizer{bands: []*biquad{lowShelf(150, -6), peaking(2500, 4, 1), highShelf(8000, -2)}}
+	case EQMusic:
+		return &equalizer{bands: []*biquad{lowShelf(100, 4), peaking(1000, -1, 0.7), highShelf(8000, 3)}}
+	default:
+		return nil
+	}
+}
+
+func (e *equalizer) Process(samples []float32) {
+	for i := range samples {
+		ch := i & 1
+		x := float64(samples[i])
+		for _, band := range e.bands {
+			x = band.filter(ch, x)
+		}
+		samples[i] = float32(x)
+	}
+}
+
+// Limiter settings: peaks are held below -1 dBFS, and the gain recovers in about 100ms
+const (
+	limiterThreshold = 0.89
+	limiterRelease   = 0.1 * sampleRate
+)
+
+// limiter reduces the gain at once when a peak would exceed the threshold and
+// lets it recover slowly, so boosted audio does not clip
+type limiter struct {
+	gain    float32
+	release float32
+}
+
+func newLimiter() *limiter {
+	return &limiter{gain: 1, release: float32(1 - math.Exp(-1/limiterRelease))}
+}
+
+func (l *limiter) Process(samples []float32) {
+	for i := 0; i+1 < len(samples); i += 2 {
+		peak := max(abs32(samples[i]), abs32(samples[i+1]))
+		if peak*l.gain > limiterThreshold {
+			l.gain = limiterThreshold / peak
+		} else {
+			l.gain += (1 - l.gain) * l.release
+		}
+		samples[i] *= l.gain
+		samples[i+1] *= l.gain
+	}
+}
+
+func abs32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// softClipKnee is the level above which softClip bends the signal
+const softClipKnee = 0.8
+
+// softClip rounds off peaks above the knee so they approach full scale without
+// reaching it, instead of clipping hard
+func softClip(samples []float32) {
+	for i, s := range samples {
+		a := abs32(s)
+		if a <= softClipKnee {
+			continue
+		}
+		a = softClipKnee + (1-softClipKnee)*float32(math.Tanh(float64((a-softClipKnee)/(1-softClipKnee))))
+		if s < 0 {
+			a = -a
+		}
+		samples[i] = a
+	}
+}
+
+// Loudness normalization settings
+const (
+	loudnessBlock    = sampleRate * 4 / 10 // 400ms measurement blocks (frames)
+	loudnessGate     = -70.0               // Blocks quieter than this (LUFS) are silence
+	loudnessWindow   = 15 * 10 / 4         // Blocks the measurement averages over (15s)
+	maxNormalizeGain = 12.0                // dB
+	gainSlewPerBlock = 0.4                 // dB the gain may move per block (1 dB/s)
+)
+
+// loudnessMemory keeps the loudness measured for each station, so that the
+// normalization starts at the right gain when a station is played again
+type loudnessMemory struct {
+	mu       sync.Mutex
+	stations map[string]float64 // Mean square of the K-weighted signal
+}
+
+func (m *loudnessMemory) get(stationID string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	power, ok := m.stations[stationID]
+	return power, ok
+}
+
+func (m *loudnessMemory) set(stationID string, power float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stations == nil {
+		m.stations = make(map[string]float64)
+	}
+	m.stations[stationID] = power
+}
+
+// normalizer measures the loudness of the stream (K-weighted as in ITU-R BS.1770,
+// averaged over gated 400ms blocks) and slowly moves its gain toward the target
+type normalizer struct {
+	target    float64
+	stationID string
+	memory    *loudnessMemory
+	kShelf    *biquad
+	kHighPass *biquad
+	sum       float64 // K-weighted energy of the current block
+	frames    int
+	blocks    int     // Blocks measured so far
+	power     float64 // Averaged mean square (0 = not measured yet)
+	gainDB    float64
+}
+
+func newNormalizer(target float64, stationID string, memory *loudnessMemory) *normalizer {
+	n := &normalizer{
+		target:    target,
+		stationID: stationID,
+		memory:    memory,
+		// BS.1770 K-weighting at 48kHz
+		kShelf:    &biquad{b0: 1.53512485958697, b1: -2.69169618940638, b2: 1.19839281085285, a1: -1.69065929318241, a2: 0.73248077421585},
+		kHighPass: &biquad{b0: 1, b1: -2, b2: 1, a1: -1.99004745483398, a2: 0.99007225036621},
+	}
+	if power, ok := memory.get(stationID); ok {
+		n.power = power
+		n.blocks = loudnessWindow
+		n.gainDB = n.targetGain()
+	}
+	return n
+}
+
+// targetGain returns the gain that brings the measured loudness to the target
+func (n *normalizer) targetGain() float64 {
+	if n.power <= 0 {
+		return 0
+	}
+	lufs := -0.691 + 10*math.Log10(n.power)
+	return math.Max(-maxNormalizeGain, math.Min(maxNormalizeGain, n.target-lufs))
+}
+
+func (n *normalizer) Process(samples []float32) {
+	gain := float32(math.Pow(10, n.gainDB/20))
+	for i := 0; i+1 < len(samples); i += 2 {
+		l := n.kHighPass.filter(0, n.kShelf.filter(0, float64(samples[i])))
+		r := n.kHighPass.filter(1, n.kShelf.filter(1, float64(samples[i+1])))
+		n.sum += l*l + r*r
+		n.frames++
+		if n.frames == loudnessBlock {
+			n.endBlock()
+			gain = float32(math.Pow(10, n.gainDB/20))
+		}
+		samples[i] *= gain
+		samples[i+1] *= gain
+	}
+}
+
+// endBlock adds a finished block to the measurement and moves the gain
+func (n *normalizer) endBlock() {
+	power := n.sum / float64(n.frames)
+	n.sum, n.frames = 0, 0
+	if -0.691+10*math.Log10(power) < loudnessGate {
+		return
+	}
+
+	// Converge quickly on a station never measured, then average over the window
+	n.blocks++
+	weight := 1 / float64(n.blocks)
+	if window := 1.0 / loudnessWindow; weight < window {
+		weight = window
+	}
+	if n.power == 0 {
+		n.power = power
+	} else {
+		n.power += (power - n.power) * weight
+	}
+	n.memory.set(n.stationID, n.power)
+
+	target := n.targetGain()
+	n.gainDB += math.Max(-gainSlewPerBlock, math.Min(gainSlewPerBlock, target-n.gainDB))
+}
@@ -0,0 +1,143 @@
+package player
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns frames of a stereo sine of freq Hz at amplitude
+func sine(frames int, freq, amplitude float64) []float32 {
+	samples := make([]float32, frames*2)
+	for i := range frames {
+		v := float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+		samples[2*i], samples[2*i+1] = v, v
+	}
+	return samples
+}
+
+// rms returns the root mean square of samples
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// powerOf returns the mean square a normalizer measures at lufs
+func powerOf(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+func TestNormalizerTargetGain(t *testing.T) {
+	tests := []struct {
+		name   string
+		target float64
+		power  float64
+		want   float64
+	}{
+		{"not measured yet", -23, 0, 0},
+		{"quieter than the target", -23, powerOf(-28), 5},
+		{"louder than the target", -23, powerOf(-15), -8},
+		{"boost clamped", -16, powerOf(-40), maxNormalizeGain},
+		{"cut clamped", -40, powerOf(-5), -maxNormalizeGain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &normalizer{target: tt.target, power: tt.power}
+			if got := n.targetGain(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("targetGain = %.3f dB, want %.3f dB", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizerSlew(t *testing.T) {
+	memory := &loudnessMemory{}
+	n := newNormalizer(-40, "TEST", memory)
+
+	// A loud tone wants far more than the largest cut: the gain moves toward it
+	// by at most the slew per block
+	block := sine(loudnessBlock, 1000, 0.9)
+	previous := n.gainDB
+	for i := range 40 {
+		n.Process(append([]float32(nil), block...))
+		step := n.gainDB - previous
+		if step > 0 || step < -gainSlewPerBlock-1e-9 {
+			t.Fatalf("block %d moved the gain by %.3f dB, want a cut of at most %.1f dB", i, step, gainSlewPerBlock)
+		}
+		previous = n.gainDB
+	}
+	if n.gainDB != -maxNormalizeGain {
+		t.Errorf("gain = %.3f dB after 40 blocks, want the largest cut", n.gainDB)
+	}
+
+	// The station starts at the gain measured when it is played again
+	if again := newNormalizer(-40, "TEST", memory); again.gainDB != -maxNormalizeGain {
+		t.Errorf("gain = %.3f dB when played again, want %.1f dB", again.gainDB, -maxNormalizeGain)
+	}
+	if other := newNormalizer(-40, "OTHER", memory); other.gainDB != 0 {
+		t.Errorf("gain = %.3f dB for a station never measured, want 0", other.gainDB)
+	}
+}
+
+func TestNormalizerIgnoresSilence(t *testing.T) {
+	n := newNormalizer(-23, "TEST", &loudnessMemory{})
+	for range 10 {
+		n.Process(make([]float32, loudnessBlock*2))
+	}
+	if n.power != 0 || n.gainDB != 0 {
+		t.Errorf("silence measured as %g, gain %.3f dB, want neither", n.power, n.gainDB)
+	}
+}
+
+func TestLimiterKeepsPeaksBelowThreshold(t *testing.T) {
+	ceiling := float32(math.Pow(10, -1.0/20)) // -1 dBFS
+	l := newLimiter()
+
+	// Boosted audio far above full scale
+	loud := sine(sampleRate/2, 440, 2.5)
+	l.Process(loud)
+	for i, s := range loud {
+		if abs32(s) > ceiling {
+			t.Fatalf("sample %d = %.3f, above -1 dBFS", i, s)
+		}
+	}
+
+	// The gain recovers once the audio is quiet again
+	quiet := sine(sampleRate, 440, 0.5)
+	l.Process(quiet)
+	if got := rms(quiet[len(quiet)/2:]); math.Abs(got-0.5/math.Sqrt2) > 0.01 {
+		t.Errorf("quiet audio at %.3f RMS after recovering, want %.3f", got, 0.5/math.Sqrt2)
+	}
+}
+
+func TestEqualizer(t *testing.T) {
+	if eq := newEqualizer(EQFlat); eq != nil {
+		t.Error("flat preset has an equalizer")
+	}
+
+	tests := []struct {
+		preset EQPreset
+		freq   float64
+		wantDB float64
+	}{
+		{EQSpeech, 50, -6},
+		{EQSpeech, 2500, 4},
+		{EQMusic, 50, 4},
+		{EQMusic, 1000, -1},
+		{EQMusic, 15000, 3},
+	}
+	for _, tt := range tests {
+		eq := newEqualizer(tt.preset)
+		in := sine(sampleRate, tt.freq, 0.25)
+		out := append([]float32(nil), in...)
+		eq.Process(out)
+
+		// Measured on the second half, once the filters settled
+		gotDB := 20 * math.Log10(rms(out[len(out)/2:])/rms(in[len(in)/2:]))
+		if math.Abs(gotDB-tt.wantDB) > 1 {
+			t.Errorf("%s at %gHz: %.2f dB, want about %.0f dB", tt.preset, tt.freq, gotDB, tt.wantDB)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package player
+
+import (
+	"sync"
+	"time"
+
+	"radiko-tui/model"
+	"radiko-tui/recorder"
+)
+
+// EventType identifies what happened in the player
+type EventType int
+
+const (
+	EventStarted           EventType = iota // Playback started (StreamURL)
+	EventStopped                            // Playback stopped, or timefree playback reached the end
+	EventStalled                            // Playback failed and is being reconnected (Err)
+	EventReconnecting                       // Reconnect attempt scheduled (Attempt, MaxAttempts, NextRetry, Err)
+	EventAuthRefreshed                      // A new auth token was obtained while reconnecting
+	EventRecovered                          // Playback resumed after a reconnect (Attempt)
+	EventFailed                             // Reconnecting gave up (Err, and NextRetry if it starts over after a cooldown)
+	EventRecordingStarted                   // Recording started (Path)
+	EventRecordingStopped                   // Recording stopped and its files were finished (Path)
+	EventRecordingFailed                    // Recording or finishing a file failed (Err)
+	EventRecordingStalled                   // The recording receives no audio and is being resumed
+	EventRecordingResumed                   // The recording receives audio again (Gap, if audio is missing)
+	EventProgramChanged                     // Another program went on air during live playback (Program), or the recording moved on to it (Program, Path)
+	EventSleepTimerExpired                  // The sleep timer stopped playback
+	EventDeadAir                            // The audio has been silent or looping for a while (Err, Since)
+	EventDeadAirEnded                       // The audio is normal again (Err, Since, and Gap and Path if noted in the recording)
+	EventRecordingDropped                   // The recording ffmpeg fell behind and audio was dropped (Gap, Path)
+)
+
+// String returns the name of the event type, for logs
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventStopped:
+		return "stopped"
+	case EventStalled:
+		return "stalled"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventAuthRefreshed:
+		return "auth-refreshed"
+	case EventRecovered:
+		return "recovered"
+	case EventFailed:
+		return "failed"
+	case EventRecordingStarted:
+		return "recording-started"
+	case EventRecordingStopped:
+		return "recording-stopped"
+	case EventRecordingFailed:
+		return "recording-failed"
+	case EventRecordingStalled:
+		return "recording-stalled"
+	case EventRecordingResumed:
+		return "recording-resumed"
+	case EventProgramChanged:
+		return "program-changed"
+	case EventSleepTimerExpired:
+		return "sleep-timer-expired"
+	case EventDeadAir:
+		return "dead-air"
+	case EventDeadAirEnded:
+		return "dead-air-ended"
+	case EventRecordingDropped:
+		return "recording-dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change of the player's state. Only the fields noted for its type are set.
+type Event struct {
+	Type        EventType
+	Time        time.Time
+	StreamURL   string
+	Attempt     int                 // Reconnect attempt, starting at 1
+	MaxAttempts int                 // Attempts before giving up (0 = unlimited)
+	NextRetry   time.Time           // When the attempt starts
+	Err         error               // Reason of a failure, a *PlaybackError for reconnects
+	Path        string              // Recording file
+	Program     *model.GuideProgram // New program
+	Gap         recorder.Gap        // Audio missing from the recording, or dead air in it
+	Since       time.Time           // When the dead air started playing
+}
+
+// eventBufferSize is the number of events buffered per subscriber. Events are
+// dropped for a subscriber that falls this far behind, so the player never waits.
+const eventBufferSize = 64
+
+// eventHub delivers events to subscribers. It has its own lock, so events can be
+// emitted with the player locked.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// subscribe adds a subscriber. The returned function removes it and closes its channel.
+func (h *eventHub) subscribe() (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, eventBufferSize)
+	h.subs[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subs, ch)
+			close(ch)
+		})
+	}
+}
+
+// emit sends ev to all subscribers without blocking
+func (h *eventHub) emit(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -1,34 +1,27 @@
-//go:build !noaudio
-
 package player
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ebitengine/oto/v3"
-)
-
-// ReconnectStatus represents the reconnection state
-type ReconnectStatus int
-
-const (
-	ReconnectNone ReconnectStatus = iota
-	ReconnectStarted
-	ReconnectAuth
-	ReconnectPlaying
-	ReconnectSuccess
-	ReconnectFailed
+	"radiko-tui/config"
+	"radiko-tui/internal/adts"
+	"radiko-tui/model"
+	"radiko-tui/recorder"
 )
 
-// FFmpegPlayer is a player that uses ffmpeg for decoding
+// FFmpegPlayer is the Player implementation. By default it fetches and decodes
+// streams with ffmpeg and plays them with oto; NewPlayerWithPipeline replaces
+// those stages.
 type FFmpegPlayer struct {
 	authToken        string
 	streamURL        string
@@ -36,45 +29,144 @@ type FFmpegPlayer struct {
 	playing          bool
 	ctx              context.Context
 	cancel           context.CancelFunc
-	cmd              *exec.Cmd
-	otoContext       *oto.Context
-	otoPlayer        *oto.Player
+	pipeline         Pipeline           // Stream source, decoder and audio output
+	source           *upstream          // Stream connection shared by playback and recording
+	decoder          DecodeSession      // Decodes the upstream's AAC to PCM
+	decoderIn        io.WriteCloser     // Decoder input
+	feedCancel       context.CancelFunc // Stops feeding the decoder from the time-shift buffer
+	output           AudioOutput        // Plays the decoder's PCM
+	volumeReader     *VolumeReader      // Processes the decoder's PCM for output
+	dspOptions       DSPOptions
+	loudness         loudnessMemory // Loudness measured per station
+	meter            levelMeter     // Levels of the PCM played
 	volume           float64
 	muted            bool
 	volumeBeforeMute float64
-	lastDataTime     time.Time
+	lastDataTime     atomic.Int64 // Last time PCM was played (unix nanoseconds), updated without p.mu
+	lastSourceData   time.Time    // Last time the upstream delivered data
 	onReconnect      func() string
 	reconnectStatus  ReconnectStatus // Reconnection status (for TUI to query)
 	lastError        string          // Last error message
+	reconnectAttempt int             // Consecutive reconnect attempts
+	reconnectPolicy  ReconnectPolicy
+	reconnectCancel  context.CancelFunc // Cancels the scheduled reconnect attempt (nil if none)
+	events           eventHub
 
 	// Recording related fields
 	recording       bool
-	recordCmd       *exec.Cmd
-	recordCtx       context.Context
-	recordCancel    context.CancelFunc
+	recordProc      *recordProcess // ffmpeg process writing the current segment
 	recordFilePath  string
 	recordStation   string
 	recordStartTime time.Time
+	recordStreamURL string        // Stream being recorded (playback may move on to another station)
+	recordAttached  bool          // The recording shares the playback upstream
+	recordSource    *upstream     // Own upstream of the recording once playback moved on (nil if none)
+	recordAuthToken string        // Auth token of the recorded stream, kept apart from playback's
+	recordTimefree  bool          // Recording a past broadcast
+	recordLastData  time.Time     // Last time the recording received audio
+	recordSplitter  adts.Splitter // Frames of the recorded stream, which the recording queues whole
+
+	// Program-aware / split recording related fields
+	recordOptions       RecordingOptions
+	recordProgram       *model.GuideProgram // Program of the current file (program-aware mode)
+	recordPart          int                 // Part number of the current file within a program
+	recordFiles         []string            // Files written in this recording session
+	recordFileStart     time.Time           // When the current file was started
+	recordSessionCancel context.CancelFunc  // Stops superviseRecording
+	recordCover         string              // Cover art of the current file (empty if none)
+	programLookup       ProgramLookup
+	programWatchCancel  context.CancelFunc // Stops watchProgram (nil if not following the program)
+
+	// Recording supervision related fields
+	recordSegments []string       // Segments of the current file (the first one is the file itself)
+	recordGaps     []recorder.Gap // Spans missing from the current file
+	recordStalled  bool           // The recording is being resumed after a stall
+	recordDropGap  int            // 1 + index in recordGaps of the gap of the last drop (0 = none)
+	recordLastDrop time.Time      // When the recording ffmpeg last fell behind
+
+	// Timefree (past broadcast) related fields
+	timefree *timefreeSession // nil while playing live
+	pcmBytes atomic.Int64     // PCM bytes played since the decoder was last started
+
+	// Live time-shift related fields
+	timeshiftCapacity time.Duration    // Length of the time-shift buffer (0 = disabled)
+	shift             *timeshiftBuffer // Buffer of the live stream (nil while playing timefree)
+	shiftStart        time.Duration    // Stream time at which the current decoder started
+	shiftPaused       bool
+	shiftLive         bool          // Following the live edge
+	shiftLag          time.Duration // Distance to the live edge while following it
+
+	// Dead air related fields
+	silencePolicy      SilencePolicy
+	deadAirKind        ErrorKind     // Dead air being followed (ErrorUnknown = none)
+	deadAirStart       time.Time     // When the dead air started playing
+	deadAirLength      time.Duration // Longest length measured
+	deadAirReconnected bool          // A reconnect was made for this dead air
+
+	// Sleep timer related fields
+	sleepAt            atomic.Int64 // When playback stops (unix nanoseconds, 0 = no timer), read by VolumeReader
+	sleepStopRecording bool         // The timer stops the recording as well
+	sleepTimer         *time.Timer
+}
+
+// defaultTimeshift is the default length of the live time-shift buffer
+const defaultTimeshift = 30 * time.Minute
+
+// liveStallTimeout is how long the live upstream may deliver nothing before reconnecting.
+// HLS delivers audio in segments of a few seconds.
+const liveStallTimeout = 10 * time.Second
+
+// pcmBytesPerSecond is the size of one second of decoded audio (48kHz, stereo, s16le)
+const pcmBytesPerSecond = 48000 * 2 * 2
+
+// timefreeSession holds the state of a timefree (past broadcast) playback
+type timefreeSession struct {
+	playlistURL string        // Playlist URL without seek parameter
+	start       time.Time     // Program start time
+	end         time.Time     // Program end time
+	offset      time.Duration // Position at which ffmpeg was last started (or paused)
+	paused      bool
+	finished    bool
 }
 
 // NewFFmpegPlayer creates a new ffmpeg player
 func NewFFmpegPlayer(authToken string, initialVolume float64) *FFmpegPlayer {
+	return NewPlayerWithPipeline(authToken, initialVolume, DefaultPipeline())
+}
+
+// NewPlayerWithPipeline creates a player that fetches, decodes and plays audio through pipeline
+func NewPlayerWithPipeline(authToken string, initialVolume float64, pipeline Pipeline) *FFmpegPlayer {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	if initialVolume < 0 {
-		initialVolume = 0
-	} else if initialVolume > 1 {
-		initialVolume = 1
+	initialVolume = config.ClampVolume(initialVolume)
+	if pipeline.Encoder == nil {
+		pipeline.Encoder = FFmpegEncoder{}
 	}
 
 	return &FFmpegPlayer{
-		authToken:       authToken,
-		ctx:             ctx,
-		cancel:          cancel,
-		volume:          initialVolume,
-		muted:           false,
-		reconnectStatus: ReconnectNone,
+		authToken:         authToken,
+		pipeline:          pipeline,
+		ctx:               ctx,
+		cancel:            cancel,
+		volume:            initialVolume,
+		muted:             false,
+		reconnectStatus:   ReconnectNone,
+		reconnectPolicy:   DefaultReconnectPolicy(),
+		silencePolicy:     DefaultSilencePolicy(),
+		dspOptions:        DSPOptionsFromConfig(config.DefaultConfig().Audio),
+		timeshiftCapacity: defaultTimeshift,
+	}
+}
+
+// SetTimeshiftDuration sets the length of the live time-shift buffer (0 disables it).
+// It applies from the next live playback.
+func (p *FFmpegPlayer) SetTimeshiftDuration(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d < 0 {
+		d = 0
 	}
+	p.timeshiftCapacity = d
 }
 
 // SetReconnectCallback sets the reconnection callback function
@@ -84,6 +176,13 @@ func (p *FFmpegPlayer) SetReconnectCallback(callback func() string) {
 	p.onReconnect = callback
 }
 
+// SetReconnectPolicy sets how playback is retried after it failed
+func (p *FFmpegPlayer) SetReconnectPolicy(policy ReconnectPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reconnectPolicy = policy
+}
+
 // UpdateAuthToken updates the authentication token (used when switching stations)
 func (p *FFmpegPlayer) UpdateAuthToken(token string) {
 	p.mu.Lock()
@@ -113,134 +212,340 @@ func (p *FFmpegPlayer) ClearReconnectStatus() {
 	p.lastError = ""
 }
 
-// Play starts playback
+// Subscribe returns a channel receiving the player's events, and a function that
+// ends the subscription and closes the channel. Events are dropped for a subscriber
+// that does not keep up.
+func (p *FFmpegPlayer) Subscribe() (<-chan Event, func()) {
+	return p.events.subscribe()
+}
+
+// Play starts playback. A recording of another stream keeps its own connection.
 func (p *FFmpegPlayer) Play(streamURL string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.cancelReconnectLocked()
+	if err := p.playLocked(streamURL); err != nil {
+		return err
+	}
+	p.reconnectAttempt = 0
+	p.resetDeadAirLocked()
+	p.watchProgramLocked(streamURL)
+	p.events.emit(Event{Type: EventStarted, StreamURL: streamURL})
+	return nil
+}
+
+// playLocked starts live playback of streamURL. p.mu must be held.
+func (p *FFmpegPlayer) playLocked(streamURL string) error {
 	if p.playing {
 		return fmt.Errorf("already playing")
 	}
 
+	if streamURL != p.recordStreamURL {
+		p.detachRecordingLocked()
+	}
+	if streamURL != p.streamURL {
+		// The time-shift buffer belongs to the previous stream
+		p.shift = nil
+	}
+	p.timefree = nil
+	return p.startLocked(streamURL)
+}
+
+// startLocked starts the stream and the audio output for streamURL. p.mu must be held.
+func (p *FFmpegPlayer) startLocked(streamURL string) error {
 	p.streamURL = streamURL
 	p.reconnectStatus = ReconnectNone
 	p.lastError = ""
 
-	_, err := exec.LookPath("ffmpeg")
-	if err != nil {
-		return fmt.Errorf("ffmpeg not found in PATH. Please install ffmpeg: %w", err)
+	// Live playback goes through the time-shift buffer (kept across reconnects)
+	var at time.Duration
+	if p.timefree != nil || p.timeshiftCapacity == 0 {
+		p.shift = nil
+		p.shiftPaused = false
+	} else if p.shift == nil {
+		p.shift = newTimeshiftBuffer(p.timeshiftCapacity)
+		p.shiftPaused = false
+		p.shiftLive = true
+		p.shiftLag = 0
+	} else {
+		at = p.playheadLocked()
 	}
 
-	if p.otoContext == nil {
-		err = p.initAudio(48000, 2)
-		if err != nil {
-			return fmt.Errorf("failed to init audio: %w", err)
-		}
+	if err := p.startDecoderLocked(at); err != nil {
+		return err
 	}
 
-	p.cmd = exec.CommandContext(p.ctx, "ffmpeg",
-		"-headers", fmt.Sprintf("X-Radiko-AuthToken: %s", p.authToken),
-		"-i", streamURL,
-		"-f", "s16le",
-		"-ar", "48000",
-		"-ac", "2",
-		"-loglevel", "error",
-		"pipe:1",
-	)
-
-	stdout, err := p.cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to get stdout pipe: %w", err)
-	}
-
-	err = p.cmd.Start()
-	if err != nil {
-		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	if err := p.startSourceLocked(streamURL); err != nil {
+		p.stopDecoderLocked()
+		return err
 	}
 
 	p.playing = true
-	p.lastDataTime = time.Now()
 
-	go p.pumpAudio(stdout)
-	go p.monitorPlayback()
+	go p.monitorPlayback(p.ctx)
 
 	return nil
 }
 
-func (p *FFmpegPlayer) initAudio(sampleRate, channelCount int) error {
-	op := &oto.NewContextOptions{
-		SampleRate:   sampleRate,
-		ChannelCount: channelCount,
-		Format:       oto.FormatSignedInt16LE,
+// startSourceLocked connects the upstream of the playback. p.mu must be held.
+func (p *FFmpegPlayer) startSourceLocked(streamURL string) error {
+	source, err := startUpstream(p.pipeline.Source, streamURL, p.authToken, p.deliver)
+	if err != nil {
+		return err
 	}
+	p.source = source
+	p.lastSourceData = time.Now()
+	return nil
+}
 
-	var ready chan struct{}
-	var err error
-	p.otoContext, ready, err = oto.NewContext(op)
+// startDecoderLocked starts the decoder and the audio output. During live playback the
+// decoder is fed from the time-shift buffer from stream time at. p.mu must be held.
+func (p *FFmpegPlayer) startDecoderLocked(at time.Duration) error {
+	decoder, err := p.pipeline.Decoder.Start()
 	if err != nil {
-		return fmt.Errorf("failed to create oto context: %w", err)
+		return err
 	}
 
-	<-ready
+	// VolumeReader does not take p.mu, so the sink may read while it is held
+	vr := &VolumeReader{
+		reader:  decoder.Output(),
+		player:  p,
+		deadAir: newDeadAirDetector(p.silencePolicy.ThresholdDB),
+	}
+	vr.chain.Store(p.newDSPChainLocked())
+	output, err := p.pipeline.Sink.NewOutput(vr)
+	if err != nil {
+		decoder.Stop()
+		return err
+	}
+	p.volumeReader = vr
+
+	p.decoder = decoder
+	p.decoderIn = decoder.Input()
+	p.output = output
+	p.lastDataTime.Store(time.Now().UnixNano())
+	p.pcmBytes.Store(0)
+
+	if p.shift != nil {
+		var ctx context.Context
+		ctx, p.feedCancel = context.WithCancel(context.Background())
+		seq, start := p.shift.seek(at)
+		p.shiftStart = start
+		go p.feedDecoder(ctx, p.decoderIn, p.shift, seq)
+	}
+
+	if !p.shiftPaused {
+		output.Play()
+	}
 	return nil
 }
 
-func (p *FFmpegPlayer) pumpAudio(reader io.Reader) {
-	volumeReader := &VolumeReader{
-		reader: reader,
-		player: p,
+// stopDecoderLocked stops the decoder and the audio output, dropping buffered audio. p.mu must be held.
+func (p *FFmpegPlayer) stopDecoderLocked() {
+	if p.feedCancel != nil {
+		p.feedCancel()
+		p.feedCancel = nil
+	}
+
+	// Stop the decoder first so that a pending read of the sink returns
+	if p.decoder != nil {
+		p.decoder.Stop()
+		p.decoder = nil
+		p.decoderIn = nil
+	}
+
+	if p.output != nil {
+		p.output.Close()
+		p.output = nil
 	}
+	p.volumeReader = nil
+}
 
-	p.otoPlayer = p.otoContext.NewPlayer(volumeReader)
-	p.otoPlayer.Play()
+// restartDecoderLocked restarts decoding from stream time at of the time-shift buffer. p.mu must be held.
+func (p *FFmpegPlayer) restartDecoderLocked(at time.Duration) error {
+	p.stopDecoderLocked()
+	return p.startDecoderLocked(at)
+}
+
+// feedDecoder writes the time-shift buffer to the decoder from sequence number seq on
+func (p *FFmpegPlayer) feedDecoder(ctx context.Context, w io.Writer, buf *timeshiftBuffer, seq int64) {
+	for {
+		frames, next, err := buf.read(ctx, seq)
+		if err != nil {
+			return
+		}
+		for _, frame := range frames {
+			// Blocks while the audio output is paused
+			if _, err := w.Write(frame); err != nil {
+				return
+			}
+		}
+		seq = next
+	}
+}
 
-	<-p.ctx.Done()
+// playheadLocked returns the stream time being played from the time-shift buffer. p.mu must be held.
+func (p *FFmpegPlayer) playheadLocked() time.Duration {
+	return p.shiftStart + time.Duration(p.pcmBytes.Load())*time.Second/pcmBytesPerSecond
 }
 
-// VolumeReader wraps io.Reader and applies volume control
+// pcmFrameSize is the size of one stereo s16le frame
+const pcmFrameSize = 4
+
+// VolumeReader wraps io.Reader and runs the PCM through the processing chain
+// (normalization, EQ, volume, limiter)
 type VolumeReader struct {
-	reader io.Reader
-	player *FFmpegPlayer
+	reader  io.Reader
+	player  *FFmpegPlayer
+	chain   atomic.Pointer[dspChain] // Replaced by SetDSPOptions while playing
+	partial []byte                   // Start of a frame split across reads
+	deadAir *deadAirDetector         // Watches the decoded audio for silence and loops
 }
 
 func (vr *VolumeReader) Read(p []byte) (n int, err error) {
-	n, err = vr.reader.Read(p)
+	if len(p) < pcmFrameSize {
+		return 0, io.ErrShortBuffer
+	}
+
+	// Only whole frames are processed; the rest of a read is kept for the next one
+	for n == 0 && err == nil {
+		n = copy(p, vr.partial)
+		var m int
+		m, err = vr.reader.Read(p[n:])
+		n += m
+		whole := n - n%pcmFrameSize
+		vr.partial = append(vr.partial[:0], p[whole:n]...)
+		n = whole
+	}
 	if n > 0 {
-		vr.player.mu.Lock()
-		vr.player.lastDataTime = time.Now()
-		vr.player.mu.Unlock()
+		vr.player.lastDataTime.Store(time.Now().UnixNano())
+		vr.player.pcmBytes.Add(int64(n))
+
+		vr.deadAir.process(p[:n])
+		gain := config.VolumeGain(vr.player.getEffectiveVolume()) * vr.player.sleepGain(time.Now())
+		vr.chain.Load().process(p[:n], gain)
+	}
+	return n, err
+}
 
-		volume := vr.player.getEffectiveVolume()
+// SetDSPOptions sets the processing of the PCM. It applies at once, with the
+// station's EQ preset and loudness.
+func (p *FFmpegPlayer) SetDSPOptions(opts DSPOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dspOptions = opts
+	if p.volumeReader != nil {
+		p.volumeReader.chain.Store(p.newDSPChainLocked())
+	}
+}
+
+// GetDSPOptions returns the processing of the PCM
+func (p *FFmpegPlayer) GetDSPOptions() DSPOptions {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dspOptions
+}
+
+// newDSPChainLocked builds the processing chain for the stream being played. p.mu must be held.
+func (p *FFmpegPlayer) newDSPChainLocked() *dspChain {
+	c := newDSPChain(p.dspOptions, stationIDFromURL(p.streamURL), &p.loudness)
+	c.meter = &p.meter
+	return c
+}
+
+// GetLevels returns the latest audio levels and spectrum of the stream played.
+// Levels.Updated stops advancing while no audio arrives (paused, stalled or stopped).
+func (p *FFmpegPlayer) GetLevels() Levels {
+	return p.meter.get()
+}
+
+// sinceLastData returns how long the audio output has received no PCM
+func (p *FFmpegPlayer) sinceLastData() time.Duration {
+	return time.Since(time.Unix(0, p.lastDataTime.Load()))
+}
 
-		for i := 0; i < n-1; i += 2 {
-			sample := int16(p[i]) | int16(p[i+1])<<8
-			sample = int16(float64(sample) * volume)
-			p[i] = byte(sample)
-			p[i+1] = byte(sample >> 8)
+// deliver fans a chunk of the compressed stream out to the decoder (through the
+// time-shift buffer during live playback) and the recording
+func (p *FFmpegPlayer) deliver(src *upstream, data []byte) {
+	now := time.Now()
+
+	p.mu.Lock()
+	var decoderIn io.Writer
+	if src == p.source {
+		p.lastSourceData = now
+		if p.reconnectAttempt > 0 {
+			p.recoveredLocked()
+		}
+		if p.shift != nil {
+			// Buffered under the lock, so that a recording started from the buffer
+			// continues exactly with the next chunk
+			p.shift.write(data)
+		} else if p.decoderIn != nil {
+			decoderIn = p.decoderIn
 		}
 	}
-	return n, err
+	var sink *recordProcess
+	var record []byte
+	var recordFrames []adts.Frame
+	if p.recording && ((p.recordAttached && src == p.source) || (!p.recordAttached && src == p.recordSource)) {
+		sink = p.recordProc
+		p.noteRecordDataLocked(now)
+		// Only whole frames are dropped when the recording falls behind
+		record, recordFrames = p.recordSplitter.Split(data)
+	}
+	p.mu.Unlock()
+
+	// Write without holding the lock: the decoder may wait for the audio output
+	if len(record) > 0 && !sink.write(record) {
+		var dropped time.Duration
+		for _, frame := range recordFrames {
+			dropped += frame.Duration
+		}
+		p.mu.Lock()
+		p.noteRecordDropLocked(sink, now, dropped)
+		p.mu.Unlock()
+	}
+	if decoderIn != nil {
+		decoderIn.Write(data)
+	}
 }
 
+// Stop stops playback. A recording of the stream keeps its own connection.
 func (p *FFmpegPlayer) Stop() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.playing || p.timefree != nil || p.reconnectCancel != nil {
+		p.events.emit(Event{Type: EventStopped, StreamURL: p.streamURL})
+	}
+	p.cancelReconnectLocked()
+	p.reconnectAttempt = 0
+	p.resetDeadAirLocked()
+	p.stopProgramWatchLocked()
+	p.detachRecordingLocked()
+	p.timefree = nil
+	p.shift = nil
+	p.stopLocked()
+	p.cancelSleepLocked()
+}
+
+// stopLocked stops ffmpeg and the audio output. p.mu must be held.
+// A recording attached to playback keeps waiting for the next upstream (reconnect, seek).
+func (p *FFmpegPlayer) stopLocked() {
 	if !p.playing {
 		return
 	}
 
 	p.cancel()
 
-	if p.otoPlayer != nil {
-		p.otoPlayer.Close()
-		p.otoPlayer = nil
+	if p.source != nil {
+		p.source.stop()
+		p.source = nil
 	}
 
-	if p.cmd != nil && p.cmd.Process != nil {
-		p.cmd.Process.Kill()
-		p.cmd.Wait()
-	}
+	p.stopDecoderLocked()
 
 	p.playing = false
 	p.ctx, p.cancel = context.WithCancel(context.Background())
@@ -252,17 +557,13 @@ func (p *FFmpegPlayer) IsPlaying() bool {
 	return p.playing
 }
 
+// SetVolume sets the volume position, 0 to config.MaxVolume on the perceptual scale
+// of config.VolumeGain (1 = unchanged, above boosts)
 func (p *FFmpegPlayer) SetVolume(volume float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if volume < 0 {
-		volume = 0
-	} else if volume > 1 {
-		volume = 1
-	}
-
-	p.volume = volume
+	p.volume = config.ClampVolume(volume)
 	if p.muted {
 		p.muted = false
 	}
@@ -278,10 +579,7 @@ func (p *FFmpegPlayer) IncreaseVolume(delta float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.volume += delta
-	if p.volume > 1 {
-		p.volume = 1
-	}
+	p.volume = config.ClampVolume(p.volume + delta)
 	if p.muted {
 		p.muted = false
 	}
@@ -291,10 +589,7 @@ func (p *FFmpegPlayer) DecreaseVolume(delta float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.volume -= delta
-	if p.volume < 0 {
-		p.volume = 0
-	}
+	p.volume = config.ClampVolume(p.volume - delta)
 	if p.muted {
 		p.muted = false
 	}
@@ -326,22 +621,46 @@ func (p *FFmpegPlayer) getEffectiveVolume() float64 {
 }
 
 // monitorPlayback monitors playback status (silent version, no terminal output)
-func (p *FFmpegPlayer) monitorPlayback() {
+func (p *FFmpegPlayer) monitorPlayback(ctx context.Context) {
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-p.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			p.mu.Lock()
 			if p.playing {
-				if time.Since(p.lastDataTime) > 5*time.Second {
-					p.reconnectStatus = ReconnectStarted
+				if p.timefree != nil && p.timefreeEndedLocked() {
+					// End of the past broadcast, not a stall
+					p.stopLocked()
+					p.timefree.offset = p.timefree.end.Sub(p.timefree.start)
+					p.timefree.finished = true
+					p.events.emit(Event{Type: EventStopped, StreamURL: p.timefree.playlistURL})
+					if p.recording && p.recordAttached {
+						// The past broadcast was recorded to its end
+						go p.StopRecording()
+					}
+					p.mu.Unlock()
+					return
+				}
+				cause := p.playbackFailureLocked()
+				if cause == nil {
+					cause = p.checkDeadAirLocked()
+				}
+				if cause != nil {
+					p.events.emit(Event{Type: EventStalled, StreamURL: p.streamURL, Err: classifyError(cause)})
+					p.scheduleReconnectLocked(cause)
 					p.mu.Unlock()
-					p.Reconnect()
-					continue
+					return
+				}
+				if p.shift != nil && !p.shiftPaused && p.sinceLastData() > 5*time.Second {
+					// The decoder stopped although the buffer holds audio ahead of it
+					playhead := p.playheadLocked()
+					if _, end := p.shift.bounds(); end-playhead > 5*time.Second {
+						p.restartDecoderLocked(playhead)
+					}
 				}
 			}
 			p.mu.Unlock()
@@ -349,69 +668,511 @@ func (p *FFmpegPlayer) monitorPlayback() {
 	}
 }
 
-// Reconnect attempts to reconnect (silent version)
+// playbackFailureLocked returns why playback needs reconnecting, or nil. p.mu must be held.
+func (p *FFmpegPlayer) playbackFailureLocked() error {
+	if p.source != nil && p.source.exited() {
+		if err := p.source.err(); err != nil {
+			return err
+		}
+		// A past broadcast ends with its playlist, which timefreeEndedLocked detects
+		if p.timefree == nil {
+			return errSourceExited
+		}
+	}
+	if p.shift != nil {
+		// The buffer keeps filling while playback is paused or behind live,
+		// so only the upstream is checked
+		if time.Since(p.lastSourceData) > liveStallTimeout {
+			return errStalled
+		}
+	} else if p.sinceLastData() > 5*time.Second {
+		return errStalled
+	}
+	return nil
+}
+
+// Reconnect reconnects right away with a new auth token. If that fails, further
+// attempts follow the reconnect policy.
 func (p *FFmpegPlayer) Reconnect() error {
 	p.mu.Lock()
+	p.stopForReconnectLocked()
+	p.reconnectAttempt++
 	p.reconnectStatus = ReconnectStarted
-	volume := p.volume
-	muted := p.muted
-	streamURL := p.streamURL
-	onReconnect := p.onReconnect
+	p.events.emit(Event{
+		Type:        EventReconnecting,
+		StreamURL:   p.streamURL,
+		Attempt:     p.reconnectAttempt,
+		MaxAttempts: p.reconnectPolicy.MaxAttempts,
+		NextRetry:   time.Now(),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	p.reconnectCancel = cancel
 	p.mu.Unlock()
 
-	p.Stop()
-	time.Sleep(500 * time.Millisecond)
+	return p.reconnectAttemptNow(ctx)
+}
 
-	var newAuthToken string
-	if onReconnect != nil {
-		p.mu.Lock()
-		p.reconnectStatus = ReconnectAuth
-		p.mu.Unlock()
+// stopForReconnectLocked stops playback, keeping what is needed to resume it:
+// the time-shift buffer, the timefree position and an attached recording. p.mu must be held.
+func (p *FFmpegPlayer) stopForReconnectLocked() {
+	p.cancelReconnectLocked()
+	if p.timefree != nil && p.playing {
+		p.timefree.offset = p.timefreePositionLocked()
+	}
+	p.stopLocked()
+}
 
-		newAuthToken = onReconnect()
-		if newAuthToken == "" {
-			p.mu.Lock()
-			p.reconnectStatus = ReconnectFailed
-			p.lastError = "認証の取得に失敗しました"
-			p.mu.Unlock()
-			return fmt.Errorf("failed to get new auth token")
+// cancelReconnectLocked cancels a scheduled reconnect attempt. p.mu must be held.
+func (p *FFmpegPlayer) cancelReconnectLocked() {
+	if p.reconnectCancel != nil {
+		p.reconnectCancel()
+		p.reconnectCancel = nil
+	}
+}
+
+// scheduleReconnectLocked stops the failed playback and schedules the next attempt
+// after the backoff of the reconnect policy. p.mu must be held.
+func (p *FFmpegPlayer) scheduleReconnectLocked(cause error) {
+	p.stopForReconnectLocked()
+
+	perr := classifyError(cause)
+	policy := p.reconnectPolicy
+	attempt := p.reconnectAttempt + 1
+	wait := policy.backoff(attempt)
+
+	// A station outside the area stays unavailable even with a new token
+	giveUp := !perr.Kind.Retryable() && p.reconnectAttempt > 0
+	if giveUp || (policy.MaxAttempts > 0 && attempt > policy.MaxAttempts) {
+		p.reconnectStatus = ReconnectFailed
+		p.lastError = perr.Error()
+		if giveUp || policy.Cooldown <= 0 {
+			p.events.emit(Event{Type: EventFailed, StreamURL: p.streamURL, Attempt: p.reconnectAttempt, Err: perr})
+			p.reconnectAttempt = 0
+			return
 		}
+		// Give up for a while, then start over
+		attempt, wait = 1, policy.Cooldown
+		p.events.emit(Event{Type: EventFailed, StreamURL: p.streamURL, Attempt: p.reconnectAttempt, Err: perr, NextRetry: time.Now().Add(wait)})
 	} else {
-		newAuthToken = p.authToken
+		p.reconnectStatus = ReconnectStarted
 	}
 
+	p.reconnectAttempt = attempt
+	p.events.emit(Event{
+		Type:        EventReconnecting,
+		StreamURL:   p.streamURL,
+		Attempt:     attempt,
+		MaxAttempts: policy.MaxAttempts,
+		NextRetry:   time.Now().Add(wait),
+		Err:         perr,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.reconnectCancel = cancel
+	go func() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		p.reconnectAttemptNow(ctx)
+	}()
+}
+
+// reconnectAttemptNow checks the network, gets a new auth token and restarts playback.
+// Playback counts as recovered once audio arrives; until then a failure of the new
+// connection schedules the next attempt. ctx is cancelled when playback was started
+// or stopped meanwhile.
+func (p *FFmpegPlayer) reconnectAttemptNow(ctx context.Context) error {
 	p.mu.Lock()
-	p.ctx, p.cancel = context.WithCancel(context.Background())
-	p.authToken = newAuthToken
-	p.volume = volume
-	p.muted = muted
-	p.reconnectStatus = ReconnectPlaying
+	onReconnect := p.onReconnect
+	checkNetwork := p.reconnectPolicy.CheckNetwork
 	p.mu.Unlock()
 
-	err := p.Play(streamURL)
-	if err != nil {
+	// Slow calls are made without the lock
+	var err error
+	if checkNetwork != nil {
+		err = checkNetwork()
+	}
+	var newAuthToken string
+	if err == nil && onReconnect != nil {
 		p.mu.Lock()
-		p.reconnectStatus = ReconnectFailed
-		p.lastError = err.Error()
+		p.reconnectStatus = ReconnectAuth
 		p.mu.Unlock()
-		return fmt.Errorf("failed to restart playback: %w", err)
+
+		if newAuthToken = onReconnect(); newAuthToken == "" {
+			err = errAuthFailed
+		}
 	}
 
 	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	p.reconnectCancel = nil
+	if err != nil {
+		p.scheduleReconnectLocked(err)
+		return classifyError(err)
+	}
+	if onReconnect != nil {
+		p.authToken = newAuthToken
+		p.events.emit(Event{Type: EventAuthRefreshed, StreamURL: p.streamURL, Attempt: p.reconnectAttempt})
+	}
+
+	// Keep the recording attached: it continues on the new connection
+	p.reconnectStatus = ReconnectPlaying
+	if p.timefree != nil {
+		err = p.startTimefreeLocked(p.timefree.offset)
+	} else {
+		err = p.playLocked(p.streamURL)
+	}
+	if err != nil {
+		p.scheduleReconnectLocked(err)
+		return classifyError(err)
+	}
+	return nil
+}
+
+// recoveredLocked ends reconnecting once the new connection delivers audio. p.mu must be held.
+func (p *FFmpegPlayer) recoveredLocked() {
 	p.reconnectStatus = ReconnectSuccess
-	p.mu.Unlock()
+	p.events.emit(Event{Type: EventRecovered, StreamURL: p.streamURL, Attempt: p.reconnectAttempt})
+	p.reconnectAttempt = 0
+}
+
+// PlayTimefree starts playback of a past broadcast from its beginning.
+// playlistURL is built by api.GetTimefreeURL, ft and to are the program's time range.
+func (p *FFmpegPlayer) PlayTimefree(playlistURL string, ft, to time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
+	if p.playing {
+		return fmt.Errorf("already playing")
+	}
+	if !to.After(ft) {
+		return fmt.Errorf("invalid timefree range: %s - %s", ft, to)
+	}
+
+	p.cancelReconnectLocked()
+	p.stopProgramWatchLocked()
+	p.detachRecordingLocked()
+	p.timefree = &timefreeSession{
+		playlistURL: playlistURL,
+		start:       ft,
+		end:         to,
+	}
+	if err := p.startTimefreeLocked(0); err != nil {
+		return err
+	}
+	p.reconnectAttempt = 0
+	p.resetDeadAirLocked()
+	p.events.emit(Event{Type: EventStarted, StreamURL: playlistURL})
 	return nil
 }
 
-// getDownloadsDir returns the user's Downloads directory
-func getDownloadsDir() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, "Downloads")
+// startTimefreeLocked starts ffmpeg at position from the program start. p.mu must be held.
+func (p *FFmpegPlayer) startTimefreeLocked(position time.Duration) error {
+	tf := p.timefree
+	tf.offset = position
+	tf.paused = false
+	tf.finished = false
+	return p.startLocked(timefreeSeekURL(tf.playlistURL, tf.start.Add(position)))
+}
+
+// timefreeSeekURL appends the seek parameter to a timefree playlist URL
+func timefreeSeekURL(playlistURL string, seek time.Time) string {
+	sep := "&"
+	if !strings.Contains(playlistURL, "?") {
+		sep = "?"
+	}
+	return playlistURL + sep + "seek=" + seek.In(model.JST).Format(model.RadikoTimeLayout)
+}
+
+// timefreePositionLocked returns the current timefree position. p.mu must be held.
+func (p *FFmpegPlayer) timefreePositionLocked() time.Duration {
+	tf := p.timefree
+	position := tf.offset
+	if p.playing && !tf.paused {
+		position += time.Duration(p.pcmBytes.Load()) * time.Second / pcmBytesPerSecond
+	}
+	if total := tf.end.Sub(tf.start); position > total {
+		position = total
+	}
+	return position
+}
+
+// timefreeEndedLocked reports whether timefree playback reached the program end. p.mu must be held.
+func (p *FFmpegPlayer) timefreeEndedLocked() bool {
+	remaining := p.timefree.end.Sub(p.timefree.start) - p.timefreePositionLocked()
+	if remaining <= 0 {
+		return true
+	}
+	// ffmpeg stops sending data a little before the end of the playlist
+	return remaining < 10*time.Second && p.sinceLastData() > 3*time.Second
+}
+
+// Seek moves timefree playback to position from the program start
+func (p *FFmpegPlayer) Seek(position time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seekLocked(position)
+}
+
+// SeekRelative moves playback forward (positive delta) or backward (negative delta).
+// During live playback it moves within the time-shift buffer.
+func (p *FFmpegPlayer) SeekRelative(delta time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timefree == nil {
+		if p.shift == nil || !p.playing {
+			return fmt.Errorf("タイムシフトが無効です")
+		}
+		p.leaveLiveLocked()
+		return p.seekLiveLocked(p.playheadLocked() + delta)
+	}
+	return p.seekLocked(p.timefreePositionLocked() + delta)
+}
+
+// leaveLiveLocked stops following the live edge, remembering its distance. p.mu must be held.
+func (p *FFmpegPlayer) leaveLiveLocked() {
+	if !p.shiftLive {
+		return
+	}
+	_, end := p.shift.bounds()
+	p.shiftLag = end - p.playheadLocked()
+	if p.shiftLag < 0 {
+		p.shiftLag = 0
+	}
+	p.shiftLive = false
+}
+
+// seekLiveLocked restarts live playback at stream time t of the time-shift buffer.
+// Seeking up to the live edge returns to live. p.mu must be held.
+func (p *FFmpegPlayer) seekLiveLocked(t time.Duration) error {
+	start, end := p.shift.bounds()
+	if t >= end-p.shiftLag {
+		return p.goLiveLocked()
+	}
+	if t < start {
+		t = start
+	}
+	return p.restartDecoderLocked(t)
+}
+
+// GoLive returns time-shifted (or paused) live playback to the live edge
+func (p *FFmpegPlayer) GoLive() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timefree != nil || p.shift == nil || !p.playing {
+		return fmt.Errorf("タイムシフトが無効です")
+	}
+	return p.goLiveLocked()
+}
+
+// goLiveLocked restarts playback at the live edge. p.mu must be held.
+func (p *FFmpegPlayer) goLiveLocked() error {
+	if p.shiftLive && !p.shiftPaused {
+		return nil
+	}
+	_, end := p.shift.bounds()
+	p.shiftLive = true
+	p.shiftPaused = false
+	return p.restartDecoderLocked(end - p.shiftLag)
+}
+
+// GetTimeshift returns how far live playback is behind the live edge and how far it can
+// be rewound. live is true while following the live edge.
+func (p *FFmpegPlayer) GetTimeshift() (behind, rewindable time.Duration, live bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.timeshiftLocked()
+}
+
+// behindLiveLocked returns how far playback is behind the live stream. p.mu must be held.
+func (p *FFmpegPlayer) behindLiveLocked() time.Duration {
+	behind, _, _ := p.timeshiftLocked()
+	return behind
+}
+
+// timeshiftLocked is GetTimeshift with p.mu held
+func (p *FFmpegPlayer) timeshiftLocked() (behind, rewindable time.Duration, live bool) {
+	if p.timefree != nil || p.shift == nil {
+		return 0, 0, true
+	}
+	if p.shiftLive && !p.shiftPaused {
+		start, _ := p.shift.bounds()
+		return 0, max(p.playheadLocked()-start, 0), true
+	}
+	start, end := p.shift.bounds()
+	playhead := p.playheadLocked()
+	return max(end-playhead-p.shiftLag, 0), max(playhead-start, 0), false
+}
+
+// seekLocked restarts timefree playback at position. p.mu must be held.
+func (p *FFmpegPlayer) seekLocked(position time.Duration) error {
+	tf := p.timefree
+	if tf == nil {
+		return fmt.Errorf("タイムフリー再生中ではありません")
+	}
+
+	total := tf.end.Sub(tf.start)
+	if position < 0 {
+		position = 0
+	} else if position > total-time.Second {
+		position = total - time.Second
+	}
+
+	if tf.paused {
+		tf.offset = position
+		return nil
+	}
+
+	p.stopLocked()
+	return p.startTimefreeLocked(position)
+}
+
+// Pause pauses playback, keeping the current position.
+// Live playback keeps filling the time-shift buffer while paused.
+func (p *FFmpegPlayer) Pause() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tf := p.timefree
+	if tf == nil {
+		if p.shift == nil || !p.playing {
+			return fmt.Errorf("ライブ放送は一時停止できません")
+		}
+		if p.shiftPaused {
+			return nil
+		}
+		p.leaveLiveLocked()
+		p.shiftPaused = true
+		if p.output != nil {
+			p.output.Pause()
+		}
+		return nil
+	}
+	if tf.paused || !p.playing {
+		return nil
+	}
+
+	position := p.timefreePositionLocked()
+	p.stopLocked()
+	tf.offset = position
+	tf.paused = true
+	return nil
+}
+
+// Resume resumes paused playback (or restarts timefree playback if it finished)
+func (p *FFmpegPlayer) Resume() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tf := p.timefree
+	if tf == nil {
+		if p.shift == nil || !p.playing {
+			return fmt.Errorf("タイムフリー再生中ではありません")
+		}
+		if !p.shiftPaused {
+			return nil
+		}
+		p.shiftPaused = false
+		playhead := p.playheadLocked()
+		if start, _ := p.shift.bounds(); playhead < start {
+			// The paused position fell out of the buffer
+			return p.restartDecoderLocked(start)
+		}
+		if p.output != nil {
+			p.output.Play()
+		}
+		return nil
+	}
+	if p.playing {
+		return nil
+	}
+
+	position := tf.offset
+	if tf.finished {
+		position = 0
+	}
+	return p.startTimefreeLocked(position)
+}
+
+// TogglePause toggles pause of timefree or time-shifted live playback
+func (p *FFmpegPlayer) TogglePause() (paused bool, err error) {
+	if p.IsPaused() || (p.IsTimefree() && !p.IsPlaying()) {
+		return false, p.Resume()
+	}
+	err = p.Pause()
+	return err == nil, err
+}
+
+// IsTimefree returns whether a past broadcast is loaded (playing, paused or finished)
+func (p *FFmpegPlayer) IsTimefree() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.timefree != nil
+}
+
+// IsPaused returns whether timefree or live playback is paused
+func (p *FFmpegPlayer) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timefree != nil {
+		return p.timefree.paused
+	}
+	return p.shift != nil && p.shiftPaused
+}
+
+// GetTimefreePosition returns the position and total length of timefree playback
+func (p *FFmpegPlayer) GetTimefreePosition() (position, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timefree == nil {
+		return 0, 0
+	}
+	return p.timefreePositionLocked(), p.timefree.end.Sub(p.timefree.start)
+}
+
+const (
+	// recordStallTimeout is how long the recording may receive no audio before it is resumed
+	recordStallTimeout = 15 * time.Second
+	// recordRetryInterval is the wait between attempts to resume a stalled recording
+	recordRetryInterval = 5 * time.Second
+	// recordGapThreshold is the pause in the stream above which missing audio is reported.
+	// HLS delivers audio in segments of a few seconds, so shorter pauses are normal.
+	recordGapThreshold = 10 * time.Second
+)
+
+// SetProgramLookup sets the function used to follow the program on air during live
+// playback and to find the next program when splitting recordings. It applies from
+// the next Play.
+func (p *FFmpegPlayer) SetProgramLookup(lookup ProgramLookup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.programLookup = lookup
 }
 
 // StartRecording starts recording the current stream to a file
 func (p *FFmpegPlayer) StartRecording(stationName string) error {
+	return p.StartRecordingWithOptions(stationName, RecordingOptions{})
+}
+
+// StartRecordingWithOptions starts recording the current stream, naming and
+// splitting files according to opts. The recording shares the playback's
+// connection; if playback stops or switches stations, it continues on its own
+// connection, which is re-established with a fresh token after a stall.
+func (p *FFmpegPlayer) StartRecordingWithOptions(stationName string, opts RecordingOptions) error {
+	// Fetch the cover art before locking, it may take a moment
+	cover := recordingCover(opts.Output, opts.Program)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -423,79 +1184,534 @@ func (p *FFmpegPlayer) StartRecording(stationName string) error {
 		return fmt.Errorf("既に録音中です")
 	}
 
-	// Create filename with timestamp
-	now := time.Now()
-	timestamp := now.Format("20060102_150405")
-	safeName := stationName
-	// Remove invalid characters for filename
-	for _, char := range []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|", " "} {
-		safeName = strings.ReplaceAll(safeName, char, "_")
+	if opts.Prepend > 0 && (p.timefree != nil || p.shift == nil) {
+		return fmt.Errorf("タイムシフトが無効なため遡って録音できません")
 	}
-	filename := fmt.Sprintf("radiko_%s_%s.aac", safeName, timestamp)
-	downloadDir := getDownloadsDir()
+
+	downloadDir := config.DownloadsDir()
 
 	// Ensure downloads directory exists
 	if err := os.MkdirAll(downloadDir, 0755); err != nil {
 		return fmt.Errorf("ダウンロードフォルダの作成に失敗しました: %w", err)
 	}
 
-	p.recordFilePath = filepath.Join(downloadDir, filename)
+	// Audio from the time-shift buffer, written before the live stream
+	var prepend []byte
+	var prepended time.Duration
+	if opts.Prepend > 0 {
+		prepend, prepended = p.shift.tail(p.playheadLocked() - opts.Prepend)
+	}
+
+	now := time.Now().Add(-prepended)
 	p.recordStation = stationName
 	p.recordStartTime = now
+	p.recordStreamURL = p.streamURL
+	p.recordAuthToken = p.authToken
+	if p.source != nil {
+		p.recordAuthToken = p.source.authToken
+	}
+	p.recordAttached = true
+	p.recordSource = nil
+	p.recordTimefree = p.timefree != nil
+	p.recordLastData = time.Time{}
+	p.recordSplitter = adts.Splitter{}
+	p.recordOptions = opts
+	p.recordProgram = opts.Program
+	p.recordCover = cover
+	p.recordPart = 1
+	p.recordFiles = nil
+
+	filePath := filepath.Join(downloadDir, p.recordingFileNameLocked(now))
+	if err := p.startRecordFileLocked(filePath); err != nil {
+		return err
+	}
+	if len(prepend) > 0 {
+		frames, _ := p.recordSplitter.Split(prepend)
+		p.recordProc.write(frames)
+		p.recordFileStart = now
+	}
+
+	p.recording = true
+	p.events.emit(Event{Type: EventRecordingStarted, Path: filePath})
+
+	var ctx context.Context
+	ctx, p.recordSessionCancel = context.WithCancel(context.Background())
+	go p.superviseRecording(ctx)
+	return nil
+}
+
+// SaveClip saves the last d of audio before the playhead, taken from the time-shift
+// buffer, to its own file in the downloads directory. It returns the file path.
+func (p *FFmpegPlayer) SaveClip(stationName string, d time.Duration, opts RecordingOptions) (string, error) {
+	// Fetch the cover art before locking, it may take a moment
+	cover := recordingCover(opts.Output, opts.Program)
+
+	p.mu.Lock()
+	if p.timefree != nil || p.shift == nil || !p.playing {
+		p.mu.Unlock()
+		return "", fmt.Errorf("タイムシフトが無効なため遡って録音できません")
+	}
+	playhead := p.playheadLocked()
+	data, start, _ := p.shift.extract(playhead-d, playhead)
+	_, end := p.shift.bounds()
+	p.mu.Unlock()
 
-	// Create context for recording
-	p.recordCtx, p.recordCancel = context.WithCancel(context.Background())
+	if len(data) == 0 {
+		return "", fmt.Errorf("保存できる音声がありません")
+	}
 
-	// Start ffmpeg for recording
-	p.recordCmd = exec.CommandContext(p.recordCtx, "ffmpeg",
-		"-headers", fmt.Sprintf("X-Radiko-AuthToken: %s", p.authToken),
-		"-i", p.streamURL,
-		"-c:a", "aac",
-		"-b:a", "128k",
-		"-y",
+	downloadDir := config.DownloadsDir()
+	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+		return "", fmt.Errorf("ダウンロードフォルダの作成に失敗しました: %w", err)
+	}
+
+	// Name the clip after the time it was on air
+	startedAt := time.Now().Add(-(end - start))
+	filename := fmt.Sprintf("radiko_%s_%s_clip%s",
+		recorder.SanitizeFileName(stationName), startedAt.Format("20060102_150405"), opts.Output.Format.Extension())
+	filePath := filepath.Join(downloadDir, filename)
+
+	args := []string{
 		"-loglevel", "error",
-		p.recordFilePath,
-	)
+		"-f", "aac",
+		"-i", "pipe:0",
+	}
+	args = append(args, recorder.CoverInputArgs(opts.Output, cover)...)
+	args = append(args, recorder.OutputArgs(opts.Output, recorder.MetadataFromProgram(opts.Program, stationName), cover, filePath)...)
 
-	err := p.recordCmd.Start()
+	cmd := p.pipeline.Encoder.Command(args)
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("クリップの保存に失敗しました: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return filePath, nil
+}
+
+// detachRecordingLocked hands the playback connection over to the recording, so that
+// the recording continues when playback stops or switches streams. p.mu must be held.
+func (p *FFmpegPlayer) detachRecordingLocked() {
+	if !p.recording || !p.recordAttached {
+		return
+	}
+	p.recordAttached = false
+	p.recordSource = p.source
+	if p.source != nil {
+		p.recordAuthToken = p.source.authToken
+	}
+	p.source = nil
+}
+
+// noteRecordDataLocked records the arrival of audio for the recording and reports
+// the missing span if the stream paused for too long. p.mu must be held.
+func (p *FFmpegPlayer) noteRecordDataLocked(now time.Time) {
+	last := p.recordLastData
+	stalled := p.recordStalled
+	p.recordLastData = now
+	p.recordStalled = false
+
+	// A paused past broadcast is not missing audio
+	var gap recorder.Gap
+	if !last.IsZero() && !p.recordTimefree && now.Sub(last) >= recordGapThreshold {
+		gap = p.addRecordGapLocked(last, now, false)
+	}
+	if stalled {
+		p.events.emit(Event{Type: EventRecordingResumed, Path: p.recordFilePath, Gap: gap})
+	}
+}
+
+// noteRecordDropLocked notes audio the recording ffmpeg of proc could not take in time
+// as missing from the current file. Drops in a row extend one gap, reported once.
+// p.mu must be held.
+func (p *FFmpegPlayer) noteRecordDropLocked(proc *recordProcess, now time.Time, dropped time.Duration) {
+	if !p.recording || p.recordProc != proc || dropped <= 0 {
+		return
+	}
+	last := p.recordLastDrop
+	p.recordLastDrop = now
+	if p.recordDropGap > 0 && now.Sub(last) < recordGapThreshold {
+		p.recordGaps[p.recordDropGap-1].Duration += dropped
+		return
+	}
+	gap := p.addRecordGapLocked(now, now.Add(dropped), false)
+	p.recordDropGap = len(p.recordGaps)
+	p.events.emit(Event{Type: EventRecordingDropped, Path: p.recordFilePath, Gap: gap})
+}
+
+// addRecordGapLocked adds the span from lostAt to resumedAt to the gaps of the current file.
+// With deadAir the audio is in the file but silent or looping; otherwise it is missing.
+// The offset does not count earlier missing gaps, as that audio is not in the file.
+// p.mu must be held.
+func (p *FFmpegPlayer) addRecordGapLocked(lostAt, resumedAt time.Time, deadAir bool) recorder.Gap {
+	if lostAt.Before(p.recordFileStart) {
+		lostAt = p.recordFileStart
+	}
+	var missing time.Duration
+	for _, gap := range p.recordGaps {
+		if !gap.DeadAir {
+			missing += gap.Duration
+		}
+	}
+	gap := recorder.Gap{
+		Offset:   lostAt.Sub(p.recordFileStart) - missing,
+		Duration: resumedAt.Sub(lostAt),
+		DeadAir:  deadAir,
+	}
+	p.recordGaps = append(p.recordGaps, gap)
+	return gap
+}
+
+// recordingFileNameLocked builds the file name of the next recording file. p.mu must be held.
+func (p *FFmpegPlayer) recordingFileNameLocked(now time.Time) string {
+	var filename string
+	if p.recordOptions.ProgramAware && p.recordProgram != nil {
+		prog := p.recordProgram
+		filename = fmt.Sprintf("radiko_%s_%s_%s",
+			recorder.SanitizeFileName(p.recordStation),
+			recorder.SanitizeFileName(prog.Title),
+			prog.Start.In(model.JST).Format("20060102_1504"))
+	} else {
+		filename = fmt.Sprintf("radiko_%s_%s", recorder.SanitizeFileName(p.recordStation), now.Format("20060102_150405"))
+	}
+	if p.recordPart > 1 {
+		filename += fmt.Sprintf("_part%d", p.recordPart)
+	}
+	return filename + p.recordOptions.Output.Format.Extension()
+}
+
+// recordMetadataLocked returns the tags of the current file. p.mu must be held.
+func (p *FFmpegPlayer) recordMetadataLocked(gaps []recorder.Gap) recorder.Metadata {
+	meta := recorder.MetadataFromProgram(p.recordProgram, p.recordStation)
+	meta.Gaps = gaps
+	return meta
+}
+
+// startRecordSegmentLocked starts an ffmpeg process writing the upstream's audio to
+// segmentPath. p.mu must be held.
+func (p *FFmpegPlayer) startRecordSegmentLocked(segmentPath string) (*recordProcess, error) {
+	out := p.recordOptions.Output
+
+	args := []string{
+		"-loglevel", "error",
+		"-f", "aac",
+		"-i", "pipe:0",
+	}
+	args = append(args, recorder.CoverInputArgs(out, p.recordCover)...)
+	args = append(args, recorder.OutputArgs(out, p.recordMetadataLocked(nil), p.recordCover, segmentPath)...)
+
+	proc, err := startRecordProcess(p.pipeline.Encoder.Command(args), segmentPath)
 	if err != nil {
-		p.recordCancel()
-		return fmt.Errorf("録音の開始に失敗しました: %w", err)
+		return nil, fmt.Errorf("録音の開始に失敗しました: %w", err)
 	}
+	return proc, nil
+}
 
-	p.recording = true
+// startRecordFileLocked starts recording into a new file. p.mu must be held.
+func (p *FFmpegPlayer) startRecordFileLocked(filePath string) error {
+	proc, err := p.startRecordSegmentLocked(filePath)
+	if err != nil {
+		return err
+	}
+
+	p.recordProc = proc
+	p.recordFilePath = filePath
+	p.recordFileStart = proc.started
+	p.recordSegments = []string{filePath}
+	p.recordGaps = nil
+	p.recordDropGap = 0
+	p.recordFiles = append(p.recordFiles, filePath)
 	return nil
 }
 
-// StopRecording stops the current recording
-func (p *FFmpegPlayer) StopRecording() (string, error) {
+// recordedFileLocked returns the current file, to be finished after a split or stop. p.mu must be held.
+func (p *FFmpegPlayer) recordedFileLocked() recordedFile {
+	return recordedFile{
+		proc:     p.recordProc,
+		path:     p.recordFilePath,
+		segments: append([]string(nil), p.recordSegments...),
+		out:      p.recordOptions.Output,
+		meta:     p.recordMetadataLocked(append([]recorder.Gap(nil), p.recordGaps...)),
+		cover:    p.recordCover,
+	}
+}
+
+// superviseRecording resumes failed recordings and splits them at program
+// boundaries and size/duration limits
+func (p *FFmpegPlayer) superviseRecording(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var lastLookup, lastRetry time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		p.mu.Lock()
+		if !p.recording {
+			p.mu.Unlock()
+			return
+		}
+		opts := p.recordOptions
+		prog := p.recordProgram
+		lookup := p.programLookup
+		fileStart := p.recordFileStart
+		segments := append([]string(nil), p.recordSegments...)
+		proc := p.recordProc
+		attached := p.recordAttached
+		source := p.recordSource
+		timefree := p.recordTimefree
+		lastData := p.recordLastData
+		if lastData.Before(fileStart) {
+			lastData = fileStart
+		}
+		stalled := now.Sub(lastData) >= recordStallTimeout
+		if stalled && !(attached && timefree) && !p.recordStalled {
+			// Shown in the footer (a paused past broadcast is not stalled)
+			p.recordStalled = true
+			p.events.emit(Event{Type: EventRecordingStalled, Path: p.recordFilePath})
+		}
+		p.mu.Unlock()
+
+		// The recording ffmpeg failed: continue in a new segment of the same file
+		if proc.exited() {
+			p.mu.Lock()
+			p.resumeRecordSegmentLocked(proc)
+			p.mu.Unlock()
+			continue
+		}
+
+		// Own connection of the recording (playback moved on)
+		if !attached {
+			sourceDown := source == nil || source.exited()
+			if timefree && sourceDown {
+				// The past broadcast was recorded to its end
+				p.StopRecording()
+				return
+			}
+			if !timefree && (sourceDown || stalled) && now.Sub(lastRetry) >= recordRetryInterval {
+				lastRetry = now
+				p.reconnectRecordSource(source)
+				continue
+			}
+		}
+
+		// Program boundary: look up the next program and start a new file for it
+		atBoundary := opts.ProgramAware && lookup != nil && (prog == nil || !now.Before(prog.End))
+		if atBoundary && now.Sub(lastLookup) >= 30*time.Second {
+			lastLookup = now
+			next, err := lookup(opts.StationID, now)
+			if err != nil || next == nil {
+				p.mu.Lock()
+				if prog != nil {
+					// Unknown next program: keep recording in a timestamped file
+					p.recordPart = 1
+					p.splitRecordingLocked(now, nil, "")
+				}
+				p.mu.Unlock()
+				continue
+			}
+			if prog == nil || next.Start.After(prog.Start) {
+				cover := recordingCover(opts.Output, next)
+				p.mu.Lock()
+				p.recordPart = 1
+				if prog != nil {
+					p.splitRecordingLocked(now, next, cover)
+				} else {
+					p.recordProgram = next
+					p.recordCover = cover
+				}
+				p.mu.Unlock()
+			}
+			continue
+		}
+
+		// Duration / size limits (the program lookup may still be pending at a boundary)
+		split := opts.MaxDuration > 0 && now.Sub(fileStart) >= opts.MaxDuration
+		if !split && opts.MaxSize > 0 {
+			var size int64
+			for _, segment := range segments {
+				if info, err := os.Stat(segment); err == nil {
+					size += info.Size()
+				}
+			}
+			split = size >= opts.MaxSize
+		}
+		if split {
+			p.mu.Lock()
+			if opts.ProgramAware && p.recordProgram != nil {
+				p.recordPart++
+			}
+			p.splitRecordingLocked(now, p.recordProgram, p.recordCover)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// resumeRecordSegmentLocked continues the current file in a new segment after the
+// recording ffmpeg exited unexpectedly. p.mu must be held.
+func (p *FFmpegPlayer) resumeRecordSegmentLocked(proc *recordProcess) {
+	if !p.recording || p.recordProc != proc {
+		return
+	}
+
+	// Reuse the current segment if nothing was recorded into it
+	segments := p.recordSegments
+	segmentPath := recorder.SegmentPath(p.recordFilePath, len(segments)+1)
+	if info, err := os.Stat(proc.path); err != nil || info.Size() == 0 {
+		segmentPath = proc.path
+		segments = segments[:len(segments)-1]
+	}
+
+	newProc, err := p.startRecordSegmentLocked(segmentPath)
+	if err != nil {
+		p.lastError = err.Error()
+		p.events.emit(Event{Type: EventRecordingFailed, Path: p.recordFilePath, Err: err})
+		return
+	}
+
+	p.addRecordGapLocked(proc.exitedAt, newProc.started, false)
+	p.recordProc = newProc
+	p.recordSegments = append(segments, segmentPath)
+}
+
+// reconnectRecordSource re-establishes the recording's own connection, refreshing the
+// auth token through the reconnect callback unless an earlier attempt already did.
+// The token stays with the recording: playback may be using another station's.
+func (p *FFmpegPlayer) reconnectRecordSource(old *upstream) {
+	p.mu.Lock()
+	authToken := p.recordAuthToken
+	onReconnect := p.onReconnect
+	p.mu.Unlock()
+
+	if old != nil && authToken == old.authToken && onReconnect != nil {
+		authToken = onReconnect()
+		if authToken == "" {
+			p.mu.Lock()
+			p.lastError = "録音の再接続: 認証の取得に失敗しました"
+			p.events.emit(Event{Type: EventRecordingFailed, Path: p.recordFilePath, Err: errors.New(p.lastError)})
+			p.mu.Unlock()
+			return
+		}
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if !p.recording || p.recordAttached || p.recordSource != old {
+		return
+	}
+	p.recordAuthToken = authToken
+
+	source, err := startUpstream(p.pipeline.Source, p.recordStreamURL, authToken, p.deliver)
+	if err != nil {
+		p.lastError = err.Error()
+		p.events.emit(Event{Type: EventRecordingFailed, Path: p.recordFilePath, Err: err})
+		return
+	}
+	if old != nil {
+		old.stop()
+	}
+	p.recordSource = source
+}
+
+// splitRecordingLocked continues the recording in a new file for prog. Both files
+// are fed from the same stream, so the split is seamless. p.mu must be held.
+func (p *FFmpegPlayer) splitRecordingLocked(now time.Time, prog *model.GuideProgram, cover string) {
+	if !p.recording {
+		return
+	}
+
+	old := p.recordedFileLocked()
+	oldProgram := p.recordProgram
+	p.recordProgram = prog
+	p.recordCover = cover
+	filePath := filepath.Join(filepath.Dir(p.recordFilePath), p.recordingFileNameLocked(now))
+	if err := p.startRecordFileLocked(filePath); err != nil {
+		// Keep recording into the current file
+		p.lastError = err.Error()
+		p.events.emit(Event{Type: EventRecordingFailed, Path: old.path, Err: err})
+		return
+	}
+	if prog != nil && prog != oldProgram {
+		p.events.emit(Event{Type: EventProgramChanged, Path: filePath, Program: prog})
+	}
+
+	go func() {
+		if err := old.finish(); err != nil {
+			p.mu.Lock()
+			p.lastError = err.Error()
+			p.events.emit(Event{Type: EventRecordingFailed, Path: old.path, Err: err})
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// StopRecording stops the current recording. It waits for ffmpeg to finalize the
+// file and joins its segments if the recording was resumed after a failure.
+func (p *FFmpegPlayer) StopRecording() (string, error) {
+	p.mu.Lock()
+
 	if !p.recording {
+		p.mu.Unlock()
 		return "", fmt.Errorf("録音していません")
 	}
 
 	filePath := p.recordFilePath
 
-	// Cancel the recording context to stop ffmpeg
-	if p.recordCancel != nil {
-		p.recordCancel()
+	// Stop supervision
+	if p.recordSessionCancel != nil {
+		p.recordSessionCancel()
+		p.recordSessionCancel = nil
 	}
 
-	// Wait for the command to finish
-	if p.recordCmd != nil && p.recordCmd.Process != nil {
-		p.recordCmd.Wait()
+	// Close the recording's own connection
+	if p.recordSource != nil {
+		p.recordSource.stop()
+		p.recordSource = nil
 	}
 
+	file := p.recordedFileLocked()
+
 	p.recording = false
-	p.recordCmd = nil
+	p.recordAttached = false
+	p.recordProc = nil
 	p.recordFilePath = ""
 	p.recordStation = ""
+	p.recordProgram = nil
+	p.recordCover = ""
+	p.recordSegments = nil
+	p.recordStalled = false
+	p.mu.Unlock()
 
+	// Wait for ffmpeg without holding the lock, so that playback continues
+	// while ffmpeg writes the trailer
+	if err := file.finish(); err != nil {
+		p.events.emit(Event{Type: EventRecordingFailed, Path: filePath, Err: err})
+		return filePath, err
+	}
+
+	p.events.emit(Event{Type: EventRecordingStopped, Path: filePath})
 	return filePath, nil
 }
 
+// GetRecordingFiles returns the files written by the current (or last) recording session
+func (p *FFmpegPlayer) GetRecordingFiles() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.recordFiles...)
+}
+
+// GetRecordingGaps returns the spans missing from the current recording file and
+// whether the recording is currently resuming after a stall
+func (p *FFmpegPlayer) GetRecordingGaps() (gaps []recorder.Gap, resuming bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]recorder.Gap(nil), p.recordGaps...), p.recordStalled
+}
+
 // IsRecording returns whether recording is in progress
 func (p *FFmpegPlayer) IsRecording() bool {
 	p.mu.Lock()
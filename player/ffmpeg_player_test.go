@@ -0,0 +1,228 @@
+package player_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"radiko-tui/config"
+	"radiko-tui/internal/adts/adtstest"
+	"radiko-tui/player"
+	"radiko-tui/player/playertest"
+)
+
+const streamURL = "https://example.com/live.m3u8?station_id=TEST"
+
+// newTestPlayer returns a player on fakes, without time-shift, processing or
+// network check, so that the PCM sent reaches the sink scaled by the volume only
+func newTestPlayer(t *testing.T, volume float64) (*player.FFmpegPlayer, *playertest.FakeSource, *playertest.FakeSink) {
+	t.Helper()
+	source := &playertest.FakeSource{}
+	sink := &playertest.FakeSink{}
+	p := player.NewPlayerWithPipeline("token", volume, player.Pipeline{
+		Source:  source,
+		Decoder: &playertest.FakeDecoder{},
+		Sink:    sink,
+	})
+	p.SetTimeshiftDuration(0)
+	p.SetDSPOptions(player.DSPOptions{})
+	p.SetReconnectPolicy(player.ReconnectPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     10 * time.Millisecond,
+		MaxAttempts:  3,
+	})
+	t.Cleanup(p.Stop)
+	return p, source, sink
+}
+
+// pcm returns n stereo frames of a ramp, which is neither silent nor looping
+func pcm(n int, start int16) []byte {
+	b := make([]byte, n*4)
+	for i := range n * 2 {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(start+int16(i)))
+	}
+	return b
+}
+
+// waitPlayed waits until out has played n bytes and returns them
+func waitPlayed(t *testing.T, out *playertest.FakeOutput, n int) []byte {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		played := out.Played()
+		if len(played) >= n {
+			return played
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("played %d bytes, want %d", len(played), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitEvent waits for an event of type typ
+func waitEvent(t *testing.T, events <-chan player.Event, typ player.EventType, timeout time.Duration) player.Event {
+	t.Helper()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == typ {
+				return ev
+			}
+		case <-timer.C:
+			t.Fatalf("no %s event within %v", typ, timeout)
+		}
+	}
+}
+
+func TestPlayDeliversToOutput(t *testing.T) {
+	p, source, sink := newTestPlayer(t, 1)
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Play(streamURL); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	waitEvent(t, events, player.EventStarted, time.Second)
+
+	conn := source.Last()
+	if conn == nil || conn.StreamURL != streamURL || conn.AuthToken != "token" {
+		t.Fatalf("connection = %+v, want %s with the auth token", conn, streamURL)
+	}
+	out := sink.Last()
+	if out == nil || !out.IsPlaying() {
+		t.Fatal("output is not playing")
+	}
+
+	data := pcm(1024, 100)
+	conn.Send(data)
+	if played := waitPlayed(t, out, len(data)); !bytes.Equal(played, data) {
+		t.Error("output differs from the PCM sent at volume 1")
+	}
+
+	p.Stop()
+	if !conn.Closed() || !out.IsClosed() {
+		t.Error("Stop left the connection or the output open")
+	}
+}
+
+func TestFailedConnReconnects(t *testing.T) {
+	p, source, sink := newTestPlayer(t, 1)
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	if err := p.Play(streamURL); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	first := source.Last()
+	first.Send(pcm(256, 0))
+	waitPlayed(t, sink.Last(), 256*4)
+
+	first.Fail(&player.PlaybackError{Kind: player.ErrorHTTPServer, Status: 503})
+
+	// The monitor checks the connection every 2 seconds
+	ev := waitEvent(t, events, player.EventReconnecting, 5*time.Second)
+	if perr, ok := ev.Err.(*player.PlaybackError); !ok || perr.Kind != player.ErrorHTTPServer {
+		t.Errorf("reconnect cause = %v, want HTTP 5xx", ev.Err)
+	}
+	if ev.Attempt != 1 {
+		t.Errorf("attempt = %d, want 1", ev.Attempt)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(source.Conns()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("no new connection after the failure")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	second := source.Last()
+	out := sink.Last()
+
+	data := pcm(512, 1000)
+	second.Send(data)
+	waitEvent(t, events, player.EventRecovered, time.Second)
+	if played := waitPlayed(t, out, len(data)); !bytes.Equal(played, data) {
+		t.Error("output after the reconnect differs from the PCM sent")
+	}
+	if !p.IsPlaying() {
+		t.Error("player is not playing after recovering")
+	}
+	if status := p.GetReconnectStatus(); status != player.ReconnectSuccess {
+		t.Errorf("reconnect status = %v, want success", status)
+	}
+}
+
+func TestSetVolumeReachesOutput(t *testing.T) {
+	p, source, sink := newTestPlayer(t, 1)
+	if err := p.Play(streamURL); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	conn, out := source.Last(), sink.Last()
+
+	data := pcm(1024, 1000)
+	conn.Send(data)
+	waitPlayed(t, out, len(data))
+
+	p.SetVolume(0.5)
+	conn.Send(data)
+	played := waitPlayed(t, out, 2*len(data))[len(data):]
+
+	gain := config.VolumeGain(0.5)
+	for i := 0; i < len(data); i += 2 {
+		in := float64(int16(binary.LittleEndian.Uint16(data[i:])))
+		got := float64(int16(binary.LittleEndian.Uint16(played[i:])))
+		if diff := got - in*gain; diff < -1 || diff > 1 {
+			t.Fatalf("sample %d = %v, want %v (gain %.3f)", i/2, got, in*gain, gain)
+		}
+	}
+
+	p.ToggleMute()
+	conn.Send(data)
+	muted := waitPlayed(t, out, 3*len(data))[2*len(data):]
+	if !bytes.Equal(muted, make([]byte, len(data))) {
+		t.Error("muted output is not silent")
+	}
+}
+
+func TestSaveClipUsesEncoder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	source := &playertest.FakeSource{}
+	sink := &playertest.FakeSink{}
+	encoder := &playertest.FakeEncoder{}
+	p := player.NewPlayerWithPipeline("token", 1, player.Pipeline{
+		Source:  source,
+		Decoder: &playertest.FakeDecoder{},
+		Sink:    sink,
+		Encoder: encoder,
+	})
+	p.SetDSPOptions(player.DSPOptions{})
+	t.Cleanup(p.Stop)
+
+	if err := p.Play(streamURL); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	// The fake decoder plays the ADTS as PCM: frames of 4096 bytes last as long
+	// as PCM as they do as AAC, so that playing them all brings the playhead to live
+	var stream []byte
+	for i := range 20 {
+		stream = append(stream, adtstest.Frame(4096, byte(i))...)
+	}
+	source.Last().Send(stream)
+	waitPlayed(t, sink.Last(), len(stream))
+
+	path, err := p.SaveClip("Test FM", time.Hour, player.RecordingOptions{})
+	if err != nil {
+		t.Fatalf("SaveClip: %v", err)
+	}
+	if args := encoder.Args(); len(args) != 1 || args[0][len(args[0])-1] != path {
+		t.Errorf("encoder commands %v, want one writing %s", args, path)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, stream) {
+		t.Errorf("clip holds %d bytes (%v), want the %d bytes buffered", len(data), err, len(stream))
+	}
+}
@@ -0,0 +1,160 @@
+package player
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+// Level meter settings
+const (
+	meterWindow   = sampleRate / 10 // Frames per measurement (100ms)
+	fftSize       = 1024            // Samples of the spectrum (21ms, 47Hz per bin)
+	spectrumBands = 16
+	spectrumLow   = 50.0    // Hz, lower edge of the first band
+	spectrumHigh  = 16000.0 // Hz, upper edge of the last band
+
+	// LevelFloor is the level reported for silence (dBFS)
+	LevelFloor = -90.0
+)
+
+// Levels is the latest measurement of the decoded stream, before the volume and
+// the processing chain, so that it shows what the station sends
+type Levels struct {
+	RMS      [2]float64 // dBFS of the left and right channel over the last 100ms
+	Peak     [2]float64 // dBFS
+	Spectrum []float64  // dBFS per band, from 50Hz to 16kHz on a log scale
+	Updated  time.Time  // When the PCM was measured (zero = not yet); stale while no audio arrives
+}
+
+// levelMeter measures the PCM read by VolumeReader. Process runs on the reader
+// goroutine; get may be called from any goroutine.
+type levelMeter struct {
+	sum    [2]float64
+	peak   [2]float32
+	frames int
+	mono   [fftSize]float32 // Last samples, circular
+	pos    int
+
+	mu     sync.Mutex
+	levels Levels
+}
+
+// hannWindow is applied to the samples before the FFT
+var hannWindow = func() (w [fftSize]float64) {
+	for i := range w {
+		w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/fftSize)
+	}
+	return w
+}()
+
+// spectrumBins are the FFT bins where each band starts, plus the end of the last
+var spectrumBins = func() (bins [spectrumBands + 1]int) {
+	for i := range bins {
+		freq := spectrumLow * math.Pow(spectrumHigh/spectrumLow, float64(i)/spectrumBands)
+		bins[i] = int(freq * fftSize / sampleRate)
+		if i > 0 && bins[i] <= bins[i-1] {
+			bins[i] = bins[i-1] + 1 // At least one bin per band
+		}
+	}
+	return bins
+}()
+
+func (m *levelMeter) Process(samples []float32) {
+	for i := 0; i+1 < len(samples); i += 2 {
+		l, r := samples[i], samples[i+1]
+		m.sum[0] += float64(l * l)
+		m.sum[1] += float64(r * r)
+		m.peak[0] = max(m.peak[0], abs32(l))
+		m.peak[1] = max(m.peak[1], abs32(r))
+		m.mono[m.pos] = (l + r) / 2
+		m.pos = (m.pos + 1) % fftSize
+
+		m.frames++
+		if m.frames == meterWindow {
+			m.publish()
+		}
+	}
+}
+
+// publish stores the finished measurement and starts the next
+func (m *levelMeter) publish() {
+	var levels Levels
+	for ch := range 2 {
+		levels.RMS[ch] = toDBFS(math.Sqrt(m.sum[ch] / float64(m.frames)))
+		levels.Peak[ch] = toDBFS(float64(m.peak[ch]))
+	}
+	levels.Spectrum = m.spectrum()
+	levels.Updated = time.Now()
+
+	m.sum, m.peak, m.frames = [2]float64{}, [2]float32{}, 0
+
+	m.mu.Lock()
+	m.levels = levels
+	m.mu.Unlock()
+}
+
+// spectrum returns the level of each band over the last fftSize samples
+func (m *levelMeter) spectrum() []float64 {
+	x := make([]complex128, fftSize)
+	for i := range x {
+		x[i] = complex(float64(m.mono[(m.pos+i)%fftSize])*hannWindow[i], 0)
+	}
+	fft(x)
+
+	bands := make([]float64, spectrumBands)
+	for b := range bands {
+		var magnitude float64
+		for k := spectrumBins[b]; k < spectrumBins[b+1]; k++ {
+			magnitude = math.Max(magnitude, cmplx.Abs(x[k]))
+		}
+		// A full-scale sine peaks at fftSize/4 with the Hann window
+		bands[b] = toDBFS(magnitude / (fftSize / 4))
+	}
+	return bands
+}
+
+// get returns the latest measurement
+func (m *levelMeter) get() Levels {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	levels := m.levels
+	levels.Spectrum = append([]float64(nil), m.levels.Spectrum...)
+	return levels
+}
+
+// toDBFS converts a linear level (1 = full scale) to dBFS, LevelFloor for silence
+func toDBFS(level float64) float64 {
+	if level <= 0 {
+		return LevelFloor
+	}
+	return math.Max(LevelFloor, 20*math.Log10(level))
+}
+
+// fft transforms x in place (iterative radix-2; len(x) must be a power of two)
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// StreamSource fetches a stream and hands its compressed audio (ADTS AAC) over in chunks
+type StreamSource interface {
+	// Open connects to streamURL and calls deliver with each chunk, from a single
+	// goroutine, until the connection ends. deliver must not keep the source waiting
+	// and may keep the chunk.
+	Open(streamURL, authToken string, deliver func(data []byte)) (SourceConn, error)
+}
+
+// SourceConn is an open stream connection
+type SourceConn interface {
+	// Close disconnects without waiting, so that it may be called with the player locked
+	Close()
+	// Done is closed when the connection has ended and all data was delivered
+	Done() <-chan struct{}
+	// Err returns why the connection ended once Done is closed: nil when it was closed
+	// or the stream ended normally
+	Err() error
+}
+
+// Decoder decodes the compressed stream (ADTS AAC) to PCM (48kHz, stereo, s16le)
+type Decoder interface {
+	Start() (DecodeSession, error)
+}
+
+// DecodeSession is a running decoder
+type DecodeSession interface {
+	// Input receives the compressed stream. Writes may block while the output is not read.
+	Input() io.WriteCloser
+	// Output returns the decoded PCM
+	Output() io.Reader
+	// Stop ends decoding, dropping buffered audio, and waits for the decoder to exit
+	Stop()
+}
+
+// AudioSink plays PCM (48kHz, stereo, s16le)
+type AudioSink interface {
+	NewOutput(pcm io.Reader) (AudioOutput, error)
+}
+
+// AudioOutput is a PCM stream being played. The sink reads from it while playing.
+type AudioOutput interface {
+	Play() // Starts or resumes reading and playing, without blocking
+	Pause()
+	Close() error
+}
+
+// Encoder makes the processes that write recordings and clips
+type Encoder interface {
+	// Command returns a command running ffmpeg with args. It reads the compressed
+	// stream (ADTS AAC) from its stdin and writes the file named by the last argument.
+	Command(args []string) *exec.Cmd
+}
+
+// FFmpegEncoder writes files with the ffmpeg in PATH
+type FFmpegEncoder struct{}
+
+// Command returns ffmpeg run with args
+func (FFmpegEncoder) Command(args []string) *exec.Cmd {
+	return exec.Command("ffmpeg", args...)
+}
+
+// Pipeline is the chain a player fetches, decodes and plays audio through, and
+// the encoder its recordings and clips are written with
+type Pipeline struct {
+	Source  StreamSource
+	Decoder Decoder
+	Sink    AudioSink
+	Encoder Encoder // FFmpegEncoder if nil
+}
+
+// DefaultPipeline fetches and decodes streams with ffmpeg and plays them on the
+// sound card. In noaudio builds the sink reports that audio is not supported.
+func DefaultPipeline() Pipeline {
+	return Pipeline{
+		Source:  FFmpegSource{},
+		Decoder: FFmpegDecoder{},
+		Sink:    defaultSink(),
+		Encoder: FFmpegEncoder{},
+	}
+}
+
+// lookFFmpeg checks that ffmpeg can be run
+func lookFFmpeg() error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg not found in PATH. Please install ffmpeg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package player
+
+import (
+	"time"
+
+	"radiko-tui/recorder"
+)
+
+// ReconnectStatus represents the reconnection state
+type ReconnectStatus int
+
+const (
+	ReconnectNone ReconnectStatus = iota
+	ReconnectStarted
+	ReconnectAuth
+	ReconnectPlaying
+	ReconnectSuccess
+	ReconnectFailed
+)
+
+// Player plays live and past broadcasts and records them. It is what the TUI and
+// other front ends use; FFmpegPlayer implements it on top of a Pipeline.
+type Player interface {
+	// Connection
+	SetReconnectCallback(callback func() string)
+	SetSilencePolicy(policy SilencePolicy)
+	SetReconnectPolicy(policy ReconnectPolicy)
+	UpdateAuthToken(token string)
+	Reconnect() error
+	GetReconnectStatus() ReconnectStatus
+	GetLastError() string
+	ClearReconnectStatus()
+
+	// Events
+	Subscribe() (<-chan Event, func())
+
+	// Playback
+	Play(streamURL string) error
+	PlayTimefree(playlistURL string, ft, to time.Time) error
+	Stop()
+	IsPlaying() bool
+	IsTimefree() bool
+	GetTimefreePosition() (position, duration time.Duration)
+
+	// Pause, seek and time-shift
+	Pause() error
+	Resume() error
+	TogglePause() (paused bool, err error)
+	IsPaused() bool
+	Seek(position time.Duration) error
+	SeekRelative(delta time.Duration) error
+	SetTimeshiftDuration(d time.Duration)
+	GoLive() error
+	GetTimeshift() (behind, rewindable time.Duration, live bool)
+
+	// Sleep timer
+	SetSleepTimer(at time.Time, stopRecording bool) error
+	CancelSleepTimer()
+	GetSleepTimer() (at time.Time, stopRecording bool, active bool)
+
+	// Audio processing
+	SetDSPOptions(opts DSPOptions)
+	GetDSPOptions() DSPOptions
+	GetLevels() Levels
+
+	// Volume
+	SetVolume(volume float64)
+	GetVolume() float64
+	IncreaseVolume(delta float64)
+	DecreaseVolume(delta float64)
+	ToggleMute()
+	IsMuted() bool
+
+	// Recording
+	SetProgramLookup(lookup ProgramLookup)
+	StartRecording(stationName string) error
+	StartRecordingWithOptions(stationName string, opts RecordingOptions) error
+	SaveClip(stationName string, d time.Duration, opts RecordingOptions) (string, error)
+	StopRecording() (string, error)
+	ToggleRecording(stationName string) (started bool, filePath string, err error)
+	IsRecording() bool
+	GetRecordingInfo() (filePath string, duration time.Duration, stationName string)
+	GetRecordingFiles() []string
+	GetRecordingGaps() (gaps []recorder.Gap, resuming bool)
+}
+
+var _ Player = (*FFmpegPlayer)(nil)
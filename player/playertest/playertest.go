@@ -0,0 +1,325 @@
+// Package playertest provides a fake stream source, decoder, audio sink and encoder,
+// so that the player's play, reconnect, volume and recording flows can run without
+// ffmpeg or a sound card.
+//
+//	source := &playertest.FakeSource{}
+//	sink := &playertest.FakeSink{}
+//	p := player.NewPlayerWithPipeline("token", 0.5, player.Pipeline{
+//		Source:  source,
+//		Decoder: &playertest.FakeDecoder{},
+//		Sink:    sink,
+//	})
+//	p.SetTimeshiftDuration(0) // The time-shift buffer only keeps ADTS frames
+//	p.Play("https://example.com/live.m3u8")
+//	source.Last().Send(pcm) // Reaches the sink scaled by the volume
+//
+// The default reconnect policy dials Radiko before each attempt; tests of reconnects
+// set a policy without CheckNetwork to run offline.
+package playertest
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"radiko-tui/player"
+)
+
+// FakeSource is a stream source whose connections deliver what the test sends
+type FakeSource struct {
+	// Err makes Open fail when set
+	Err error
+
+	mu    sync.Mutex
+	conns []*FakeConn
+}
+
+// Open returns a new connection
+func (s *FakeSource) Open(streamURL, authToken string, deliver func(data []byte)) (player.SourceConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	c := &FakeConn{
+		StreamURL: streamURL,
+		AuthToken: authToken,
+		deliver:   deliver,
+		done:      make(chan struct{}),
+	}
+	s.conns = append(s.conns, c)
+	return c, nil
+}
+
+// Conns returns all connections opened so far
+func (s *FakeSource) Conns() []*FakeConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*FakeConn(nil), s.conns...)
+}
+
+// Last returns the most recently opened connection, or nil
+func (s *FakeSource) Last() *FakeConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.conns) == 0 {
+		return nil
+	}
+	return s.conns[len(s.conns)-1]
+}
+
+// FakeConn is a connection opened by FakeSource
+type FakeConn struct {
+	StreamURL string
+	AuthToken string
+
+	mu      sync.Mutex // Serializes deliveries like a real source
+	deliver func(data []byte)
+	once    sync.Once
+	done    chan struct{}
+	err     error
+}
+
+// Send delivers a chunk to the player. It does nothing once the connection is closed.
+func (c *FakeConn) Send(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Closed() {
+		return
+	}
+	c.deliver(data)
+}
+
+// End ends the connection as if the stream had dropped
+func (c *FakeConn) End() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// Fail ends the connection with err, as if ffmpeg had exited with an error.
+// A *player.PlaybackError sets the class the player reports.
+func (c *FakeConn) Fail(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// Close is called by the player to disconnect
+func (c *FakeConn) Close() {
+	c.End()
+}
+
+// Done is closed when the connection has ended
+func (c *FakeConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error passed to Fail
+func (c *FakeConn) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Closed reports whether the connection has ended
+func (c *FakeConn) Closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// FakeDecoder passes its input through unchanged, so the "compressed" stream sent
+// to a FakeConn is what the sink receives as PCM
+type FakeDecoder struct {
+	// Err makes Start fail when set
+	Err error
+
+	mu       sync.Mutex
+	sessions int
+}
+
+// Start starts a pass-through session
+func (d *FakeDecoder) Start() (player.DecodeSession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	d.sessions++
+	r, w := io.Pipe()
+	return &fakeDecodeSession{r: r, w: w}, nil
+}
+
+// Sessions returns the number of sessions started (1 + restarts)
+func (d *FakeDecoder) Sessions() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sessions
+}
+
+// fakeDecodeSession is a pass-through decoder session
+type fakeDecodeSession struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (s *fakeDecodeSession) Input() io.WriteCloser { return s.w }
+
+func (s *fakeDecodeSession) Output() io.Reader { return s.r }
+
+// Stop makes pending reads and writes fail
+func (s *fakeDecodeSession) Stop() {
+	s.w.CloseWithError(io.ErrClosedPipe)
+	s.r.CloseWithError(io.ErrClosedPipe)
+}
+
+// FakeSink records the PCM the player plays
+type FakeSink struct {
+	// Err makes NewOutput fail when set
+	Err error
+
+	mu      sync.Mutex
+	outputs []*FakeOutput
+}
+
+// NewOutput returns a paused output reading pcm
+func (s *FakeSink) NewOutput(pcm io.Reader) (player.AudioOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	o := &FakeOutput{pcm: pcm}
+	o.cond = sync.NewCond(&o.mu)
+	s.outputs = append(s.outputs, o)
+	go o.run()
+	return o, nil
+}
+
+// Outputs returns all outputs created so far
+func (s *FakeSink) Outputs() []*FakeOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*FakeOutput(nil), s.outputs...)
+}
+
+// Last returns the most recently created output, or nil
+func (s *FakeSink) Last() *FakeOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.outputs) == 0 {
+		return nil
+	}
+	return s.outputs[len(s.outputs)-1]
+}
+
+// FakeOutput reads PCM while playing and keeps what it read
+type FakeOutput struct {
+	pcm io.Reader
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	playing bool
+	closed  bool
+	played  []byte
+}
+
+// run reads the PCM whenever the output is playing
+func (o *FakeOutput) run() {
+	buf := make([]byte, 4096)
+	for {
+		o.mu.Lock()
+		for !o.playing && !o.closed {
+			o.cond.Wait()
+		}
+		closed := o.closed
+		o.mu.Unlock()
+		if closed {
+			return
+		}
+
+		n, err := o.pcm.Read(buf)
+		o.mu.Lock()
+		o.played = append(o.played, buf[:n]...)
+		o.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Play starts reading
+func (o *FakeOutput) Play() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.playing = true
+	o.cond.Broadcast()
+}
+
+// Pause stops reading after the current read
+func (o *FakeOutput) Pause() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.playing = false
+}
+
+// Close stops the output
+func (o *FakeOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return fmt.Errorf("already closed")
+	}
+	o.closed = true
+	o.cond.Broadcast()
+	return nil
+}
+
+// Played returns a copy of the PCM read so far
+func (o *FakeOutput) Played() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]byte(nil), o.played...)
+}
+
+// IsPlaying reports whether the output is playing
+func (o *FakeOutput) IsPlaying() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.playing && !o.closed
+}
+
+// IsClosed reports whether the player closed the output
+func (o *FakeOutput) IsClosed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closed
+}
+
+// FakeEncoder writes the compressed stream unchanged to the output file, with a
+// shell instead of ffmpeg, and keeps the arguments of each command
+type FakeEncoder struct {
+	mu   sync.Mutex
+	args [][]string
+}
+
+// Command returns a shell copying its stdin to the file named by the last argument
+func (e *FakeEncoder) Command(args []string) *exec.Cmd {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.args = append(e.args, append([]string(nil), args...))
+	return exec.Command("sh", "-c", `exec cat > "$1"`, "sh", args[len(args)-1])
+}
+
+// Args returns the ffmpeg arguments of each command made so far
+func (e *FakeEncoder) Args() [][]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([][]string(nil), e.args...)
+}
@@ -0,0 +1,66 @@
+package player
+
+import (
+	"context"
+	"time"
+
+	"radiko-tui/model"
+)
+
+// Program guide lookups during live playback
+const (
+	programRecheck = 5 * time.Second  // Wait after a program's end before looking up the next
+	programRetry   = time.Minute      // Wait after a failed lookup
+	programMinWait = 10 * time.Second // Shortest wait between lookups
+	programMaxWait = 30 * time.Minute // Longest wait, in case the guide changes
+)
+
+// watchProgramLocked follows the program on air during live playback of streamURL,
+// replacing the previous watch. p.mu must be held.
+func (p *FFmpegPlayer) watchProgramLocked(streamURL string) {
+	p.stopProgramWatchLocked()
+	stationID := stationIDFromURL(streamURL)
+	if p.programLookup == nil || stationID == streamURL {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.programWatchCancel = cancel
+	go p.watchProgram(ctx, stationID, p.programLookup)
+}
+
+// stopProgramWatchLocked stops following the program on air. p.mu must be held.
+func (p *FFmpegPlayer) stopProgramWatchLocked() {
+	if p.programWatchCancel != nil {
+		p.programWatchCancel()
+		p.programWatchCancel = nil
+	}
+}
+
+// watchProgram looks up the program on air from the guide, again when it ends, and
+// emits EventProgramChanged when another one has started, until ctx ends. The
+// program on air when playback starts is not reported.
+func (p *FFmpegPlayer) watchProgram(ctx context.Context, stationID string, lookup ProgramLookup) {
+	var current *model.GuideProgram
+	for {
+		wait := programRetry
+		if prog, err := lookup(stationID, time.Now()); err == nil && prog != nil {
+			wait = time.Until(prog.End) + programRecheck
+			if current != nil && !prog.Start.Equal(current.Start) {
+				p.mu.Lock()
+				if ctx.Err() == nil {
+					p.events.emit(Event{Type: EventProgramChanged, Program: prog})
+				}
+				p.mu.Unlock()
+			}
+			current = prog
+		}
+
+		timer := time.NewTimer(min(max(wait, programMinWait), programMaxWait))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"radiko-tui/config"
+)
+
+// ReconnectPolicy controls how the player retries after playback failed
+type ReconnectPolicy struct {
+	InitialDelay time.Duration // Wait before the first attempt
+	MaxDelay     time.Duration // Upper bound of the wait between attempts
+	Multiplier   float64       // Growth of the wait per attempt
+	Jitter       float64       // Random variation of the wait, as a fraction of it (0-1)
+	MaxAttempts  int           // Attempts before giving up (0 = unlimited)
+	Cooldown     time.Duration // Wait after giving up before starting over (0 = stay stopped)
+
+	// CheckNetwork is called before each attempt and fails when there is no network
+	// (nil = no check)
+	CheckNetwork func() error
+}
+
+// DefaultReconnectPolicy returns the policy used unless SetReconnectPolicy is called
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicyFromConfig(config.DefaultConfig().Reconnect)
+}
+
+// ReconnectPolicyFromConfig builds a policy from the reconnect section of the config
+func ReconnectPolicyFromConfig(cfg config.ReconnectConfig) ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: time.Duration(cfg.InitialDelaySec * float64(time.Second)),
+		MaxDelay:     time.Duration(cfg.MaxDelaySec * float64(time.Second)),
+		Multiplier:   2,
+		Jitter:       cfg.Jitter,
+		MaxAttempts:  cfg.MaxAttempts,
+		Cooldown:     time.Duration(cfg.CooldownSec) * time.Second,
+		CheckNetwork: checkRadikoReachable,
+	}
+}
+
+// backoff returns the wait before the given attempt (starting at 1)
+func (rp ReconnectPolicy) backoff(attempt int) time.Duration {
+	multiplier := math.Max(rp.Multiplier, 1)
+	d := float64(rp.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if rp.MaxDelay > 0 && d > float64(rp.MaxDelay) {
+		d = float64(rp.MaxDelay)
+	}
+	if jitter := math.Min(math.Max(rp.Jitter, 0), 1); jitter > 0 {
+		// Spread the attempts of many clients after an outage
+		d *= 1 + jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// networkCheckAddr is dialed to tell a network outage from a failing stream
+const networkCheckAddr = "radiko.jp:443"
+
+// checkRadikoReachable fails when Radiko cannot be reached at all
+func checkRadikoReachable() error {
+	conn, err := net.DialTimeout("tcp", networkCheckAddr, 5*time.Second)
+	if err != nil {
+		return &PlaybackError{Kind: ErrorNetwork, Err: err}
+	}
+	conn.Close()
+	return nil
+}
+
+// ErrorKind is the class of a playback failure
+type ErrorKind int
+
+const (
+	ErrorUnknown    ErrorKind = iota
+	ErrorAuth                 // No auth token could be obtained, or it was rejected
+	ErrorOutOfArea            // The station is not available in the token's area
+	ErrorHTTPClient           // The server answered 4xx
+	ErrorHTTPServer           // The server answered 5xx
+	ErrorFFmpeg               // ffmpeg could not be started or exited unexpectedly
+	ErrorNetwork              // The network is unreachable
+	ErrorStalled              // The stream stopped delivering audio
+	ErrorSilent               // The stream delivers only silence
+	ErrorLooping              // The stream repeats the same audio
+)
+
+// String returns the label shown to the user
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorAuth:
+		return "認証失敗"
+	case ErrorOutOfArea:
+		return "エリア外"
+	case ErrorHTTPClient:
+		return "HTTP 4xx"
+	case ErrorHTTPServer:
+		return "HTTP 5xx"
+	case ErrorFFmpeg:
+		return "ffmpeg 異常終了"
+	case ErrorNetwork:
+		return "ネットワーク未接続"
+	case ErrorStalled:
+		return "ストリーム途絶"
+	case ErrorSilent:
+		return "無音"
+	case ErrorLooping:
+		return "ループ"
+	default:
+		return "不明なエラー"
+	}
+}
+
+// Retryable reports whether retrying may help. An out-of-area station stays unavailable
+// until the area is changed.
+func (k ErrorKind) Retryable() bool {
+	return k != ErrorOutOfArea
+}
+
+// PlaybackError is a classified playback failure
+type PlaybackError struct {
+	Kind   ErrorKind
+	Status int // HTTP status, if the server answered
+	Err    error
+}
+
+func (e *PlaybackError) Error() string {
+	label := e.Kind.String()
+	if e.Status != 0 && e.Kind != ErrorHTTPClient && e.Kind != ErrorHTTPServer {
+		label = fmt.Sprintf("%s (HTTP %d)", label, e.Status)
+	} else if e.Status != 0 {
+		label = fmt.Sprintf("HTTP %d", e.Status)
+	}
+	if e.Err == nil {
+		return label
+	}
+	return label + ": " + e.Err.Error()
+}
+
+func (e *PlaybackError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errAuthFailed   = errors.New("認証の取得に失敗しました")
+	errStalled      = errors.New("音声が届きません")
+	errSourceExited = errors.New("ストリームが終了しました")
+)
+
+// FFmpegError is an unexpected exit of an ffmpeg process, with the end of its error output
+type FFmpegError struct {
+	Stderr string
+	Err    error
+}
+
+func (e *FFmpegError) Error() string {
+	if line := lastLine(e.Stderr); line != "" {
+		return fmt.Sprintf("ffmpeg: %s", line)
+	}
+	return fmt.Sprintf("ffmpeg: %v", e.Err)
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// httpStatusPattern matches the HTTP errors ffmpeg reports, e.g. "HTTP error 403 Forbidden"
+// or "Server returned 5XX Server Error reply"
+var httpStatusPattern = regexp.MustCompile(`(?:HTTP error|Server returned) ([45])(\d\d|XX)`)
+
+// networkErrorMessages are ffmpeg and OS messages of an unreachable network
+var networkErrorMessages = []string{
+	"Network is unreachable",
+	"No route to host",
+	"Connection refused",
+	"Connection timed out",
+	"Name or service not known",
+	"Temporary failure in name resolution",
+	"nodename nor servname provided",
+	"Failed to resolve hostname",
+}
+
+// classifyError returns err as a PlaybackError
+func classifyError(err error) *PlaybackError {
+	var perr *PlaybackError
+	if errors.As(err, &perr) {
+		return perr
+	}
+
+	switch {
+	case errors.Is(err, errAuthFailed):
+		return &PlaybackError{Kind: ErrorAuth, Err: err}
+	case errors.Is(err, errStalled):
+		return &PlaybackError{Kind: ErrorStalled, Err: err}
+	case errors.Is(err, errSilent):
+		return &PlaybackError{Kind: ErrorSilent, Err: err}
+	case errors.Is(err, errLooping):
+		return &PlaybackError{Kind: ErrorLooping, Err: err}
+	case errors.Is(err, exec.ErrNotFound):
+		return &PlaybackError{Kind: ErrorFFmpeg, Err: err}
+	}
+
+	var ferr *FFmpegError
+	if !errors.As(err, &ferr) {
+		var nerr net.Error
+		if errors.As(err, &nerr) {
+			return &PlaybackError{Kind: ErrorNetwork, Err: err}
+		}
+		return &PlaybackError{Kind: ErrorUnknown, Err: err}
+	}
+
+	if m := httpStatusPattern.FindStringSubmatch(ferr.Stderr); m != nil {
+		status, _ := strconv.Atoi(m[1] + m[2])
+		switch {
+		case status == 401:
+			return &PlaybackError{Kind: ErrorAuth, Status: status, Err: err}
+		case status == 403:
+			// Radiko refuses stations outside the area the token was issued for
+			return &PlaybackError{Kind: ErrorOutOfArea, Status: status, Err: err}
+		case m[1] == "4":
+			return &PlaybackError{Kind: ErrorHTTPClient, Status: status, Err: err}
+		default:
+			return &PlaybackError{Kind: ErrorHTTPServer, Status: status, Err: err}
+		}
+	}
+	for _, msg := range networkErrorMessages {
+		if strings.Contains(ferr.Stderr, msg) {
+			return &PlaybackError{Kind: ErrorNetwork, Err: err}
+		}
+	}
+	return &PlaybackError{Kind: ErrorFFmpeg, Err: err}
+}
@@ -0,0 +1,164 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	jittered := ReconnectPolicy{InitialDelay: time.Second, MaxDelay: 30 * time.Second, Multiplier: 2, Jitter: 0.2}
+	exact := ReconnectPolicy{InitialDelay: time.Second, MaxDelay: 30 * time.Second, Multiplier: 2}
+
+	tests := []struct {
+		name     string
+		policy   ReconnectPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first attempt", exact, 1, time.Second, time.Second},
+		{"doubles", exact, 2, 2 * time.Second, 2 * time.Second},
+		{"doubles again", exact, 4, 8 * time.Second, 8 * time.Second},
+		{"capped at max delay", exact, 6, 30 * time.Second, 30 * time.Second},
+		{"no max delay", ReconnectPolicy{InitialDelay: time.Second, Multiplier: 2}, 7, 64 * time.Second, 64 * time.Second},
+		{"multiplier below 1 keeps the delay", ReconnectPolicy{InitialDelay: time.Second, Multiplier: 0.5}, 3, time.Second, time.Second},
+		{"jitter on the first attempt", jittered, 1, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{"jitter on the third attempt", jittered, 3, 3200 * time.Millisecond, 4800 * time.Millisecond},
+		{"jitter around the max delay", jittered, 8, 24 * time.Second, 36 * time.Second},
+		{"jitter clamped to 1", ReconnectPolicy{InitialDelay: time.Second, Multiplier: 2, Jitter: 3}, 1, 0, 2 * time.Second},
+		{"negative jitter ignored", ReconnectPolicy{InitialDelay: time.Second, Multiplier: 2, Jitter: -1}, 2, 2 * time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Jitter is random: every sample must stay within the range
+			for range 200 {
+				if d := tt.policy.backoff(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("backoff(%d) = %v, want %v-%v", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleReconnect(t *testing.T) {
+	cause := &PlaybackError{Kind: ErrorHTTPServer, Status: 503}
+	outOfArea := &PlaybackError{Kind: ErrorOutOfArea, Status: 403}
+
+	tests := []struct {
+		name        string
+		policy      ReconnectPolicy
+		attempt     int // Attempts made before the failure
+		cause       error
+		wantStatus  ReconnectStatus
+		wantAttempt int           // Attempt scheduled (0 = none)
+		wantWait    time.Duration // Wait before the scheduled attempt
+		wantFailed  bool          // EventFailed is emitted
+	}{
+		{"first failure", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3}, 0, cause, ReconnectStarted, 1, time.Hour, false},
+		{"last attempt", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3}, 2, cause, ReconnectStarted, 3, time.Hour, false},
+		{"gives up after max attempts", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3}, 3, cause, ReconnectFailed, 0, 0, true},
+		{"unlimited attempts", ReconnectPolicy{InitialDelay: time.Hour}, 50, cause, ReconnectStarted, 51, time.Hour, false},
+		{"cooldown starts over", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3, Cooldown: 2 * time.Hour}, 3, cause, ReconnectFailed, 1, 2 * time.Hour, true},
+		{"out of area retried once", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3}, 0, outOfArea, ReconnectStarted, 1, time.Hour, false},
+		{"out of area gives up despite cooldown", ReconnectPolicy{InitialDelay: time.Hour, MaxAttempts: 3, Cooldown: time.Hour}, 1, outOfArea, ReconnectFailed, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlayerWithPipeline("token", 1, Pipeline{})
+			p.SetReconnectPolicy(tt.policy)
+			events, unsubscribe := p.Subscribe()
+			defer unsubscribe()
+			// Cancels the scheduled attempt, which would need a pipeline
+			defer p.Stop()
+
+			p.mu.Lock()
+			p.reconnectAttempt = tt.attempt
+			before := time.Now()
+			p.scheduleReconnectLocked(tt.cause)
+			status, attempt, scheduled := p.reconnectStatus, p.reconnectAttempt, p.reconnectCancel != nil
+			p.mu.Unlock()
+
+			if status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", status, tt.wantStatus)
+			}
+			if attempt != tt.wantAttempt || scheduled != (tt.wantAttempt > 0) {
+				t.Errorf("attempt = %d (scheduled %v), want %d", attempt, scheduled, tt.wantAttempt)
+			}
+
+			var failed, reconnecting *Event
+			for len(events) > 0 {
+				ev := <-events
+				switch ev.Type {
+				case EventFailed:
+					failed = &ev
+				case EventReconnecting:
+					reconnecting = &ev
+				}
+			}
+			if (failed != nil) != tt.wantFailed {
+				t.Errorf("EventFailed emitted = %v, want %v", failed != nil, tt.wantFailed)
+			}
+			if tt.wantAttempt == 0 {
+				if reconnecting != nil {
+					t.Errorf("attempt %d scheduled after giving up", reconnecting.Attempt)
+				}
+				return
+			}
+			if reconnecting == nil {
+				t.Fatal("no EventReconnecting")
+			}
+			if reconnecting.Attempt != tt.wantAttempt || reconnecting.MaxAttempts != tt.policy.MaxAttempts {
+				t.Errorf("event attempt = %d/%d, want %d/%d", reconnecting.Attempt, reconnecting.MaxAttempts, tt.wantAttempt, tt.policy.MaxAttempts)
+			}
+			if wait := reconnecting.NextRetry.Sub(before); wait < tt.wantWait || wait > tt.wantWait+time.Second {
+				t.Errorf("next retry in %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	ffmpegErr := func(stderr string) error {
+		return &FFmpegError{Stderr: stderr, Err: errors.New("exit status 1")}
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantKind   ErrorKind
+		wantStatus int
+	}{
+		{"already classified", &PlaybackError{Kind: ErrorOutOfArea}, ErrorOutOfArea, 0},
+		{"auth failed", errAuthFailed, ErrorAuth, 0},
+		{"stalled", fmt.Errorf("monitor: %w", errStalled), ErrorStalled, 0},
+		{"silent", errSilent, ErrorSilent, 0},
+		{"looping", errLooping, ErrorLooping, 0},
+		{"ffmpeg missing", fmt.Errorf("start: %w", exec.ErrNotFound), ErrorFFmpeg, 0},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorNetwork, 0},
+		{"unknown", errors.New("something else"), ErrorUnknown, 0},
+		{"HTTP 401", ffmpegErr("[https @ 0x1] HTTP error 401 Unauthorized"), ErrorAuth, 401},
+		{"HTTP 403 is out of area", ffmpegErr("[https @ 0x1] HTTP error 403 Forbidden"), ErrorOutOfArea, 403},
+		{"HTTP 404", ffmpegErr("[https @ 0x1] HTTP error 404 Not Found"), ErrorHTTPClient, 404},
+		{"HTTP 503", ffmpegErr("[https @ 0x1] HTTP error 503 Service Unavailable"), ErrorHTTPServer, 503},
+		{"server 5XX", ffmpegErr("Server returned 5XX Server Error reply"), ErrorHTTPServer, 0},
+		{"server 4XX", ffmpegErr("Server returned 4XX Client Error, but not one of 40{0,1,3,4}"), ErrorHTTPClient, 0},
+		{"unreachable network", ffmpegErr("Failed to resolve hostname radiko.jp: Temporary failure in name resolution"), ErrorNetwork, 0},
+		{"connection refused", ffmpegErr("Connection to tcp://radiko.jp:443 failed: Connection refused"), ErrorNetwork, 0},
+		{"other ffmpeg failure", ffmpegErr("Invalid data found when processing input"), ErrorFFmpeg, 0},
+		{"ffmpeg without output", &FFmpegError{Err: errors.New("signal: killed")}, ErrorFFmpeg, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perr := classifyError(tt.err)
+			if perr.Kind != tt.wantKind || perr.Status != tt.wantStatus {
+				t.Errorf("classifyError = %v (HTTP %d), want %v (HTTP %d)", perr.Kind, perr.Status, tt.wantKind, tt.wantStatus)
+			}
+			if !errors.Is(perr, tt.err) && perr != tt.err {
+				t.Errorf("classifyError dropped the original error %v", tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"radiko-tui/model"
+	"radiko-tui/recorder"
+)
+
+// RecordingOptions controls how a recording session names, splits and encodes its files
+type RecordingOptions struct {
+	StationID    string                 // Station ID, used to look up the next program
+	Program      *model.GuideProgram    // Program on air when the recording starts (also used for tags)
+	ProgramAware bool                   // Name files after the program and split at program boundaries
+	MaxDuration  time.Duration          // Split after this duration (0 = no limit)
+	MaxSize      int64                  // Split after this many bytes (0 = no limit)
+	Output       recorder.OutputOptions // Codec/container (raw AAC if empty)
+	Prepend      time.Duration          // Start this far before the playhead, from the time-shift buffer (live only)
+}
+
+// recordingCover fetches the cover art of a program if the output format embeds one.
+// It returns an empty path when there is no cover.
+func recordingCover(out recorder.OutputOptions, prog *model.GuideProgram) string {
+	if prog == nil || prog.ImageURL == "" || !out.Format.SupportsCover() {
+		return ""
+	}
+	coverPath, err := recorder.FetchCover(prog.ImageURL)
+	if err != nil {
+		return ""
+	}
+	return coverPath
+}
+
+// ProgramLookup returns the program of a station on air at a given time
+type ProgramLookup func(stationID string, at time.Time) (*model.GuideProgram, error)
+
+// recordSinkQueue is the number of compressed chunks buffered for a recording process
+const recordSinkQueue = 256
+
+// recordProcess is an ffmpeg process writing one segment of a recording file.
+// It reads the compressed stream (ADTS AAC) from its stdin, fed by the player's upstream.
+type recordProcess struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	queue    chan []byte   // Chunks waiting to be written to ffmpeg
+	done     chan struct{} // Closed when ffmpeg has exited
+	path     string        // Segment file
+	started  time.Time
+	exitedAt time.Time // Set before done is closed
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// startRecordProcess starts the ffmpeg cmd and feeds it from the queue in the background
+func startRecordProcess(cmd *exec.Cmd, path string) (*recordProcess, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &recordProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		queue:   make(chan []byte, recordSinkQueue),
+		done:    make(chan struct{}),
+		path:    path,
+		started: time.Now(),
+	}
+	go func() {
+		for data := range proc.queue {
+			if _, err := stdin.Write(data); err != nil {
+				break
+			}
+		}
+		// EOF makes ffmpeg finalize the file
+		stdin.Close()
+	}()
+	go func() {
+		cmd.Wait()
+		proc.exitedAt = time.Now()
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// write queues whole frames of the compressed stream. It never blocks the upstream:
+// if ffmpeg does not keep up, the frames are dropped and write returns false.
+func (rp *recordProcess) write(frames []byte) bool {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.closed {
+		return true
+	}
+	select {
+	case rp.queue <- frames:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop closes the input so that ffmpeg finalizes the segment, and waits for it to exit.
+// ffmpeg is killed if it does not exit within a few seconds.
+func (rp *recordProcess) stop() {
+	rp.mu.Lock()
+	if !rp.closed {
+		rp.closed = true
+		close(rp.queue)
+	}
+	rp.mu.Unlock()
+
+	select {
+	case <-rp.done:
+	case <-time.After(10 * time.Second):
+		rp.cmd.Process.Kill()
+		<-rp.done
+	}
+}
+
+// exited reports whether ffmpeg has exited
+func (rp *recordProcess) exited() bool {
+	select {
+	case <-rp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordedFile is a recording file that is finished after a split or stop
+type recordedFile struct {
+	proc     *recordProcess
+	path     string
+	segments []string
+	out      recorder.OutputOptions
+	meta     recorder.Metadata
+	cover    string
+}
+
+// finish stops ffmpeg, joins the segments of the file if it was resumed after a
+// failure and rewrites its tags if audio is missing
+func (f recordedFile) finish() error {
+	if f.proc != nil {
+		f.proc.stop()
+	}
+	return recorder.JoinSegments(f.path, f.segments, f.out, f.meta, f.cover)
+}
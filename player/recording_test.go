@@ -0,0 +1,156 @@
+package player
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordProcessWriteFull(t *testing.T) {
+	rp := &recordProcess{queue: make(chan []byte, 2)}
+	for i := range 2 {
+		if !rp.write([]byte{byte(i)}) {
+			t.Fatalf("write %d dropped with room in the queue", i)
+		}
+	}
+	if rp.write([]byte{2}) {
+		t.Error("write into a full queue was not reported as dropped")
+	}
+	<-rp.queue
+	if !rp.write([]byte{3}) {
+		t.Error("write dropped after the queue drained")
+	}
+}
+
+func TestNoteRecordDrop(t *testing.T) {
+	p := NewPlayerWithPipeline("", 1, Pipeline{})
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	start := time.Now()
+	proc := &recordProcess{}
+
+	p.mu.Lock()
+	p.recording = true
+	p.recordProc = proc
+	p.recordFilePath = "rec.aac"
+	p.recordFileStart = start
+	p.noteRecordDropLocked(proc, start.Add(time.Minute), 2*time.Second)
+	// Drops in a row extend the same gap
+	p.noteRecordDropLocked(proc, start.Add(time.Minute+time.Second), 3*time.Second)
+	// A drop of another process (a finished segment) is ignored
+	p.noteRecordDropLocked(&recordProcess{}, start.Add(time.Minute+2*time.Second), time.Second)
+	// A later drop is a new gap, after the missing audio of the first
+	p.noteRecordDropLocked(proc, start.Add(2*time.Minute), time.Second)
+	recorded := p.recordGaps
+	p.mu.Unlock()
+
+	if len(recorded) != 2 {
+		t.Fatalf("got %d gaps, want 2", len(recorded))
+	}
+	if g := recorded[0]; g.Offset != time.Minute || g.Duration != 5*time.Second || g.DeadAir {
+		t.Errorf("first gap = %+v, want 5s missing at 1:00", g)
+	}
+	if g := recorded[1]; g.Offset != 2*time.Minute-5*time.Second || g.Duration != time.Second {
+		t.Errorf("second gap = %+v, want 1s missing at 1:55", g)
+	}
+	dropped := drainEvents(events)
+	if len(dropped) != 2 {
+		t.Fatalf("got %d EventRecordingDropped, want one per gap", len(dropped))
+	}
+	if dropped[0].Path != "rec.aac" || dropped[0].Gap.Duration != 2*time.Second {
+		t.Errorf("first event = %+v", dropped[0])
+	}
+}
+
+// drainEvents returns the EventRecordingDropped events buffered in events
+func drainEvents(events <-chan Event) []Event {
+	var dropped []Event
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == EventRecordingDropped {
+			dropped = append(dropped, ev)
+		}
+	}
+	return dropped
+}
+
+// tokenSource records the auth token of each connection opened
+type tokenSource struct {
+	tokens []string
+}
+
+func (s *tokenSource) Open(streamURL, authToken string, deliver func(data []byte)) (SourceConn, error) {
+	s.tokens = append(s.tokens, authToken)
+	return &idleConn{done: make(chan struct{})}, nil
+}
+
+// idleConn is a connection that delivers nothing until closed
+type idleConn struct {
+	done   chan struct{}
+	closed bool
+}
+
+func (c *idleConn) Close() {
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+}
+
+func (c *idleConn) Done() <-chan struct{} { return c.done }
+func (c *idleConn) Err() error            { return nil }
+
+func TestReconnectRecordSourceKeepsToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		refresh     string // Token returned by the reconnect callback ("" = no callback)
+		wantToken   string // Token of the new recording connection
+		wantRefresh bool
+	}{
+		{"refreshes the recording token", "rec-new", "rec-new", true},
+		{"keeps the recording token without a callback", "", "rec", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &tokenSource{}
+			p := NewPlayerWithPipeline("play", 1, Pipeline{Source: source})
+			old, _ := startUpstream(source, "https://example.com/rec.m3u8", "rec", p.deliver)
+
+			refreshed := false
+			p.mu.Lock()
+			p.recording = true
+			p.recordStreamURL = old.streamURL
+			p.recordSource = old
+			p.recordAuthToken = "rec"
+			// Playback moved on to another station with its own token
+			p.authToken = "other"
+			if tt.refresh != "" {
+				p.onReconnect = func() string {
+					refreshed = true
+					return tt.refresh
+				}
+			}
+			p.mu.Unlock()
+
+			p.reconnectRecordSource(old)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if got := source.tokens[len(source.tokens)-1]; len(source.tokens) != 2 || got != tt.wantToken {
+				t.Errorf("connections opened with %v, want a second one with %q", source.tokens, tt.wantToken)
+			}
+			if refreshed != tt.wantRefresh {
+				t.Errorf("token refreshed = %v, want %v", refreshed, tt.wantRefresh)
+			}
+			if p.authToken != "other" {
+				t.Errorf("playback token = %q, want it left as %q", p.authToken, "other")
+			}
+			if p.recordAuthToken != tt.wantToken {
+				t.Errorf("recording token = %q, want %q", p.recordAuthToken, tt.wantToken)
+			}
+			if p.recordSource == old || !old.conn.(*idleConn).closed {
+				t.Error("the old recording connection was not replaced")
+			}
+			p.recordSource.stop()
+		})
+	}
+}
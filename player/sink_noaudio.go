@@ -0,0 +1,21 @@
+//go:build noaudio
+
+package player
+
+import (
+	"fmt"
+	"io"
+)
+
+// noaudioSink reports that audio output is not supported in server-only builds
+type noaudioSink struct{}
+
+// defaultSink returns a sink that cannot play
+func defaultSink() AudioSink {
+	return noaudioSink{}
+}
+
+// NewOutput always fails
+func (noaudioSink) NewOutput(pcm io.Reader) (AudioOutput, error) {
+	return nil, fmt.Errorf("音声再生はサポートされていません (noaudio build)")
+}
@@ -0,0 +1,95 @@
+//go:build !noaudio
+
+package player
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// otoSink plays PCM on the sound card through oto. oto allows a single context
+// per process, so it is created on first use and shared by all outputs.
+type otoSink struct{}
+
+var (
+	otoOnce    sync.Once
+	otoContext *oto.Context
+	otoErr     error
+)
+
+// defaultSink returns the sound card sink
+func defaultSink() AudioSink {
+	return otoSink{}
+}
+
+// initOto creates the oto context for 48kHz stereo s16le
+func initOto() error {
+	otoOnce.Do(func() {
+		op := &oto.NewContextOptions{
+			SampleRate:   48000,
+			ChannelCount: 2,
+			Format:       oto.FormatSignedInt16LE,
+		}
+
+		var ready chan struct{}
+		otoContext, ready, otoErr = oto.NewContext(op)
+		if otoErr != nil {
+			otoErr = fmt.Errorf("failed to create oto context: %w", otoErr)
+			return
+		}
+		<-ready
+	})
+	return otoErr
+}
+
+// NewOutput creates an oto player reading pcm
+func (otoSink) NewOutput(pcm io.Reader) (AudioOutput, error) {
+	if err := initOto(); err != nil {
+		return nil, fmt.Errorf("failed to init audio: %w", err)
+	}
+	return &otoOutput{player: otoContext.NewPlayer(pcm)}, nil
+}
+
+// otoOutput is an oto player whose Play never blocks
+type otoOutput struct {
+	player *oto.Player
+
+	mu  sync.Mutex // Orders the background Play with the calls made after it
+	seq uint64     // Calls made so far; a background Play only runs if it is the last
+}
+
+// Play starts playback. oto fills its buffer synchronously on Windows, so it runs
+// in the background, unless Pause or Close was called meanwhile.
+func (o *otoOutput) Play() {
+	o.mu.Lock()
+	o.seq++
+	seq := o.seq
+	o.mu.Unlock()
+
+	go func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.seq == seq {
+			o.player.Play()
+		}
+	}()
+}
+
+// Pause stops playback, after a Play still starting
+func (o *otoOutput) Pause() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	o.player.Pause()
+}
+
+// Close stops playback for good; a Play still pending does not start it again
+func (o *otoOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	return o.player.Close()
+}
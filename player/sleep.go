@@ -0,0 +1,100 @@
+package player
+
+import (
+	"fmt"
+	"time"
+)
+
+// sleepFade is how long the volume fades out before the sleep timer stops playback
+const sleepFade = time.Minute
+
+// SetSleepTimer stops playback at at, fading the volume out over the last minute.
+// With stopRecording an active recording is stopped as well; otherwise it keeps
+// its own connection. Setting the timer again replaces it.
+func (p *FFmpegPlayer) SetSleepTimer(at time.Time, stopRecording bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !at.After(time.Now()) {
+		return fmt.Errorf("タイマーの時刻が過ぎています")
+	}
+
+	p.cancelSleepLocked()
+	p.sleepAt.Store(at.UnixNano())
+	p.sleepStopRecording = stopRecording
+	p.sleepTimer = time.AfterFunc(time.Until(at), func() {
+		p.sleepExpired(at.UnixNano())
+	})
+	return nil
+}
+
+// CancelSleepTimer cancels the sleep timer, restoring the volume if it was fading
+func (p *FFmpegPlayer) CancelSleepTimer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancelSleepLocked()
+}
+
+// GetSleepTimer returns when the sleep timer stops playback and whether it stops
+// the recording too
+func (p *FFmpegPlayer) GetSleepTimer() (at time.Time, stopRecording bool, active bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nanos := p.sleepAt.Load()
+	if nanos == 0 {
+		return time.Time{}, false, false
+	}
+	return time.Unix(0, nanos), p.sleepStopRecording, true
+}
+
+// cancelSleepLocked stops the sleep timer. p.mu must be held.
+func (p *FFmpegPlayer) cancelSleepLocked() {
+	if p.sleepTimer != nil {
+		p.sleepTimer.Stop()
+		p.sleepTimer = nil
+	}
+	p.sleepAt.Store(0)
+}
+
+// sleepExpired stops playback (and the recording, if chosen) when the timer set
+// for at fires
+func (p *FFmpegPlayer) sleepExpired(at int64) {
+	p.mu.Lock()
+	if p.sleepAt.Load() != at {
+		// Cancelled or replaced meanwhile
+		p.mu.Unlock()
+		return
+	}
+	p.sleepTimer = nil
+	stopRecording := p.sleepStopRecording && p.recording
+	p.events.emit(Event{Type: EventSleepTimerExpired, StreamURL: p.streamURL})
+	p.mu.Unlock()
+
+	// The recording is stopped first, so that it does not move to a connection of its own
+	if stopRecording {
+		p.StopRecording()
+	}
+	// Stop clears the timer after the audio output is closed, so the faded volume
+	// is never restored while playing
+	p.Stop()
+}
+
+// sleepGain returns the fade-out gain of the sleep timer at now (1 = no fade).
+// It is read by VolumeReader without p.mu.
+func (p *FFmpegPlayer) sleepGain(now time.Time) float64 {
+	at := p.sleepAt.Load()
+	if at == 0 {
+		return 1
+	}
+	left := time.Duration(at - now.UnixNano())
+	if left >= sleepFade {
+		return 1
+	}
+	if left <= 0 {
+		return 0
+	}
+	// Quadratic, so that the fade sounds even rather than dropping at the end
+	g := float64(left) / float64(sleepFade)
+	return g * g
+}
@@ -0,0 +1,57 @@
+package player
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSleepGain(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	tests := []struct {
+		name string
+		left time.Duration // Until the timer fires
+		want float64
+	}{
+		{"before the fade", 2 * sleepFade, 1},
+		{"fade starts", sleepFade, 1},
+		{"three quarters left", sleepFade * 3 / 4, 0.5625},
+		{"halfway", sleepFade / 2, 0.25},
+		{"a quarter left", sleepFade / 4, 0.0625},
+		{"expired", 0, 0},
+		{"past the timer", -time.Second, 0},
+	}
+	p := NewPlayerWithPipeline("", 1, Pipeline{})
+	p.sleepAt.Store(at.UnixNano())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.sleepGain(at.Add(-tt.left)); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("sleepGain = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	p.sleepAt.Store(0)
+	if got := p.sleepGain(at); got != 1 {
+		t.Errorf("sleepGain without a timer = %v, want 1", got)
+	}
+}
+
+func TestCancelSleepTimerRestoresGain(t *testing.T) {
+	p := NewPlayerWithPipeline("", 1, Pipeline{})
+	at := time.Now().Add(sleepFade / 2)
+	if err := p.SetSleepTimer(at, false); err != nil {
+		t.Fatalf("SetSleepTimer: %v", err)
+	}
+	if got := p.sleepGain(time.Now()); got >= 0.5 {
+		t.Fatalf("sleepGain while fading = %v, want below 0.5", got)
+	}
+
+	p.CancelSleepTimer()
+	if got := p.sleepGain(time.Now()); got != 1 {
+		t.Errorf("sleepGain after cancelling = %v, want 1", got)
+	}
+	if _, _, active := p.GetSleepTimer(); active {
+		t.Error("sleep timer still active after cancelling")
+	}
+}
@@ -0,0 +1,176 @@
+package player
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"radiko-tui/internal/adts"
+)
+
+// timeshiftFrame is one ADTS frame of the compressed stream
+type timeshiftFrame struct {
+	data     []byte
+	at       time.Duration // Stream time at the start of the frame
+	duration time.Duration
+}
+
+// timeshiftBuffer keeps the last minutes of the compressed live stream (ADTS AAC),
+// split into frames so that playback can start at any point in stream time.
+// Stream time is the audio duration received since the buffer was created.
+type timeshiftBuffer struct {
+	mu       sync.Mutex
+	frames   []timeshiftFrame
+	first    int64         // Sequence number of frames[0]
+	end      time.Duration // Stream time after the last frame
+	capacity time.Duration
+	splitter adts.Splitter
+	notify   chan struct{} // Closed and replaced when frames are added
+}
+
+// newTimeshiftBuffer creates a buffer keeping capacity of audio
+func newTimeshiftBuffer(capacity time.Duration) *timeshiftBuffer {
+	return &timeshiftBuffer{
+		capacity: capacity,
+		notify:   make(chan struct{}),
+	}
+}
+
+// write splits data into ADTS frames and appends them, dropping frames older than the capacity
+func (b *timeshiftBuffer) write(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, frames := b.splitter.Split(data)
+	for _, frame := range frames {
+		b.frames = append(b.frames, timeshiftFrame{
+			data:     frame.Data,
+			at:       b.end,
+			duration: frame.Duration,
+		})
+		b.end += frame.Duration
+	}
+
+	// Drop frames that fell out of the buffer
+	drop := 0
+	for drop < len(b.frames) && b.end-b.frames[drop].at > b.capacity {
+		drop++
+	}
+	if drop > 0 {
+		b.frames = b.frames[drop:]
+		b.first += int64(drop)
+	}
+
+	if len(frames) > 0 {
+		close(b.notify)
+		b.notify = make(chan struct{})
+	}
+}
+
+// read returns the frames from sequence number seq on, waiting for new frames
+// if there are none yet. If seq was dropped, reading continues at the oldest frame.
+// It returns the sequence number to read next.
+func (b *timeshiftBuffer) read(ctx context.Context, seq int64) ([][]byte, int64, error) {
+	for {
+		b.mu.Lock()
+		if seq < b.first {
+			seq = b.first
+		}
+		if n := seq - b.first; n < int64(len(b.frames)) {
+			var frames [][]byte
+			for _, frame := range b.frames[n:] {
+				frames = append(frames, frame.data)
+			}
+			next := b.first + int64(len(b.frames))
+			b.mu.Unlock()
+			return frames, next, nil
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, seq, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// seek returns the sequence number and stream time of the frame playing at stream time t,
+// clamped to the buffered range
+func (b *timeshiftBuffer) seek(t time.Duration) (int64, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.frames) == 0 {
+		return b.first, b.end
+	}
+	if t <= b.frames[0].at {
+		return b.first, b.frames[0].at
+	}
+	for i, frame := range b.frames {
+		if t < frame.at+frame.duration {
+			return b.first + int64(i), frame.at
+		}
+	}
+	return b.first + int64(len(b.frames)), b.end
+}
+
+// bounds returns the stream time of the oldest buffered audio and of the live edge
+func (b *timeshiftBuffer) bounds() (start, end time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.frames) == 0 {
+		return b.end, b.end
+	}
+	return b.frames[0].at, b.end
+}
+
+// extract returns the frames between stream times from and to joined into one ADTS
+// stream, and the stream time range they cover
+func (b *timeshiftBuffer) extract(from, to time.Duration) (data []byte, start, end time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, end = -1, 0
+	for _, frame := range b.frames {
+		if frame.at+frame.duration <= from {
+			continue
+		}
+		if frame.at >= to {
+			break
+		}
+		if start < 0 {
+			start = frame.at
+		}
+		data = append(data, frame.data...)
+		end = frame.at + frame.duration
+	}
+	if start < 0 {
+		return nil, 0, 0
+	}
+	return data, start, end
+}
+
+// tail returns the frames from stream time from up to the live edge, followed by the
+// incomplete frame being received, so that the next chunk written to the buffer
+// continues it. It also returns the duration of the complete frames.
+func (b *timeshiftBuffer) tail(from time.Duration) ([]byte, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := 0
+	for i < len(b.frames) && b.frames[i].at+b.frames[i].duration <= from {
+		i++
+	}
+	var data []byte
+	for _, frame := range b.frames[i:] {
+		data = append(data, frame.data...)
+	}
+	var duration time.Duration
+	if i < len(b.frames) {
+		duration = b.end - b.frames[i].at
+	}
+	return append(data, b.splitter.Pending()...), duration
+}
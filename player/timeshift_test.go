@@ -0,0 +1,156 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"radiko-tui/internal/adts/adtstest"
+)
+
+// writeFrames writes n frames numbered from first, cutting the stream into uneven chunks
+func writeFrames(b *timeshiftBuffer, first, n int) {
+	var stream []byte
+	for i := range n {
+		stream = append(stream, adtstest.Frame(64+i%5, byte(first+i))...)
+	}
+	for len(stream) > 0 {
+		n := min(len(stream), 97)
+		b.write(stream[:n])
+		stream = stream[n:]
+	}
+}
+
+func TestTimeshiftSeek(t *testing.T) {
+	b := newTimeshiftBuffer(time.Minute)
+	writeFrames(b, 0, 10)
+
+	tests := []struct {
+		name    string
+		t       time.Duration
+		wantSeq int64
+		wantAt  time.Duration
+	}{
+		{"before the start", -time.Second, 0, 0},
+		{"start", 0, 0, 0},
+		{"inside a frame", 3*adtstest.FrameDuration + time.Millisecond, 3, 3 * adtstest.FrameDuration},
+		{"frame boundary", 5 * adtstest.FrameDuration, 5, 5 * adtstest.FrameDuration},
+		{"live edge", 10 * adtstest.FrameDuration, 10, 10 * adtstest.FrameDuration},
+		{"beyond live", time.Hour, 10, 10 * adtstest.FrameDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, at := b.seek(tt.t)
+			if seq != tt.wantSeq || at != tt.wantAt {
+				t.Errorf("seek(%v) = %d, %v, want %d, %v", tt.t, seq, at, tt.wantSeq, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestTimeshiftRead(t *testing.T) {
+	b := newTimeshiftBuffer(time.Minute)
+	writeFrames(b, 0, 4)
+
+	frames, next, err := b.read(context.Background(), 1)
+	if err != nil || len(frames) != 3 || next != 4 {
+		t.Fatalf("read(1) = %d frames, next %d, %v; want 3 frames, next 4", len(frames), next, err)
+	}
+	if frames[0][7] != 1 {
+		t.Errorf("first frame read is frame %d, want 1", frames[0][7])
+	}
+
+	// Waits for the next frame
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		writeFrames(b, 4, 1)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if frames, next, err := b.read(ctx, 4); err != nil || len(frames) != 1 || next != 5 {
+		t.Errorf("read(4) = %d frames, next %d, %v; want the new frame", len(frames), next, err)
+	}
+}
+
+func TestTimeshiftExtract(t *testing.T) {
+	b := newTimeshiftBuffer(time.Minute)
+	writeFrames(b, 0, 10)
+
+	tests := []struct {
+		name               string
+		from, to           time.Duration
+		wantFirst, wantLen int // Frames returned
+	}{
+		{"whole buffer", 0, time.Hour, 0, 10},
+		{"from inside a frame", 2*adtstest.FrameDuration + time.Millisecond, 5 * adtstest.FrameDuration, 2, 3},
+		{"to inside a frame", 2 * adtstest.FrameDuration, 5*adtstest.FrameDuration + time.Millisecond, 2, 4},
+		{"nothing buffered there", time.Hour, 2 * time.Hour, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, start, end := b.extract(tt.from, tt.to)
+			if tt.wantLen == 0 {
+				if data != nil {
+					t.Errorf("extract returned %d bytes, want none", len(data))
+				}
+				return
+			}
+			var want []byte
+			for i := tt.wantFirst; i < tt.wantFirst+tt.wantLen; i++ {
+				want = append(want, adtstest.Frame(64+i%5, byte(i))...)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("extract returned %d bytes, want frames %d-%d", len(data), tt.wantFirst, tt.wantFirst+tt.wantLen-1)
+			}
+			wantStart := time.Duration(tt.wantFirst) * adtstest.FrameDuration
+			if start != wantStart || end != wantStart+time.Duration(tt.wantLen)*adtstest.FrameDuration {
+				t.Errorf("range %v-%v, want %v-%v", start, end, wantStart, wantStart+time.Duration(tt.wantLen)*adtstest.FrameDuration)
+			}
+		})
+	}
+}
+
+func TestTimeshiftTail(t *testing.T) {
+	b := newTimeshiftBuffer(time.Minute)
+	writeFrames(b, 0, 6)
+	next := adtstest.Frame(80, 6)
+	b.write(next[:30])
+
+	data, duration := b.tail(4*adtstest.FrameDuration + time.Millisecond)
+	want := append(append(adtstest.Frame(64+4, 4), adtstest.Frame(64+0, 5)...), next[:30]...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("tail returned %d bytes, want frames 4-5 and the incomplete frame", len(data))
+	}
+	if duration != 2*adtstest.FrameDuration {
+		t.Errorf("tail duration %v, want %v", duration, 2*adtstest.FrameDuration)
+	}
+
+	// The incomplete frame is continued by the next chunk
+	b.write(next[30:])
+	if data, _, _ := b.extract(6*adtstest.FrameDuration, time.Hour); !bytes.Equal(data, next) {
+		t.Error("the frame completed after tail is not buffered whole")
+	}
+}
+
+func TestTimeshiftCapacity(t *testing.T) {
+	b := newTimeshiftBuffer(10 * adtstest.FrameDuration)
+	writeFrames(b, 0, 25)
+
+	start, end := b.bounds()
+	if end != 25*adtstest.FrameDuration || start != 15*adtstest.FrameDuration {
+		t.Errorf("bounds = %v-%v, want %v-%v", start, end, 15*adtstest.FrameDuration, 25*adtstest.FrameDuration)
+	}
+
+	// A reader behind the buffer continues at the oldest frame
+	frames, next, err := b.read(context.Background(), 3)
+	if err != nil || len(frames) != 10 || next != 25 {
+		t.Fatalf("read(3) = %d frames, next %d, %v; want the 10 kept frames", len(frames), next, err)
+	}
+	if frames[0][7] != 15 {
+		t.Errorf("oldest frame is %d, want 15", frames[0][7])
+	}
+	if seq, at := b.seek(0); seq != 15 || at != 15*adtstest.FrameDuration {
+		t.Errorf("seek(0) = %d, %v, want the oldest frame", seq, at)
+	}
+}
@@ -0,0 +1,166 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// upstreamChunkSize is the size of the reads from the upstream ffmpeg
+const upstreamChunkSize = 16 * 1024
+
+// upstream is a single connection to a Radiko stream. Every chunk of compressed
+// audio is handed to deliver, which fans it out to the playback decoder and the recording.
+type upstream struct {
+	streamURL string
+	authToken string // Auth token the connection was opened with
+	conn      SourceConn
+}
+
+// startUpstream connects to streamURL through source and calls deliver with each chunk read.
+// deliver is called from a single goroutine and must not keep the upstream waiting.
+func startUpstream(source StreamSource, streamURL, authToken string, deliver func(src *upstream, data []byte)) (*upstream, error) {
+	u := &upstream{
+		streamURL: streamURL,
+		authToken: authToken,
+	}
+	conn, err := source.Open(streamURL, authToken, func(data []byte) {
+		deliver(u, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.conn = conn
+	return u, nil
+}
+
+// stop disconnects the upstream. It does not wait, so it may be called with the player locked.
+func (u *upstream) stop() {
+	u.conn.Close()
+}
+
+// exited reports whether the connection has ended
+func (u *upstream) exited() bool {
+	select {
+	case <-u.conn.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// err returns why the connection ended (nil while connected)
+func (u *upstream) err() error {
+	if !u.exited() {
+		return nil
+	}
+	return u.conn.Err()
+}
+
+// FFmpegSource fetches streams with ffmpeg, copying the compressed audio without decoding
+type FFmpegSource struct{}
+
+// ffmpegConn is a stream fetched by an ffmpeg process
+type ffmpegConn struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when ffmpeg has exited and all data was delivered
+	err    error         // Set before done is closed
+}
+
+// Open starts ffmpeg on streamURL
+func (FFmpegSource) Open(streamURL, authToken string, deliver func(data []byte)) (SourceConn, error) {
+	if err := lookFFmpeg(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-headers", fmt.Sprintf("X-Radiko-AuthToken: %s", authToken),
+		"-i", streamURL,
+		"-vn",
+		"-c:a", "copy",
+		"-f", "adts",
+		"-loglevel", "error",
+		"pipe:1",
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	c := &ffmpegConn{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		for {
+			// A new buffer per read: sinks may still hold the previous chunk
+			buf := make([]byte, upstreamChunkSize)
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				deliver(buf[:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		err := cmd.Wait()
+		if ctx.Err() != nil {
+			// Closed by the player
+			return
+		}
+		if err != nil || stderr.String() != "" {
+			c.err = &FFmpegError{Stderr: stderr.String(), Err: err}
+		}
+	}()
+	return c, nil
+}
+
+// Close kills ffmpeg without waiting for it
+func (c *ffmpegConn) Close() {
+	c.cancel()
+}
+
+// Done is closed when ffmpeg has exited
+func (c *ffmpegConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error ffmpeg exited with
+func (c *ffmpegConn) Err() error {
+	return c.err
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(bytes.TrimSpace(b.buf))
+}
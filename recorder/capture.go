@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"radiko-tui/api"
+	"radiko-tui/config"
+	"radiko-tui/model"
+)
+
+// SanitizeFileName replaces characters that are invalid in file names
+func SanitizeFileName(name string) string {
+	for _, char := range []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|", " "} {
+		name = strings.ReplaceAll(name, char, "_")
+	}
+	return name
+}
+
+// reservationFilePath builds the output path of a reservation recording.
+// part is 1 for the first capture and increases when the capture is restarted.
+func reservationFilePath(r *Reservation, part int, format Format) string {
+	name := r.StationID
+	if r.Title != "" {
+		name += "_" + r.Title
+	}
+	filename := fmt.Sprintf("radiko_%s_%s", SanitizeFileName(name), r.Start.In(model.JST).Format("20060102_1504"))
+	if part > 1 {
+		filename += fmt.Sprintf("_part%d", part)
+	}
+	return filepath.Join(config.DownloadsDir(), filename+format.Extension())
+}
+
+// reservationMetadata builds the tags of a reservation recording and fetches its cover art.
+// The station name falls back to the station ID and the cover is skipped if unavailable.
+func reservationMetadata(r *Reservation, out OutputOptions) (Metadata, string) {
+	meta := Metadata{
+		Title:       r.Title,
+		Performer:   r.Performer,
+		Station:     r.StationID,
+		Date:        r.Start,
+		Description: r.Description,
+		ImageURL:    r.ImageURL,
+	}
+	if !out.Format.SupportsTags() {
+		return meta, ""
+	}
+
+	if info, err := api.GetStationInfo(r.StationID); err == nil && info.Name != "" {
+		meta.Station = info.Name
+	}
+
+	var coverPath string
+	if out.Format.SupportsCover() && r.ImageURL != "" {
+		coverPath, _ = FetchCover(r.ImageURL)
+	}
+	return meta, coverPath
+}
+
+// liveStreamURL authenticates for the station's area and returns its live stream URL and auth token
+func liveStreamURL(stationID string) (streamURL, authToken string, err error) {
+	areaID, err := api.GetStationArea(stationID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get station area: %w", err)
+	}
+
+	authToken = api.Auth(areaID)
+	if authToken == "" {
+		return "", "", fmt.Errorf("authentication failed")
+	}
+
+	playlistURLs, err := api.GetStreamURLs(stationID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get stream URL: %w", err)
+	}
+	if len(playlistURLs) == 0 {
+		return "", "", fmt.Errorf("no stream URLs found")
+	}
+
+	lsid := model.GenLsid()
+	lastURL := playlistURLs[len(playlistURLs)-1]
+	streamURL = fmt.Sprintf("%s?station_id=%s&l=30&lsid=%s&type=b", lastURL, stationID, lsid)
+	return streamURL, authToken, nil
+}
+
+// captureStream records the live stream of a station to filePath for at most duration.
+// It blocks until ffmpeg exits or ctx is cancelled.
+func captureStream(ctx context.Context, stationID, filePath string, duration time.Duration, out OutputOptions, meta Metadata, coverPath string) error {
+	streamURL, authToken, err := liveStreamURL(stationID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("ダウンロードフォルダの作成に失敗しました: %w", err)
+	}
+
+	args := []string{
+		"-loglevel", "error",
+		"-headers", fmt.Sprintf("X-Radiko-AuthToken: %s", authToken),
+		"-i", streamURL,
+	}
+	args = append(args, CoverInputArgs(out, coverPath)...)
+	args = append(args, "-t", fmt.Sprintf("%d", int(duration.Seconds())))
+	args = append(args, OutputArgs(out, meta, coverPath, filePath)...)
+
+	cmd, err := NewRecordCommand(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("録音の開始に失敗しました: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("録音の開始に失敗しました: %w", err)
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,296 @@
+package recorder
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"radiko-tui/config"
+	"radiko-tui/model"
+)
+
+// Format is the container/codec of a recording file
+type Format string
+
+const (
+	FormatAAC  Format = "aac"  // Raw ADTS AAC (no tags, no seek index)
+	FormatM4A  Format = "m4a"  // AAC in MP4
+	FormatMP3  Format = "mp3"  // MP3 with ID3 tags
+	FormatOpus Format = "opus" // Opus in Ogg
+	FormatFLAC Format = "flac" // FLAC (lossless copy of the decoded audio)
+)
+
+// ParseFormat parses a format name, defaulting to FormatAAC for an empty string
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(s, "."))); f {
+	case "":
+		return FormatAAC, nil
+	case FormatAAC, FormatM4A, FormatMP3, FormatOpus, FormatFLAC:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported recording format: %s", s)
+	}
+}
+
+// Extension returns the file extension of the format, including the dot
+func (f Format) Extension() string {
+	if f == "" {
+		return ".aac"
+	}
+	return "." + string(f)
+}
+
+// SupportsTags reports whether the container can carry metadata tags
+func (f Format) SupportsTags() bool {
+	return f != FormatAAC && f != ""
+}
+
+// SupportsCover reports whether the container can embed cover art
+func (f Format) SupportsCover() bool {
+	return f == FormatM4A || f == FormatMP3 || f == FormatFLAC
+}
+
+// OutputOptions controls the codec and container of a recording
+type OutputOptions struct {
+	Format  Format
+	Copy    bool   // Keep the original AAC stream without re-encoding (aac and m4a only)
+	Bitrate string // Bitrate of lossy re-encoding, e.g. "128k" (format default if empty)
+}
+
+// OutputOptionsFromConfig converts the recording config to output options.
+// An unknown format falls back to AAC.
+func OutputOptionsFromConfig(cfg config.RecordingConfig) OutputOptions {
+	format, err := ParseFormat(cfg.Format)
+	if err != nil {
+		format = FormatAAC
+	}
+	return OutputOptions{
+		Format:  format,
+		Copy:    cfg.Copy,
+		Bitrate: cfg.Bitrate,
+	}
+}
+
+// Metadata holds the tags written to a recording file
+type Metadata struct {
+	Title       string    // Program title
+	Performer   string    // Host/Performer
+	Station     string    // Station name
+	Date        time.Time // Broadcast date
+	Description string    // Program description (plain text)
+	ImageURL    string    // Program image, embedded as cover art when possible
+	Gaps        []Gap     // Missing spans, reported in the comment tag
+}
+
+// comment returns the comment tag: the description followed by the missing spans
+func (m Metadata) comment() string {
+	if len(m.Gaps) == 0 {
+		return m.Description
+	}
+	var gaps, deadAir []string
+	for _, gap := range m.Gaps {
+		if gap.DeadAir {
+			deadAir = append(deadAir, gap.String())
+		} else {
+			gaps = append(gaps, gap.String())
+		}
+	}
+	var notes []string
+	if len(gaps) > 0 {
+		notes = append(notes, "録音欠落: "+strings.Join(gaps, ", "))
+	}
+	if len(deadAir) > 0 {
+		notes = append(notes, "無音・ループ: "+strings.Join(deadAir, ", "))
+	}
+	note := strings.Join(notes, "\n")
+	if m.Description == "" {
+		return note
+	}
+	return m.Description + "\n" + note
+}
+
+// MetadataFromProgram builds recording metadata from a guide program
+func MetadataFromProgram(prog *model.GuideProgram, stationName string) Metadata {
+	if prog == nil {
+		return Metadata{Station: stationName, Date: time.Now()}
+	}
+	return Metadata{
+		Title:       prog.Title,
+		Performer:   prog.Performer,
+		Station:     stationName,
+		Date:        prog.Start,
+		Description: prog.PlainDescription(),
+		ImageURL:    prog.ImageURL,
+	}
+}
+
+// codecArgs returns the ffmpeg audio codec arguments of the output options
+func (o OutputOptions) codecArgs() []string {
+	canCopy := o.Format == FormatAAC || o.Format == FormatM4A || o.Format == ""
+	if o.Copy && canCopy {
+		args := []string{"-c:a", "copy"}
+		if o.Format == FormatM4A {
+			// HLS carries ADTS AAC, MP4 needs the AudioSpecificConfig
+			args = append(args, "-bsf:a", "aac_adtstoasc")
+		}
+		return args
+	}
+
+	bitrate := func(def string) string {
+		if o.Bitrate != "" {
+			return o.Bitrate
+		}
+		return def
+	}
+
+	switch o.Format {
+	case FormatMP3:
+		return []string{"-c:a", "libmp3lame", "-b:a", bitrate("128k")}
+	case FormatOpus:
+		return []string{"-c:a", "libopus", "-b:a", bitrate("64k")}
+	case FormatFLAC:
+		return []string{"-c:a", "flac"}
+	default:
+		return []string{"-c:a", "aac", "-b:a", bitrate("128k")}
+	}
+}
+
+// OutputArgs returns the ffmpeg arguments that write the audio of input 0 to filePath
+// with the given tags. If coverPath is not empty it must be passed as input 1 and is
+// embedded as cover art.
+func OutputArgs(out OutputOptions, meta Metadata, coverPath, filePath string) []string {
+	return outputArgs(out, out.codecArgs(), meta, coverPath, filePath)
+}
+
+// outputArgs returns the ffmpeg output arguments with the given audio codec arguments
+func outputArgs(out OutputOptions, codecArgs []string, meta Metadata, coverPath, filePath string) []string {
+	var args []string
+
+	if coverPath != "" && out.Format.SupportsCover() {
+		args = append(args, "-map", "0:a", "-map", "1:v", "-c:v", "copy", "-disposition:v:0", "attached_pic")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+	args = append(args, codecArgs...)
+
+	if out.Format.SupportsTags() {
+		tags := []struct{ key, value string }{
+			{"title", meta.Title},
+			{"artist", meta.Performer},
+			{"album_artist", meta.Performer},
+			{"album", meta.Station},
+			{"genre", "Radio"},
+			{"comment", meta.comment()},
+			{"description", meta.Description},
+		}
+		if !meta.Date.IsZero() {
+			tags = append(tags, struct{ key, value string }{"date", meta.Date.In(model.JST).Format("2006-01-02")})
+		}
+		for _, tag := range tags {
+			if tag.value != "" {
+				args = append(args, "-metadata", fmt.Sprintf("%s=%s", tag.key, tag.value))
+			}
+		}
+	}
+
+	switch out.Format {
+	case FormatM4A:
+		args = append(args, "-movflags", "+faststart")
+	case FormatMP3:
+		args = append(args, "-id3v2_version", "3")
+	case FormatAAC, "":
+		args = append(args, "-f", "adts")
+	}
+
+	return append(args, "-y", filePath)
+}
+
+// CoverInputArgs returns the ffmpeg input arguments of a cover image, if the format embeds one
+func CoverInputArgs(out OutputOptions, coverPath string) []string {
+	if coverPath == "" || !out.Format.SupportsCover() {
+		return nil
+	}
+	return []string{"-i", coverPath}
+}
+
+// NewRecordCommand creates an ffmpeg command that is stopped gracefully when ctx is
+// cancelled, so that containers with an index (m4a, flac) are finalized.
+// ffmpeg is killed if it does not exit within a few seconds.
+func NewRecordCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	cmd.Cancel = func() error {
+		// "q" asks ffmpeg to stop and write the trailer
+		_, err := io.WriteString(stdin, "q")
+		return err
+	}
+	cmd.WaitDelay = 10 * time.Second
+	return cmd, nil
+}
+
+var (
+	coverMu    sync.Mutex
+	coverCache = make(map[string]string) // Image URL -> local file
+)
+
+// FetchCover downloads a program image to the temp directory and returns its path.
+// Images are cached for the lifetime of the process.
+func FetchCover(imageURL string) (string, error) {
+	if imageURL == "" {
+		return "", fmt.Errorf("no image")
+	}
+
+	coverMu.Lock()
+	defer coverMu.Unlock()
+
+	if p, ok := coverCache[imageURL]; ok {
+		return p, nil
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch cover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch cover: status code %d", resp.StatusCode)
+	}
+
+	ext := strings.ToLower(path.Ext(strings.SplitN(imageURL, "?", 2)[0]))
+	if ext != ".png" {
+		ext = ".jpg"
+	}
+	sum := sha1.Sum([]byte(imageURL))
+	filePath := filepath.Join(os.TempDir(), "radiko-cover-"+hex.EncodeToString(sum[:8])+ext)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(filePath)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	coverCache[imageURL] = filePath
+	return filePath, nil
+}
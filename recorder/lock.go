@@ -0,0 +1,51 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"radiko-tui/config"
+)
+
+// ErrLocked is returned by NewScheduler, and by the changes to reservations and rules
+// of the scheduler it returned, while another process runs the reservations
+var ErrLocked = errors.New("別のプロセスが録音予約を実行中です")
+
+// storeLock is an exclusive lock on the reservation store. Only the process holding
+// it runs and changes reservations, so that two schedulers never capture the same
+// program or overwrite each other's reservations.json.
+type storeLock struct {
+	f *os.File
+}
+
+// lockStore takes the store lock, failing with ErrLocked if another process holds it
+func lockStore() (*storeLock, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "reservations.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// The PID is only informative: the lock ends with the process
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return &storeLock{f: f}, nil
+}
+
+// unlock releases the lock
+func (l *storeLock) unlock() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.f)
+	l.f.Close()
+}
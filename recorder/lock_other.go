@@ -0,0 +1,12 @@
+//go:build !unix
+
+package recorder
+
+import "os"
+
+// tryLockFile does not lock where flock is unavailable: every process runs reservations
+func tryLockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) {}
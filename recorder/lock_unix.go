@@ -0,0 +1,22 @@
+//go:build unix
+
+package recorder
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLockFile locks f exclusively without waiting
+func tryLockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
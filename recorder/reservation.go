@@ -0,0 +1,114 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"radiko-tui/config"
+)
+
+// ReservationStatus represents the state of a recording reservation
+type ReservationStatus string
+
+const (
+	StatusScheduled ReservationStatus = "scheduled" // Waiting for the start time
+	StatusRecording ReservationStatus = "recording" // Capture in progress
+	StatusCompleted ReservationStatus = "completed" // Recorded until the end time
+	StatusFailed    ReservationStatus = "failed"    // Capture could not be started or was cut short
+	StatusMissed    ReservationStatus = "missed"    // End time passed while the scheduler was not running
+	StatusCancelled ReservationStatus = "cancelled" // Cancelled by the user (kept so that rules do not re-add it)
+)
+
+// Reservation is a scheduled recording of a station for a time range
+type Reservation struct {
+	ID          string            `json:"id"`
+	StationID   string            `json:"station_id"`
+	ProgramID   string            `json:"program_id,omitempty"` // Set when reserved from the program guide
+	RuleID      string            `json:"rule_id,omitempty"`    // Set when reserved by an auto-recording rule
+	Title       string            `json:"title,omitempty"`
+	Performer   string            `json:"performer,omitempty"`
+	Description string            `json:"description,omitempty"` // Plain text, written to the file's tags
+	ImageURL    string            `json:"image_url,omitempty"`   // Program image, embedded as cover art
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Status      ReservationStatus `json:"status"`
+	Files       []string          `json:"files,omitempty"` // Recorded files (several if the capture was restarted)
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt time.Time         `json:"completed_at,omitempty"`
+}
+
+// reservationID builds the ID of a reservation, unique per station and start time
+func reservationID(stationID string, start time.Time) string {
+	return fmt.Sprintf("%s-%d", stationID, start.Unix())
+}
+
+// IsActive reports whether the reservation is waiting or recording
+func (r Reservation) IsActive() bool {
+	return r.Status == StatusScheduled || r.Status == StatusRecording
+}
+
+// historyRetention is how long finished reservations are kept in the store
+const historyRetention = 7 * 24 * time.Hour
+
+// getStorePath returns the reservations file path in the config directory
+func getStorePath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "reservations.json"), nil
+}
+
+// loadReservations loads saved reservations, dropping old finished ones
+func loadReservations() ([]*Reservation, error) {
+	path, err := getStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var all []*Reservation
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	reservations := make([]*Reservation, 0, len(all))
+	for _, r := range all {
+		if !r.IsActive() && now.Sub(r.End) > historyRetention {
+			continue
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// saveReservations writes reservations to the store atomically
+func saveReservations(reservations []*Reservation) error {
+	path, err := getStorePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,222 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"radiko-tui/api"
+	"radiko-tui/config"
+	"radiko-tui/model"
+)
+
+// Rule automatically reserves programs whose title or performer match.
+// A rule applies to the listed stations and to every station of the listed areas.
+type Rule struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Keyword    string   `json:"keyword,omitempty"`     // Contained in the program title
+	Performer  string   `json:"performer,omitempty"`   // Contained in the program performer
+	StationIDs []string `json:"station_ids,omitempty"` // e.g. ["TBS"]
+	AreaIDs    []string `json:"area_ids,omitempty"`    // e.g. ["JP13"]
+	Disabled   bool     `json:"disabled,omitempty"`
+}
+
+// RuleMatch is an upcoming program matching a rule
+type RuleMatch struct {
+	Rule    Rule               `json:"rule"`
+	Program model.GuideProgram `json:"program"`
+}
+
+// Validate checks that the rule has a condition and a target
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.Keyword) == "" && strings.TrimSpace(r.Performer) == "" {
+		return fmt.Errorf("キーワードまたは出演者を指定してください")
+	}
+	if len(r.StationIDs) == 0 && len(r.AreaIDs) == 0 {
+		return fmt.Errorf("放送局またはエリアを指定してください")
+	}
+	return nil
+}
+
+// Matches reports whether a program matches the rule's keyword and performer.
+// Matching ignores case and whitespace (including full-width spaces).
+func (r Rule) Matches(prog model.GuideProgram) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.Keyword == "" && r.Performer == "" {
+		return false
+	}
+	if r.Keyword != "" && !strings.Contains(normalizeMatchText(prog.Title), normalizeMatchText(r.Keyword)) {
+		return false
+	}
+	if r.Performer != "" && !strings.Contains(normalizeMatchText(prog.Performer), normalizeMatchText(r.Performer)) {
+		return false
+	}
+	return true
+}
+
+// normalizeMatchText lowercases s and removes whitespace
+func normalizeMatchText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// appliesTo reports whether the rule targets a station, given the stations of each area
+func (r Rule) appliesTo(stationID string, areaStations map[string][]string) bool {
+	for _, id := range r.StationIDs {
+		if id == stationID {
+			return true
+		}
+	}
+	for _, areaID := range r.AreaIDs {
+		for _, id := range areaStations[areaID] {
+			if id == stationID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getRulesPath returns the rules file path in the config directory
+func getRulesPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rules.json"), nil
+}
+
+// loadRules loads the auto-recording rules
+func loadRules() ([]Rule, error) {
+	path, err := getRulesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// saveRules writes the auto-recording rules
+func saveRules(rules []Rule) error {
+	path, err := getRulesPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// findRuleMatches fetches the upcoming guide of every station targeted by the rules
+// and returns the matching programs sorted by start time.
+// areaStations is filled with the stations of each area used by the rules.
+func findRuleMatches(rules []Rule, areaStations map[string][]string) ([]RuleMatch, error) {
+	if err := resolveAreaStations(rules, areaStations); err != nil {
+		return nil, err
+	}
+
+	stationSet := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		for _, id := range rule.StationIDs {
+			stationSet[id] = true
+		}
+		for _, areaID := range rule.AreaIDs {
+			for _, id := range areaStations[areaID] {
+				stationSet[id] = true
+			}
+		}
+	}
+
+	now := time.Now()
+	var matches []RuleMatch
+	var lastErr error
+	for stationID := range stationSet {
+		guide, err := api.GetWeeklyGuide(stationID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		matches = append(matches, matchGuide(rules, guide, areaStations, now)...)
+	}
+
+	if len(matches) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Program.Start.Before(matches[j].Program.Start)
+	})
+	return matches, nil
+}
+
+// resolveAreaStations adds the station IDs of each area used by the rules that
+// areaStations does not hold yet
+func resolveAreaStations(rules []Rule, areaStations map[string][]string) error {
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		for _, areaID := range rule.AreaIDs {
+			if _, ok := areaStations[areaID]; ok {
+				continue
+			}
+			stations, err := api.GetStations(areaID)
+			if err != nil {
+				return err
+			}
+			ids := make([]string, 0, len(stations))
+			for _, st := range stations {
+				ids = append(ids, st.ID)
+			}
+			areaStations[areaID] = ids
+		}
+	}
+	return nil
+}
+
+// matchGuide returns the programs of a guide that match a rule and have not finished at now
+func matchGuide(rules []Rule, guide []model.GuideProgram, areaStations map[string][]string, now time.Time) []RuleMatch {
+	var matches []RuleMatch
+	for _, prog := range guide {
+		if prog.IsPast(now) {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.appliesTo(prog.StationID, areaStations) && rule.Matches(prog) {
+				matches = append(matches, RuleMatch{Rule: rule, Program: prog})
+				break
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,685 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"radiko-tui/api"
+	"radiko-tui/model"
+)
+
+const (
+	startMargin         = 15 * time.Second // Start capturing a little before the program begins
+	endMargin           = 60 * time.Second // Keep capturing after the end to cover the stream delay
+	checkInterval       = 5 * time.Second  // How often reservations are checked
+	maxCaptureRestarts  = 5                // Restarts allowed when ffmpeg exits before the end time
+	ruleRefreshInterval = time.Hour        // How often the guide is refreshed for auto-recording rules
+)
+
+// Scheduler starts and stops recording reservations in the background.
+// Each reservation is captured by its own ffmpeg process, independently of playback.
+type Scheduler struct {
+	mu           sync.Mutex
+	reservations []*Reservation
+	captures     map[string]context.CancelFunc // Active captures by reservation ID
+	rules        []Rule
+	areaStations map[string][]string // Station IDs of each area used by rules
+	evaluating   bool                // Rule evaluation in progress
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	started      bool
+	logf         func(format string, args ...any)
+	output       OutputOptions // Codec/container of recordings
+	lock         *storeLock    // Held while this process runs the reservations
+	readOnly     bool          // Another process runs the reservations
+	stopped      bool          // Stop released the lock: nothing is saved any more
+}
+
+// ErrStopped is returned by the changes to reservations once the scheduler is stopped
+var ErrStopped = errors.New("録音予約は停止しています")
+
+// NewScheduler creates a scheduler with the reservations saved in the config directory.
+// If loading fails, an empty scheduler is returned together with the error.
+// While another process runs the reservations, the scheduler is returned with
+// ErrLocked: it only shows the saved reservations until that process exits.
+func NewScheduler() (*Scheduler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		captures:     make(map[string]context.CancelFunc),
+		areaStations: make(map[string][]string),
+		ctx:          ctx,
+		cancel:       cancel,
+		logf:         func(string, ...any) {},
+		output:       OutputOptions{Format: FormatAAC},
+	}
+
+	lock, lockErr := lockStore()
+	if errors.Is(lockErr, ErrLocked) {
+		s.readOnly = true
+	} else if lockErr != nil {
+		return s, fmt.Errorf("failed to lock reservations: %w", lockErr)
+	}
+	s.lock = lock
+
+	rules, err := loadRules()
+	if err != nil {
+		return s, fmt.Errorf("failed to load rules: %w", err)
+	}
+	s.rules = rules
+
+	reservations, err := loadReservations()
+	if err != nil {
+		return s, err
+	}
+
+	if s.readOnly {
+		s.reservations = reservations
+		return s, ErrLocked
+	}
+	s.reservations = resumeInterrupted(reservations)
+	return s, nil
+}
+
+// resumeInterrupted schedules again the reservations a previous shutdown interrupted,
+// so that the next check resumes them
+func resumeInterrupted(reservations []*Reservation) []*Reservation {
+	for _, r := range reservations {
+		if r.Status == StatusRecording {
+			r.Status = StatusScheduled
+		}
+	}
+	return reservations
+}
+
+// SetLogger sets the function used to report scheduler activity (silent by default)
+func (s *Scheduler) SetLogger(logf func(format string, args ...any)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logf = logf
+}
+
+// SetOutputOptions sets the codec and container of recordings started from now on
+func (s *Scheduler) SetOutputOptions(out OutputOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.output = out
+}
+
+// Start starts the background scheduler loop
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	go s.run()
+}
+
+// Stop stops the scheduler and all active captures, and lets another process run
+// the reservations. Reservations that were recording are resumed the next time
+// the scheduler starts.
+func (s *Scheduler) Stop() {
+	// Cancelled under s.mu, so that no goroutine joins s.wg after the wait began
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.lock.unlock()
+	s.lock = nil
+}
+
+// run checks reservations periodically until the scheduler is stopped
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	if !s.follow(ticker) {
+		return
+	}
+	rulesTicker := time.NewTicker(ruleRefreshInterval)
+	defer rulesTicker.Stop()
+
+	s.check()
+	s.mu.Lock()
+	s.refreshRulesLocked()
+	s.mu.Unlock()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.check()
+		case <-rulesTicker.C:
+			s.mu.Lock()
+			s.refreshRulesLocked()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// follow reloads what the process running the reservations saves until that
+// process exits, then takes the lock over. It returns false if the scheduler was
+// stopped first, and at once if this process runs the reservations.
+func (s *Scheduler) follow(ticker *time.Ticker) bool {
+	for {
+		s.mu.Lock()
+		readOnly := s.readOnly
+		s.mu.Unlock()
+		if !readOnly {
+			return true
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		lock, lockErr := lockStore()
+		reservations, err := loadReservations()
+		rules, rulesErr := loadRules()
+
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			s.mu.Unlock()
+			lock.unlock()
+			return false
+		}
+		if err == nil {
+			s.reservations = reservations
+		}
+		if rulesErr == nil {
+			s.rules = rules
+		}
+		if lockErr == nil {
+			s.lock = lock
+			s.readOnly = false
+			s.reservations = resumeInterrupted(s.reservations)
+			s.logf("⏰ 録音予約の実行を引き継ぎました")
+		}
+		s.mu.Unlock()
+	}
+}
+
+// refreshRulesLocked starts refreshRules in the background, unless the scheduler is
+// stopping. Stop waits for it. s.mu must be held.
+func (s *Scheduler) refreshRulesLocked() {
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.refreshRules()
+	}()
+}
+
+// refreshRules refreshes the guide and reserves new rule matches
+func (s *Scheduler) refreshRules() {
+	added, err := s.EvaluateRules()
+	if err != nil {
+		s.mu.Lock()
+		s.logf("❌ 自動録音ルールの評価に失敗しました: %v", err)
+		s.mu.Unlock()
+		return
+	}
+	if added > 0 {
+		s.mu.Lock()
+		s.logf("⏰ 自動録音ルール: %d件予約しました", added)
+		s.mu.Unlock()
+	}
+}
+
+// check starts captures that are due and marks reservations whose end time passed
+func (s *Scheduler) check() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	changed := false
+	for _, r := range s.reservations {
+		if r.Status != StatusScheduled {
+			continue
+		}
+		if !now.Before(r.End) {
+			r.Status = StatusMissed
+			changed = true
+			s.logf("⏰ 予約録音を逃しました: %s %s", r.StationID, r.Title)
+			continue
+		}
+		if now.Before(r.Start.Add(-startMargin)) {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.captures[r.ID] = cancel
+		r.Status = StatusRecording
+		r.Error = ""
+		changed = true
+		s.logf("⏺ 予約録音開始: %s %s", r.StationID, r.Title)
+
+		s.wg.Add(1)
+		go s.record(ctx, r)
+	}
+
+	if changed {
+		s.saveLocked()
+	}
+}
+
+// record captures a reservation until its end time, restarting ffmpeg if it exits early
+func (s *Scheduler) record(ctx context.Context, r *Reservation) {
+	defer s.wg.Done()
+
+	until := r.End.Add(endMargin)
+	s.mu.Lock()
+	part := len(r.Files) + 1
+	out := s.output
+	s.mu.Unlock()
+
+	meta, coverPath := reservationMetadata(r, out)
+
+	var lastErr error
+	for restarts := 0; ; restarts++ {
+		remaining := time.Until(until)
+		if remaining <= checkInterval {
+			lastErr = nil
+			break
+		}
+
+		filePath := reservationFilePath(r, part, out.Format)
+		err := captureStream(ctx, r.StationID, filePath, remaining, out, meta, coverPath)
+		if _, statErr := os.Stat(filePath); statErr == nil {
+			s.mu.Lock()
+			r.Files = append(r.Files, filePath)
+			s.mu.Unlock()
+			part++
+		}
+
+		if ctx.Err() != nil || time.Until(until) <= checkInterval {
+			lastErr = nil
+			break
+		}
+
+		if err == nil {
+			err = fmt.Errorf("stream ended before the end time")
+		}
+		lastErr = err
+		s.logf("⚠ 予約録音が中断されました [%s]: %v", r.StationID, err)
+
+		if restarts >= maxCaptureRestarts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(checkInterval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	s.finish(ctx, r, lastErr)
+}
+
+// finish updates the status of a reservation after its capture ended
+func (s *Scheduler) finish(ctx context.Context, r *Reservation, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.captures, r.ID)
+
+	switch {
+	case s.ctx.Err() != nil && time.Now().Before(r.End):
+		// Scheduler shutdown: resume next time
+		r.Status = StatusScheduled
+	case ctx.Err() != nil && s.ctx.Err() == nil:
+		// Cancelled by Remove, keep the files recorded so far
+	case err != nil:
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		r.CompletedAt = time.Now()
+		s.logf("❌ 予約録音失敗: %s %s: %v", r.StationID, r.Title, err)
+	default:
+		r.Status = StatusCompleted
+		r.CompletedAt = time.Now()
+		s.logf("✓ 予約録音完了: %s %s", r.StationID, r.Title)
+	}
+
+	s.saveLocked()
+}
+
+// saveLocked persists reservations. Once the scheduler is stopped another process
+// may hold the lock, so nothing is saved. s.mu must be held.
+func (s *Scheduler) saveLocked() {
+	if s.stopped {
+		return
+	}
+	if err := saveReservations(s.reservations); err != nil {
+		s.logf("❌ 予約の保存に失敗しました: %v", err)
+	}
+}
+
+// Add reserves a recording of a station between start and end
+func (s *Scheduler) Add(stationID, title string, start, end time.Time) (Reservation, error) {
+	return s.add(&Reservation{
+		StationID: stationID,
+		Title:     title,
+		Start:     start.In(model.JST),
+		End:       end.In(model.JST),
+	})
+}
+
+// AddProgram reserves a recording of a program from the program guide
+func (s *Scheduler) AddProgram(prog model.GuideProgram) (Reservation, error) {
+	return s.add(&Reservation{
+		StationID:   prog.StationID,
+		ProgramID:   prog.ID,
+		Title:       prog.Title,
+		Performer:   prog.Performer,
+		Description: prog.PlainDescription(),
+		ImageURL:    prog.ImageURL,
+		Start:       prog.Start,
+		End:         prog.End,
+	})
+}
+
+// AddProgramID looks up a program ID in the station's guide and reserves it
+func (s *Scheduler) AddProgramID(stationID, programID string) (Reservation, error) {
+	prog, err := api.FindProgram(stationID, programID)
+	if err != nil {
+		return Reservation{}, err
+	}
+	return s.AddProgram(*prog)
+}
+
+// add validates and stores a new reservation
+func (s *Scheduler) add(r *Reservation) (Reservation, error) {
+	if r.StationID == "" {
+		return Reservation{}, fmt.Errorf("放送局が指定されていません")
+	}
+	if !r.End.After(r.Start) {
+		return Reservation{}, fmt.Errorf("終了時刻は開始時刻より後にしてください")
+	}
+	if !r.End.After(time.Now()) {
+		return Reservation{}, fmt.Errorf("既に終了した番組は予約できません")
+	}
+
+	r.ID = reservationID(r.StationID, r.Start)
+	r.Status = StatusScheduled
+	r.CreatedAt = time.Now()
+
+	s.mu.Lock()
+	if s.readOnly {
+		s.mu.Unlock()
+		return Reservation{}, ErrLocked
+	}
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return Reservation{}, ErrStopped
+	}
+	for i, existing := range s.reservations {
+		if existing.ID != r.ID {
+			continue
+		}
+		if existing.IsActive() {
+			s.mu.Unlock()
+			return Reservation{}, fmt.Errorf("既に予約されています")
+		}
+		// Replace a finished reservation of the same slot
+		s.reservations = append(s.reservations[:i], s.reservations[i+1:]...)
+		break
+	}
+	s.reservations = append(s.reservations, r)
+	s.saveLocked()
+	added := *r
+	started := s.started
+	s.mu.Unlock()
+
+	if started {
+		s.check()
+	}
+	return added, nil
+}
+
+// Remove cancels a reservation, stopping its capture if it is recording.
+// The reservation is kept as cancelled so that rules do not reserve it again.
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrLocked
+	}
+	if s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	for _, r := range s.reservations {
+		if r.ID != id {
+			continue
+		}
+		if cancel, ok := s.captures[id]; ok {
+			cancel()
+			delete(s.captures, id)
+		}
+		if r.IsActive() {
+			r.Status = StatusCancelled
+			r.CompletedAt = time.Now()
+		}
+		s.saveLocked()
+		return nil
+	}
+	return fmt.Errorf("予約が見つかりません: %s", id)
+}
+
+// List returns all reservations sorted by start time
+func (s *Scheduler) List() []Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Reservation, 0, len(s.reservations))
+	for _, r := range s.reservations {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
+
+// Find returns the reservation of a station starting at start
+func (s *Scheduler) Find(stationID string, start time.Time) (Reservation, bool) {
+	id := reservationID(stationID, start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.reservations {
+		if r.ID == id {
+			return *r, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// Recording returns the reservations currently being recorded
+func (s *Scheduler) Recording() []Reservation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Reservation
+	for _, r := range s.reservations {
+		if r.Status == StatusRecording {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+// Rules returns the auto-recording rules
+func (s *Scheduler) Rules() []Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Rule(nil), s.rules...)
+}
+
+// AddRule adds an auto-recording rule and reserves its matches in the background
+func (s *Scheduler) AddRule(rule Rule) (Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+	rule.ID = fmt.Sprintf("rule-%d", time.Now().UnixNano())
+	if rule.Name == "" {
+		rule.Name = rule.Keyword + rule.Performer
+	}
+
+	s.mu.Lock()
+	if s.readOnly {
+		s.mu.Unlock()
+		return Rule{}, ErrLocked
+	}
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return Rule{}, ErrStopped
+	}
+	s.rules = append(s.rules, rule)
+	err := saveRules(s.rules)
+	if err == nil && s.started {
+		s.refreshRulesLocked()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return Rule{}, fmt.Errorf("failed to save rules: %w", err)
+	}
+	return rule, nil
+}
+
+// RemoveRule removes an auto-recording rule. Reservations it already made are kept.
+func (s *Scheduler) RemoveRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrLocked
+	}
+	if s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	for i, rule := range s.rules {
+		if rule.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return saveRules(s.rules)
+		}
+	}
+	return fmt.Errorf("ルールが見つかりません: %s", id)
+}
+
+// PreviewRules returns the upcoming programs matching the rules without reserving them
+func (s *Scheduler) PreviewRules() ([]RuleMatch, error) {
+	s.mu.Lock()
+	rules := append([]Rule(nil), s.rules...)
+	areaStations := make(map[string][]string)
+	s.mu.Unlock()
+
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	matches, err := findRuleMatches(rules, areaStations)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.areaStations = areaStations
+	s.mu.Unlock()
+	return matches, nil
+}
+
+// EvaluateRules refreshes the guide of the stations targeted by the rules
+// and reserves new matches. It returns the number of reservations added.
+func (s *Scheduler) EvaluateRules() (int, error) {
+	s.mu.Lock()
+	if s.evaluating {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	s.evaluating = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.evaluating = false
+		s.mu.Unlock()
+	}()
+
+	matches, err := s.PreviewRules()
+	if err != nil {
+		return 0, err
+	}
+	return s.addRuleMatches(matches), nil
+}
+
+// EvaluateGuide reserves the programs of a freshly loaded guide that match a rule.
+// It returns the number of reservations added. It may fetch the stations of the
+// areas the rules use, so it must not run on the UI goroutine.
+func (s *Scheduler) EvaluateGuide(guide []model.GuideProgram) (int, error) {
+	s.mu.Lock()
+	rules := append([]Rule(nil), s.rules...)
+	areaStations := maps.Clone(s.areaStations)
+	s.mu.Unlock()
+
+	// Areas are resolved by the hourly evaluation; a guide loaded before it needs them now
+	if err := resolveAreaStations(rules, areaStations); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	maps.Copy(s.areaStations, areaStations)
+	s.mu.Unlock()
+
+	return s.addRuleMatches(matchGuide(rules, guide, areaStations, time.Now())), nil
+}
+
+// addRuleMatches reserves rule matches, skipping slots that were already reserved or cancelled
+func (s *Scheduler) addRuleMatches(matches []RuleMatch) int {
+	added := 0
+	for _, match := range matches {
+		if _, exists := s.Find(match.Program.StationID, match.Program.Start); exists {
+			continue
+		}
+		prog := match.Program
+		_, err := s.add(&Reservation{
+			StationID:   prog.StationID,
+			ProgramID:   prog.ID,
+			RuleID:      match.Rule.ID,
+			Title:       prog.Title,
+			Performer:   prog.Performer,
+			Description: prog.PlainDescription(),
+			ImageURL:    prog.ImageURL,
+			Start:       prog.Start,
+			End:         prog.End,
+		})
+		if err == nil {
+			added++
+		}
+	}
+	return added
+}
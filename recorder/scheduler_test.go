@@ -0,0 +1,92 @@
+package recorder
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedulerStoreLock(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	first, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("first NewScheduler: %v", err)
+	}
+	start := time.Now().Add(time.Hour)
+	if _, err := first.Add("TBS", "番組", start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	second, err := NewScheduler()
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second NewScheduler error = %v, want ErrLocked", err)
+	}
+	if list := second.List(); len(list) != 1 || list[0].StationID != "TBS" {
+		t.Errorf("second scheduler lists %+v, want the saved reservation", list)
+	}
+	if _, err := second.Add("QRR", "番組", start, start.Add(time.Hour)); !errors.Is(err, ErrLocked) {
+		t.Errorf("Add on the second scheduler = %v, want ErrLocked", err)
+	}
+	if err := second.Remove(second.List()[0].ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("Remove on the second scheduler = %v, want ErrLocked", err)
+	}
+	if _, err := second.AddRule(Rule{Keyword: "ニュース", StationIDs: []string{"TBS"}}); !errors.Is(err, ErrLocked) {
+		t.Errorf("AddRule on the second scheduler = %v, want ErrLocked", err)
+	}
+	second.Stop()
+
+	// Once the first process stops, the next scheduler runs the reservations
+	first.Stop()
+	third, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("NewScheduler after Stop: %v", err)
+	}
+	defer third.Stop()
+	if _, err := third.Add("QRR", "番組", start, start.Add(time.Hour)); err != nil {
+		t.Errorf("Add after taking the lock: %v", err)
+	}
+}
+
+func TestSchedulerStopEndsChanges(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	s, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	start := time.Now().Add(time.Hour)
+	added, err := s.Add("TBS", "番組", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	s.Stop()
+
+	if _, err := s.Add("QRR", "番組", start, start.Add(time.Hour)); !errors.Is(err, ErrStopped) {
+		t.Errorf("Add after Stop = %v, want ErrStopped", err)
+	}
+	if err := s.Remove(added.ID); !errors.Is(err, ErrStopped) {
+		t.Errorf("Remove after Stop = %v, want ErrStopped", err)
+	}
+	if _, err := s.AddRule(Rule{Keyword: "ニュース", StationIDs: []string{"TBS"}}); !errors.Is(err, ErrStopped) {
+		t.Errorf("AddRule after Stop = %v, want ErrStopped", err)
+	}
+
+	// Another process may run the reservations now: the store is left as it was
+	s.mu.Lock()
+	s.saveLocked()
+	s.mu.Unlock()
+	next, err := NewScheduler()
+	if err != nil {
+		t.Fatalf("NewScheduler after Stop: %v", err)
+	}
+	defer next.Stop()
+	if list := next.List(); len(list) != 1 || list[0].ID != added.ID || list[0].Status != StatusScheduled {
+		t.Errorf("saved reservations = %+v, want the one added before Stop", list)
+	}
+}
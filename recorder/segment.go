@@ -0,0 +1,87 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Gap is a span missing from a recording, e.g. while the stream was reconnecting,
+// or with DeadAir a span the station sent silence or looping audio
+type Gap struct {
+	Offset   time.Duration `json:"offset"`             // Position in the recording at which audio is missing
+	Duration time.Duration `json:"duration"`           // Approximate length of the missing audio
+	DeadAir  bool          `json:"dead_air,omitempty"` // The audio is in the recording but silent or looping
+}
+
+// String formats the gap as "12:34 (45秒)"
+func (g Gap) String() string {
+	offset := int(g.Offset.Seconds())
+	position := fmt.Sprintf("%02d:%02d", offset/60, offset%60)
+	if offset >= 3600 {
+		position = fmt.Sprintf("%d:%02d:%02d", offset/3600, offset/60%60, offset%60)
+	}
+	return fmt.Sprintf("%s (%d秒)", position, int(g.Duration.Seconds()))
+}
+
+// SegmentPath returns the path of the nth segment of a recording file.
+// The first segment is the recording file itself.
+func SegmentPath(filePath string, n int) string {
+	if n <= 1 {
+		return filePath
+	}
+	ext := filepath.Ext(filePath)
+	return fmt.Sprintf("%s.seg%d%s", strings.TrimSuffix(filePath, ext), n, ext)
+}
+
+// JoinSegments concatenates the segments of a recording into filePath without
+// re-encoding and writes the tags again, including the gaps of meta.
+// A single segment is only rewritten if there are gaps to tag.
+// segments[0] must be filePath. The other segments are removed on success;
+// on failure they are left in place next to filePath.
+func JoinSegments(filePath string, segments []string, out OutputOptions, meta Metadata, coverPath string) error {
+	if len(segments) <= 1 && (len(meta.Gaps) == 0 || !out.Format.SupportsTags()) {
+		return nil
+	}
+
+	first := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".seg1" + filepath.Ext(filePath)
+	if err := os.Rename(filePath, first); err != nil {
+		return fmt.Errorf("failed to rename first segment: %w", err)
+	}
+	inputs := append([]string{first}, segments[1:]...)
+
+	// ffconcat list with single quotes escaped
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for _, segment := range inputs {
+		abs, err := filepath.Abs(segment)
+		if err != nil {
+			abs = segment
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listPath := first + ".txt"
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		os.Rename(first, filePath)
+		return err
+	}
+	defer os.Remove(listPath)
+
+	args := []string{"-loglevel", "error", "-f", "concat", "-safe", "0", "-i", listPath}
+	args = append(args, CoverInputArgs(out, coverPath)...)
+	args = append(args, outputArgs(out, []string{"-c:a", "copy"}, meta, coverPath, filePath)...)
+
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(filePath)
+		os.Rename(first, filePath)
+		return fmt.Errorf("failed to join segments: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	for _, segment := range inputs {
+		os.Remove(segment)
+	}
+	return nil
+}
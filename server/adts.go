@@ -0,0 +1,21 @@
+package server
+
+import "radiko-tui/internal/adts"
+
+// adtsSplitter is the framer of ADTS AAC
+type adtsSplitter struct {
+	splitter adts.Splitter
+}
+
+// split returns the frames completed by data, joined in one buffer
+func (s *adtsSplitter) split(data []byte) ([]byte, []audioFrame) {
+	out, frames := s.splitter.Split(data)
+	if len(frames) == 0 {
+		return out, nil
+	}
+	audio := make([]audioFrame, len(frames))
+	for i, frame := range frames {
+		audio[i] = audioFrame{data: frame.Data, duration: frame.Duration}
+	}
+	return out, audio
+}
@@ -0,0 +1,75 @@
+package server
+
+import "time"
+
+// audioFrame is one frame (or Ogg page) of an output stream
+type audioFrame struct {
+	data     []byte
+	duration time.Duration
+	header   bool // Stream header (Ogg Opus head and tags) that every client needs first
+}
+
+// framer splits the output of ffmpeg into whole frames, so that clients always
+// receive the stream from a frame boundary. A framer lives as long as one ffmpeg
+// process and is only used by the goroutine reading it.
+type framer interface {
+	// split returns the frames completed by data, joined in one buffer
+	split(data []byte) ([]byte, []audioFrame)
+}
+
+// burstBuffer keeps the last frames of a stream, sent to a new client at once so
+// that its player fills its buffer and starts without waiting for live data. It
+// also keeps the stream's header frames, which a client joining late still needs.
+// It is guarded by the StationStream's mutex.
+type burstBuffer struct {
+	header   []audioFrame
+	inHeader bool // The last frame added was a header frame
+	frames   []audioFrame
+	length   time.Duration
+	capacity time.Duration
+}
+
+// add appends frames, dropping the oldest beyond the capacity
+func (b *burstBuffer) add(frames []audioFrame) {
+	for _, f := range frames {
+		if f.header {
+			if !b.inHeader {
+				// A new stream starts: the frames before it belong to the old one
+				b.header, b.frames, b.length = nil, nil, 0
+				b.inHeader = true
+			}
+			b.header = append(b.header, f)
+			continue
+		}
+		b.inHeader = false
+		if b.capacity > 0 {
+			b.frames = append(b.frames, f)
+			b.length += f.duration
+		}
+	}
+	drop := 0
+	for drop < len(b.frames) && b.length-b.frames[drop].duration >= b.capacity {
+		b.length -= b.frames[drop].duration
+		drop++
+	}
+	b.frames = b.frames[drop:]
+}
+
+// bytes returns the header and the buffered frames joined
+func (b *burstBuffer) bytes() []byte {
+	var size int
+	for _, f := range b.header {
+		size += len(f.data)
+	}
+	for _, f := range b.frames {
+		size += len(f.data)
+	}
+	data := make([]byte, 0, size)
+	for _, f := range b.header {
+		data = append(data, f.data...)
+	}
+	for _, f := range b.frames {
+		data = append(data, f.data...)
+	}
+	return data
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"radiko-tui/internal/adts/adtstest"
+)
+
+// syncBuffer is a writer that may be read while a client writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.buf.Bytes())
+}
+
+// testStream returns a running stream without ffmpeg, fed by feed
+func testStream(t *testing.T, format Format, burst time.Duration) *StationStream {
+	t.Helper()
+	ss := &StationStream{
+		format:       format,
+		key:          streamKey("TEST", format),
+		clients:      make(map[string]*Client),
+		running:      true,
+		done:         make(chan struct{}),
+		graceSeconds: 60,
+		policy:       ClientPolicy{QueueSize: 64, SlowClient: SlowClientDrop, Burst: burst},
+		burst:        burstBuffer{capacity: burst},
+	}
+	t.Cleanup(ss.CancelGracePeriod)
+	return ss
+}
+
+// feed splits data as readAndBroadcast does, cutting it into chunks of size bytes
+func feed(ss *StationStream, splitter framer, data []byte, size int) {
+	for len(data) > 0 {
+		n := min(len(data), size)
+		if out, frames := splitter.split(data[:n]); len(frames) > 0 {
+			ss.fanOut(chunk{data: out, at: time.Now()}, frames)
+		}
+		data = data[n:]
+	}
+}
+
+// addClient connects a client writing to the returned buffer until the test ends
+func addClient(t *testing.T, ss *StationStream, id string) *syncBuffer {
+	t.Helper()
+	out := &syncBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ss.AddClient(ctx, out, id, false)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		ss.mu.RLock()
+		_, ok := ss.clients[id]
+		ss.mu.RUnlock()
+		if ok {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client %s was not added", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitSuffix waits until out ends with suffix and returns what it holds
+func waitSuffix(t *testing.T, out *syncBuffer, suffix []byte) []byte {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data := out.Bytes()
+		if bytes.HasSuffix(data, suffix) {
+			return data
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client received %d bytes, not ending with the last frame", len(data))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewClientStartsOnFrame(t *testing.T) {
+	ss := testStream(t, FormatAAC, 3*adtstest.FrameDuration)
+	splitter := formatSpecs[FormatAAC].newFramer()
+
+	var stream []byte
+	boundaries := map[int]bool{}
+	for i := range 20 {
+		boundaries[len(stream)] = true
+		stream = append(stream, adtstest.Frame(64+i*7, byte(i))...)
+	}
+	last := stream[len(stream)-(64+19*7):]
+
+	// The client joins with a frame half received
+	half := len(stream)/2 + 13
+	feed(ss, splitter, stream[:half], 97)
+	out := addClient(t, ss, "listener")
+	feed(ss, splitter, stream[half:], 97)
+
+	got := waitSuffix(t, out, last)
+	if !bytes.HasSuffix(stream, got) {
+		t.Fatal("client received data that is not the end of the stream")
+	}
+	if start := len(stream) - len(got); !boundaries[start] {
+		t.Errorf("client starts at byte %d, inside a frame", start)
+	}
+	if start := len(stream) - len(got); start == 0 || start > half {
+		t.Errorf("client starts at byte %d, want the burst before byte %d", start, half)
+	}
+}
+
+func TestBurstBufferCapacity(t *testing.T) {
+	frame := func(i int) audioFrame {
+		return audioFrame{data: adtstest.Frame(64, byte(i)), duration: adtstest.FrameDuration}
+	}
+	header := audioFrame{data: []byte("OggS-head"), header: true}
+
+	tests := []struct {
+		name       string
+		capacity   time.Duration
+		frames     int
+		batch      int // Frames added at once
+		withHeader bool
+	}{
+		{"one frame at a time", 100 * time.Millisecond, 30, 1, false},
+		{"in batches", 100 * time.Millisecond, 30, 7, false},
+		{"fewer frames than the capacity", time.Second, 10, 3, false},
+		{"header kept in front", 100 * time.Millisecond, 30, 4, true},
+		{"disabled keeps the header only", 0, 10, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := burstBuffer{capacity: tt.capacity}
+			if tt.withHeader {
+				b.add([]audioFrame{header})
+			}
+			var all []audioFrame
+			for i := range tt.frames {
+				all = append(all, frame(i))
+			}
+			for i := 0; i < len(all); i += tt.batch {
+				b.add(all[i:min(i+tt.batch, len(all))])
+			}
+
+			var length time.Duration
+			for _, f := range b.frames {
+				length += f.duration
+			}
+			if length != b.length {
+				t.Errorf("length = %v, frames add up to %v", b.length, length)
+			}
+			switch {
+			case tt.capacity == 0:
+				if len(b.frames) != 0 {
+					t.Errorf("kept %d frames with the burst disabled", len(b.frames))
+				}
+			case time.Duration(tt.frames)*adtstest.FrameDuration <= tt.capacity:
+				if len(b.frames) != tt.frames {
+					t.Errorf("kept %d frames, want all %d", len(b.frames), tt.frames)
+				}
+			default:
+				// The burst covers the capacity with less than one frame more
+				if length < tt.capacity || length-b.frames[0].duration >= tt.capacity {
+					t.Errorf("burst of %v for a capacity of %v", length, tt.capacity)
+				}
+			}
+
+			var want []byte
+			if tt.withHeader {
+				want = append(want, header.data...)
+			}
+			for _, f := range all[len(all)-len(b.frames):] {
+				want = append(want, f.data...)
+			}
+			if !bytes.Equal(b.bytes(), want) {
+				t.Error("burst is not the header followed by the newest frames")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"radiko-tui/config"
+)
+
+// SlowClientAction is what happens to a client that cannot keep up with the stream
+type SlowClientAction string
+
+const (
+	SlowClientDrop       SlowClientAction = "drop"       // Drop the oldest queued data
+	SlowClientDisconnect SlowClientAction = "disconnect" // Disconnect once it lags MaxLag behind
+)
+
+// ClientPolicy controls the queue of each client
+type ClientPolicy struct {
+	QueueSize  int              // Chunks queued per client
+	SlowClient SlowClientAction // What to do when the queue is full
+	MaxLag     time.Duration    // Lag at which a client is disconnected (SlowClientDisconnect)
+	Burst      time.Duration    // Recent audio sent to a new client before live data (0 = none)
+}
+
+// DefaultClientPolicy returns the policy used unless SetClientPolicy is called
+func DefaultClientPolicy() ClientPolicy {
+	return ClientPolicyFromConfig(config.DefaultConfig().Server)
+}
+
+// ClientPolicyFromConfig builds a policy from the server section of the config
+func ClientPolicyFromConfig(cfg config.ServerConfig) ClientPolicy {
+	policy := ClientPolicy{
+		QueueSize:  cfg.ClientQueue,
+		SlowClient: SlowClientAction(cfg.SlowClient),
+		MaxLag:     time.Duration(cfg.MaxLagSec) * time.Second,
+		Burst:      time.Duration(max(cfg.BurstSec, 0)) * time.Second,
+	}
+	if policy.QueueSize <= 0 {
+		policy.QueueSize = 256
+	}
+	if policy.SlowClient != SlowClientDisconnect {
+		policy.SlowClient = SlowClientDrop
+	}
+	return policy
+}
+
+// errClientLagging is the reason a slow client is disconnected
+var errClientLagging = errors.New("client is lagging behind the stream")
+
+// chunk is data read from ffmpeg, with when it was read
+type chunk struct {
+	data []byte
+	at   time.Time
+}
+
+// Client represents a connected client. The stream queues data for it without
+// waiting, and its own goroutine (the HTTP handler's) writes the queue, so a slow
+// client only delays itself.
+type Client struct {
+	id          string
+	writer      io.Writer // HTTP response, or the input of a transcoder
+	out         io.Writer // writer, through an icyWriter when metadata was requested
+	done        chan struct{}
+	closeOnce   sync.Once
+	err         error // Why the client was closed, set before done is closed
+	queue       chan chunk
+	burst       []byte // Written before the queue
+	connectedAt time.Time
+
+	writing      atomic.Int64 // When the chunk being written was read (unix nanoseconds, 0 = idle)
+	sentBytes    atomic.Int64
+	droppedBytes atomic.Int64
+}
+
+// ClientStatus is the state of a client, reported by /api/status
+type ClientStatus struct {
+	ID           string  `json:"id"`
+	ConnectedSec int     `json:"connected_sec"`
+	LagMs        int64   `json:"lag_ms"`     // How far the data being written is behind the stream
+	Queued       int     `json:"queued"`     // Chunks waiting to be written
+	QueueFill    float64 `json:"queue_fill"` // Queued / queue size
+	SentBytes    int64   `json:"sent_bytes"`
+	DroppedBytes int64   `json:"dropped_bytes"` // Data dropped because the client was too slow
+}
+
+func newClient(id string, w io.Writer, queueSize int, burst []byte) *Client {
+	return &Client{
+		id:          id,
+		writer:      w,
+		out:         w,
+		done:        make(chan struct{}),
+		queue:       make(chan chunk, queueSize),
+		burst:       burst,
+		connectedAt: time.Now(),
+	}
+}
+
+// enqueue queues data without blocking. With SlowClientDrop the oldest data makes
+// room; with SlowClientDisconnect a full queue or too much lag closes the client.
+func (c *Client) enqueue(ch chunk, policy ClientPolicy) {
+	if policy.SlowClient == SlowClientDisconnect && policy.MaxLag > 0 && c.lag(ch.at) > policy.MaxLag {
+		c.close(errClientLagging)
+		return
+	}
+	for {
+		select {
+		case c.queue <- ch:
+			return
+		default:
+		}
+		if policy.SlowClient == SlowClientDisconnect {
+			c.close(errClientLagging)
+			return
+		}
+		select {
+		case old := <-c.queue:
+			c.droppedBytes.Add(int64(len(old.data)))
+		default:
+		}
+	}
+}
+
+// lag returns how far the client is behind at now
+func (c *Client) lag(now time.Time) time.Duration {
+	at := c.writing.Load()
+	if at == 0 {
+		return 0
+	}
+	return max(now.Sub(time.Unix(0, at)), 0)
+}
+
+// run writes the burst, then the queue to the HTTP response until ctx ends or
+// the client is closed
+func (c *Client) run(ctx context.Context) {
+	if len(c.burst) > 0 {
+		// The burst is old audio on purpose: only a stuck write counts as lag
+		c.writing.Store(time.Now().UnixNano())
+		if _, err := c.out.Write(c.burst); err != nil {
+			c.close(err)
+			return
+		}
+		c.flush()
+		c.sentBytes.Add(int64(len(c.burst)))
+		c.writing.Store(0)
+		c.burst = nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case ch := <-c.queue:
+			c.writing.Store(ch.at.UnixNano())
+			if _, err := c.out.Write(ch.data); err != nil {
+				c.close(err)
+				return
+			}
+			c.flush()
+			c.sentBytes.Add(int64(len(ch.data)))
+			if len(c.queue) == 0 {
+				c.writing.Store(0)
+			}
+		}
+	}
+}
+
+// flush sends the data buffered by an HTTP response
+func (c *Client) flush() {
+	if f, ok := c.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close ends the client for err. A write blocked on the client fails at once.
+func (c *Client) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		switch w := c.writer.(type) {
+		case http.ResponseWriter:
+			http.NewResponseController(w).SetWriteDeadline(time.Now())
+		case io.Closer:
+			w.Close()
+		}
+	})
+}
+
+// status returns the client's state
+func (c *Client) status() ClientStatus {
+	now := time.Now()
+	return ClientStatus{
+		ID:           c.id,
+		ConnectedSec: int(now.Sub(c.connectedAt).Seconds()),
+		LagMs:        c.lag(now).Milliseconds(),
+		Queued:       len(c.queue),
+		QueueFill:    float64(len(c.queue)) / float64(cap(c.queue)),
+		SentBytes:    c.sentBytes.Load(),
+		DroppedBytes: c.droppedBytes.Load(),
+	}
+}
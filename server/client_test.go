@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter is a listener whose writes block until it is released or closed
+type blockingWriter struct {
+	writes    chan []byte // Data of each write, as it starts
+	release   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{
+		writes:  make(chan []byte, 16),
+		release: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.writes <- p
+	select {
+	case <-w.release:
+		return len(p), nil
+	case <-w.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (w *blockingWriter) Close() error {
+	w.closeOnce.Do(func() { close(w.closed) })
+	return nil
+}
+
+// chunkData returns the distinct data of chunk i
+func chunkData(i int) []byte {
+	return bytes.Repeat([]byte{byte(i)}, 100*i)
+}
+
+func TestClientEnqueue(t *testing.T) {
+	drop := ClientPolicy{SlowClient: SlowClientDrop}
+	tests := []struct {
+		name        string
+		policy      ClientPolicy
+		queueSize   int
+		chunks      int           // Chunks sent; the first one is being written
+		behind      time.Duration // Age of the first chunk when it is written
+		wantClosed  bool
+		wantQueued  int
+		wantDropped int64
+		wantWritten []int // Chunks the listener receives once it catches up
+	}{
+		{"drop makes room for the newest", drop, 2, 5, 3 * time.Second, false, 2, 500, []int{1, 4, 5}},
+		{"drop ignores the lag", ClientPolicy{SlowClient: SlowClientDrop, MaxLag: time.Second}, 8, 3, 5 * time.Second, false, 2, 0, []int{1, 2, 3}},
+		{"disconnect when the queue is full", ClientPolicy{SlowClient: SlowClientDisconnect, MaxLag: time.Hour}, 2, 4, 0, true, 0, 0, nil},
+		{"disconnect beyond the max lag", ClientPolicy{SlowClient: SlowClientDisconnect, MaxLag: time.Second}, 8, 2, 5 * time.Second, true, 0, 0, nil},
+		{"disconnect keeps a client within the max lag", ClientPolicy{SlowClient: SlowClientDisconnect, MaxLag: 10 * time.Second}, 8, 3, 5 * time.Second, false, 2, 0, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newBlockingWriter()
+			c := newClient("listener", w, tt.queueSize, nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			running := make(chan struct{})
+			go func() {
+				defer close(running)
+				c.run(ctx)
+			}()
+			defer func() {
+				cancel()
+				w.Close()
+				<-running
+			}()
+
+			now := time.Now()
+			c.enqueue(chunk{data: chunkData(1), at: now.Add(-tt.behind)}, tt.policy)
+			<-w.writes // The listener is stuck on the first chunk
+			for i := 2; i <= tt.chunks; i++ {
+				c.enqueue(chunk{data: chunkData(i), at: now}, tt.policy)
+			}
+
+			select {
+			case <-c.done:
+				if !tt.wantClosed {
+					t.Fatalf("client closed: %v", c.err)
+				}
+				if c.err != errClientLagging {
+					t.Errorf("client closed with %v, want errClientLagging", c.err)
+				}
+				return
+			default:
+				if tt.wantClosed {
+					t.Fatal("slow client was not disconnected")
+				}
+			}
+
+			status := c.status()
+			if lag := time.Duration(status.LagMs) * time.Millisecond; lag < tt.behind || lag > tt.behind+time.Second {
+				t.Errorf("lag = %v, want %v", lag, tt.behind)
+			}
+			if status.Queued != tt.wantQueued || status.QueueFill != float64(tt.wantQueued)/float64(tt.queueSize) {
+				t.Errorf("queued = %d (fill %.2f), want %d", status.Queued, status.QueueFill, tt.wantQueued)
+			}
+			if status.DroppedBytes != tt.wantDropped {
+				t.Errorf("dropped = %d bytes, want %d", status.DroppedBytes, tt.wantDropped)
+			}
+
+			// Once the listener catches up it receives the chunks kept, and has no lag
+			close(w.release)
+			var want []byte
+			for _, i := range tt.wantWritten {
+				want = append(want, chunkData(i)...)
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				if status := c.status(); status.SentBytes >= int64(len(want)) && status.LagMs == 0 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			var written []byte
+			for len(w.writes) > 0 {
+				written = append(written, <-w.writes...)
+			}
+			if !bytes.Equal(append(chunkData(1), written...), want) {
+				t.Errorf("listener received %d bytes, want chunks %v", len(written)+len(chunkData(1)), tt.wantWritten)
+			}
+			if status := c.status(); status.LagMs != 0 || status.Queued != 0 {
+				t.Errorf("after catching up: lag %dms, %d queued, want none", status.LagMs, status.Queued)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is an output format of /api/play
+type Format string
+
+const (
+	FormatAAC  Format = "aac"  // The station's ADTS AAC as is
+	FormatMP3  Format = "mp3"  // MP3 128kbps, for players without AAC
+	FormatOpus Format = "opus" // Opus 64kbps in Ogg
+	FormatWAV  Format = "wav"  // 48kHz 16-bit stereo PCM, for players that decode nothing
+)
+
+// formatSpec describes how a format is produced and served
+type formatSpec struct {
+	contentType string
+	codecArgs   []string      // ffmpeg options transcoding the AAC stream (nil = no transcoding)
+	prefix      []byte        // Sent to every client before anything else
+	newFramer   func() framer // Framer of one ffmpeg process
+}
+
+var formatSpecs = map[Format]formatSpec{
+	FormatAAC: {
+		contentType: "audio/aac",
+		newFramer:   func() framer { return &adtsSplitter{} },
+	},
+	FormatMP3: {
+		contentType: "audio/mpeg",
+		codecArgs:   []string{"-c:a", "libmp3lame", "-b:a", "128k", "-id3v2_version", "0", "-write_xing", "0", "-f", "mp3"},
+		newFramer:   func() framer { return &mp3Splitter{} },
+	},
+	FormatOpus: {
+		contentType: "audio/ogg",
+		codecArgs:   []string{"-c:a", "libopus", "-b:a", "64k", "-page_duration", "100000", "-f", "ogg"},
+		newFramer:   func() framer { return &oggSplitter{} },
+	},
+	FormatWAV: {
+		contentType: "audio/wav",
+		codecArgs:   []string{"-c:a", "pcm_s16le", "-ar", "48000", "-ac", "2", "-f", "s16le"},
+		prefix:      wavHeader(48000, 2),
+		newFramer:   func() framer { return &pcmSplitter{frameSize: 4, bytesPerSecond: 48000 * 4} },
+	},
+}
+
+// formatMediaTypes maps Accept media types to formats
+var formatMediaTypes = map[string]Format{
+	"audio/aac":      FormatAAC,
+	"audio/aacp":     FormatAAC,
+	"audio/x-aac":    FormatAAC,
+	"audio/mpeg":     FormatMP3,
+	"audio/mp3":      FormatMP3,
+	"audio/ogg":      FormatOpus,
+	"audio/opus":     FormatOpus,
+	"audio/wav":      FormatWAV,
+	"audio/wave":     FormatWAV,
+	"audio/x-wav":    FormatWAV,
+	"audio/vnd.wave": FormatWAV,
+}
+
+// negotiateFormat chooses the output format of a request: the format query
+// parameter if set, else the preferred audio type of the Accept header, else AAC
+func negotiateFormat(r *http.Request) (Format, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		format := Format(strings.ToLower(name))
+		if _, ok := formatSpecs[format]; !ok {
+			return "", fmt.Errorf("unsupported format: %s (aac, mp3, opus, wav)", name)
+		}
+		return format, nil
+	}
+
+	format, best := FormatAAC, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := formatMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > best {
+			format, best = f, q
+		}
+	}
+	return format, nil
+}
+
+// streamKey identifies the stream of a station in a format. AAC streams keep the
+// bare station ID.
+func streamKey(stationID string, format Format) string {
+	if format == FormatAAC {
+		return stationID
+	}
+	return stationID + ":" + string(format)
+}
+
+// wavHeader returns the header of an endless 16-bit PCM WAV stream
+func wavHeader(sampleRate, channels int) []byte {
+	const size = 0xFFFFFFFF // Unknown length
+	h := make([]byte, 44)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], size)
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(h[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(h[34:], 16)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], size-36)
+	return h
+}
+
+// pcmSplitter is the framer of raw PCM: whole sample frames
+type pcmSplitter struct {
+	frameSize      int
+	bytesPerSecond int
+	pending        []byte
+}
+
+func (s *pcmSplitter) split(data []byte) ([]byte, []audioFrame) {
+	buf := append(s.pending, data...)
+	n := len(buf) - len(buf)%s.frameSize
+	out := append([]byte(nil), buf[:n]...)
+	s.pending = append(s.pending[:0], buf[n:]...)
+	if n == 0 {
+		return nil, nil
+	}
+	return out, []audioFrame{{
+		data:     out,
+		duration: time.Duration(n) * time.Second / time.Duration(s.bytesPerSecond),
+	}}
+}
+
+// MPEG audio Layer III bitrates (kbps) by header index, for MPEG-1 and MPEG-2/2.5
+var (
+	mp3Bitrates1 = []int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	mp3Bitrates2 = []int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+	mp3Rates     = []int{44100, 48000, 32000} // MPEG-1; halved for MPEG-2, quartered for MPEG-2.5
+)
+
+// mp3Splitter is the framer of MP3
+type mp3Splitter struct {
+	pending []byte // Incomplete frame
+}
+
+func (s *mp3Splitter) split(data []byte) ([]byte, []audioFrame) {
+	buf := append(s.pending, data...)
+	out := make([]byte, 0, len(buf))
+	var frames []audioFrame
+	for {
+		// Resynchronize on the frame sync (11 bits)
+		i := 0
+		for i+1 < len(buf) && !(buf[i] == 0xFF && buf[i+1]&0xE0 == 0xE0) {
+			i++
+		}
+		buf = buf[i:]
+		if len(buf) < 4 {
+			break
+		}
+
+		version := buf[1] >> 3 & 0x03 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+		layer := buf[1] >> 1 & 0x03   // 1 = Layer III
+		bitrateIndex := int(buf[2] >> 4)
+		rateIndex := int(buf[2] >> 2 & 0x03)
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			// Not a frame header, skip the false sync word
+			buf = buf[1:]
+			continue
+		}
+
+		bitrates, rate, samples := mp3Bitrates1, mp3Rates[rateIndex], 1152
+		switch version {
+		case 2:
+			bitrates, rate, samples = mp3Bitrates2, rate/2, 576
+		case 0:
+			bitrates, rate, samples = mp3Bitrates2, rate/4, 576
+		}
+		length := samples/8*bitrates[bitrateIndex]*1000/rate + int(buf[2]>>1&0x01)
+		if len(buf) < length {
+			break
+		}
+
+		out = append(out, buf[:length]...)
+		frames = append(frames, audioFrame{
+			data:     out[len(out)-length:],
+			duration: time.Duration(samples) * time.Second / time.Duration(rate),
+		})
+		buf = buf[length:]
+	}
+	s.pending = append(s.pending[:0], buf...)
+	return out, frames
+}
+
+// oggSplitter is the framer of Ogg Opus: whole pages. The pages before the first
+// audio (OpusHead and OpusTags, granule position 0) are header frames.
+type oggSplitter struct {
+	pending []byte // Incomplete page
+	granule uint64 // Granule position of the last page
+}
+
+func (s *oggSplitter) split(data []byte) ([]byte, []audioFrame) {
+	buf := append(s.pending, data...)
+	out := make([]byte, 0, len(buf))
+	var frames []audioFrame
+	for {
+		// Resynchronize on the capture pattern
+		i := 0
+		for i+3 < len(buf) && string(buf[i:i+4]) != "OggS" {
+			i++
+		}
+		buf = buf[i:]
+		if len(buf) < 27 {
+			break
+		}
+		segments := int(buf[26])
+		if len(buf) < 27+segments {
+			break
+		}
+		length := 27 + segments
+		for _, l := range buf[27 : 27+segments] {
+			length += int(l)
+		}
+		if len(buf) < length {
+			break
+		}
+
+		granule := binary.LittleEndian.Uint64(buf[6:])
+		if buf[5]&0x02 != 0 {
+			// Beginning of a stream
+			s.granule = 0
+		}
+		frame := audioFrame{header: granule == 0}
+		if granule != ^uint64(0) && granule > s.granule {
+			// Opus granule positions count 48kHz samples
+			frame.duration = time.Duration(granule-s.granule) * time.Second / 48000
+			s.granule = granule
+		}
+
+		out = append(out, buf[:length]...)
+		frame.data = out[len(out)-length:]
+		frames = append(frames, frame)
+		buf = buf[length:]
+	}
+	s.pending = append(s.pending[:0], buf...)
+	return out, frames
+}
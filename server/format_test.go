@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// mp3Frame returns an MP3 frame with header bytes b1 and b2 after the sync byte,
+// of length bytes filled with fill
+func mp3Frame(b1, b2 byte, length int, fill byte) []byte {
+	f := bytes.Repeat([]byte{fill}, length)
+	f[0], f[1], f[2], f[3] = 0xFF, b1, b2, 0xC4
+	return f
+}
+
+// oggPage returns an Ogg page with the given header type flags and granule
+// position, carrying payload
+func oggPage(flags byte, granule uint64, payload []byte) []byte {
+	var segments []byte
+	for rest := len(payload); ; rest -= 255 {
+		segments = append(segments, byte(min(rest, 255)))
+		if rest < 255 {
+			break
+		}
+	}
+	p := make([]byte, 27, 27+len(segments)+len(payload))
+	copy(p, "OggS")
+	p[5] = flags
+	binary.LittleEndian.PutUint64(p[6:], granule)
+	binary.LittleEndian.PutUint32(p[14:], 1234) // Serial number
+	p[26] = byte(len(segments))
+	p = append(p, segments...)
+	return append(p, payload...)
+}
+
+// splitAll splits stream cut into chunks of size bytes and returns every frame
+func splitAll(f framer, stream []byte, size int) []audioFrame {
+	var frames []audioFrame
+	for len(stream) > 0 {
+		n := min(len(stream), size)
+		_, got := f.split(stream[:n])
+		frames = append(frames, got...)
+		stream = stream[n:]
+	}
+	return frames
+}
+
+func TestMP3Splitter(t *testing.T) {
+	frames := []struct {
+		data     []byte
+		duration time.Duration
+	}{
+		// MPEG-1 128kbps 48kHz: 144 * 128000 / 48000
+		{mp3Frame(0xFB, 0x94, 384, 0x11), 24 * time.Millisecond},
+		// MPEG-1 128kbps 44.1kHz with the padding byte
+		{mp3Frame(0xFB, 0x92, 418, 0x22), 1152 * time.Second / 44100},
+		// MPEG-2 64kbps 24kHz: 72 * 64000 / 24000
+		{mp3Frame(0xF3, 0x84, 192, 0x33), 24 * time.Millisecond},
+		// MPEG-2.5 32kbps 12kHz: 72 * 32000 / 12000
+		{mp3Frame(0xE3, 0x44, 192, 0x44), 48 * time.Millisecond},
+		{mp3Frame(0xFB, 0x94, 384, 0x55), 24 * time.Millisecond},
+	}
+
+	// Junk and a false sync (Layer I) come before the first frame
+	stream := []byte{0x00, 0x12, 0xFF, 0xFF, 0x00, 0x34}
+	for _, f := range frames {
+		stream = append(stream, f.data...)
+	}
+	// An incomplete frame at the end stays pending
+	stream = append(stream, mp3Frame(0xFB, 0x94, 384, 0x66)[:100]...)
+
+	for _, size := range []int{1, 7, 100, 384, len(stream)} {
+		got := splitAll(&mp3Splitter{}, stream, size)
+		if len(got) != len(frames) {
+			t.Fatalf("chunks of %d: %d frames, want %d", size, len(got), len(frames))
+		}
+		for i, f := range frames {
+			if !bytes.Equal(got[i].data, f.data) || got[i].duration != f.duration {
+				t.Errorf("chunks of %d: frame %d is %d bytes for %v, want %d bytes for %v",
+					size, i, len(got[i].data), got[i].duration, len(f.data), f.duration)
+			}
+		}
+	}
+}
+
+func TestOggSplitter(t *testing.T) {
+	long := bytes.Repeat([]byte{0x42}, 600) // Needs three lacing values
+	pages := []struct {
+		data     []byte
+		duration time.Duration
+		header   bool
+	}{
+		{oggPage(0x02, 0, []byte("OpusHead")), 0, true},
+		{oggPage(0x00, 0, []byte("OpusTags")), 0, true},
+		{oggPage(0x00, 4800, long), 100 * time.Millisecond, false},
+		// A page without a finished packet has no granule position
+		{oggPage(0x00, ^uint64(0), long), 0, false},
+		{oggPage(0x01, 14400, []byte("audio")), 200 * time.Millisecond, false},
+		// A new stream starts counting again
+		{oggPage(0x02, 0, []byte("OpusHead")), 0, true},
+		{oggPage(0x00, 0, []byte("OpusTags")), 0, true},
+		{oggPage(0x00, 960, []byte("audio")), 20 * time.Millisecond, false},
+	}
+
+	stream := []byte("junkOgg")
+	for _, p := range pages {
+		stream = append(stream, p.data...)
+	}
+	stream = append(stream, oggPage(0x00, 1920, long)[:40]...)
+
+	for _, size := range []int{1, 13, 300, len(stream)} {
+		got := splitAll(&oggSplitter{}, stream, size)
+		if len(got) != len(pages) {
+			t.Fatalf("chunks of %d: %d pages, want %d", size, len(got), len(pages))
+		}
+		for i, p := range pages {
+			if !bytes.Equal(got[i].data, p.data) || got[i].duration != p.duration || got[i].header != p.header {
+				t.Errorf("chunks of %d: page %d is %d bytes for %v (header %v), want %d bytes for %v (header %v)",
+					size, i, len(got[i].data), got[i].duration, got[i].header, len(p.data), p.duration, p.header)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"radiko-tui/api"
+)
+
+// ICY metadata settings
+const (
+	icyMetaInt     = 16000            // Audio bytes between two metadata blocks (icy-metaint)
+	icyMaxMeta     = 255 * 16         // Largest metadata block (its length byte counts 16-byte units)
+	programRecheck = 5 * time.Second  // Wait after a program's end before looking up the next
+	programRetry   = time.Minute      // Wait after a failed lookup
+	programMinWait = 10 * time.Second // Shortest wait between lookups
+	programMaxWait = 30 * time.Minute // Longest wait, in case the guide changes
+)
+
+// icyWriter interleaves SHOUTcast/ICY metadata blocks with the audio: after every
+// icyMetaInt bytes of audio comes a length byte and the StreamTitle, padded to a
+// multiple of 16 bytes. The title is sent when it changes; other blocks are empty.
+type icyWriter struct {
+	w         io.Writer
+	title     func() string
+	untilMeta int
+	sent      string // Last title sent
+}
+
+func newICYWriter(w io.Writer, title func() string) *icyWriter {
+	return &icyWriter{w: w, title: title, untilMeta: icyMetaInt}
+}
+
+func (iw *icyWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), iw.untilMeta)
+		if _, err := iw.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		iw.untilMeta -= n
+
+		if iw.untilMeta == 0 {
+			if _, err := iw.w.Write(iw.block()); err != nil {
+				return written, err
+			}
+			iw.untilMeta = icyMetaInt
+		}
+	}
+	return written, nil
+}
+
+// block returns the next metadata block
+func (iw *icyWriter) block() []byte {
+	title := iw.title()
+	if title == iw.sent {
+		return []byte{0}
+	}
+	iw.sent = title
+
+	// The title cannot be escaped: keep it short enough for one block
+	const frame = len("StreamTitle='';")
+	for len(title) > icyMaxMeta-frame {
+		_, size := utf8.DecodeLastRuneInString(title)
+		title = title[:len(title)-size]
+	}
+	meta := "StreamTitle='" + title + "';"
+
+	units := (len(meta) + 15) / 16
+	block := make([]byte, 1+units*16)
+	block[0] = byte(units)
+	copy(block[1:], meta)
+	return block
+}
+
+// programTitle formats a program for StreamTitle: "<title> / <performer>"
+func programTitle(title, performer string) string {
+	title, performer = strings.TrimSpace(title), strings.TrimSpace(performer)
+	if performer == "" {
+		return title
+	}
+	return title + " / " + performer
+}
+
+// watchProgram keeps the title of the program on air up to date from the program
+// guide, looking up the next one when a program ends, until ctx ends
+func (ss *StationStream) watchProgram(ctx context.Context) {
+	for {
+		wait := programRetry
+		prog, err := api.GetProgramAt(ss.stationID, time.Now())
+		if err != nil {
+			log.Printf("⚠ 番組情報を取得できません [%s]: %v", ss.key, err)
+		} else {
+			title := ""
+			if prog != nil {
+				title = programTitle(prog.Title, prog.Performer)
+				wait = time.Until(prog.End) + programRecheck
+			}
+			ss.mu.Lock()
+			changed := title != ss.title
+			ss.title = title
+			ss.mu.Unlock()
+			if changed && title != "" {
+				log.Printf("🎙 番組 [%s]: %s", ss.key, title)
+			}
+		}
+
+		timer := time.NewTimer(min(max(wait, programMinWait), programMaxWait))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Title returns the program on air, as sent in StreamTitle
+func (ss *StationStream) Title() string {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.title
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestICYWriter(t *testing.T) {
+	// The title looked up for each metadata block in turn
+	titles := []string{"A", "A", "Morning Show", "Morning Show", ""}
+	calls := 0
+	var out bytes.Buffer
+	iw := newICYWriter(&out, func() string {
+		title := titles[calls]
+		calls++
+		return title
+	})
+
+	audio := make([]byte, 5*icyMetaInt+5000)
+	for i := range audio {
+		audio[i] = byte(i % 251)
+	}
+	// Uneven writes, some across a block and one ending exactly on it
+	sizes := []int{1, 999, 7000, 8000, 20001, 16000, 3}
+	for rest, i := audio, 0; len(rest) > 0; i++ {
+		p := rest[:min(len(rest), sizes[i%len(sizes)])]
+		if n, err := iw.Write(p); n != len(p) || err != nil {
+			t.Fatalf("Write(%d bytes) = %d, %v", len(p), n, err)
+		}
+		rest = rest[len(p):]
+	}
+
+	blocks := [][]byte{
+		// 16 bytes fill one unit without padding
+		append([]byte{1}, "StreamTitle='A';"...),
+		// Unchanged title: empty block
+		{0},
+		// 27 bytes padded to two units
+		append(append([]byte{2}, "StreamTitle='Morning Show';"...), 0, 0, 0, 0, 0),
+		{0},
+		// A cleared title is sent too
+		append(append([]byte{1}, "StreamTitle='';"...), 0),
+	}
+	var want []byte
+	for i, block := range blocks {
+		want = append(want, audio[i*icyMetaInt:(i+1)*icyMetaInt]...)
+		want = append(want, block...)
+	}
+	want = append(want, audio[len(blocks)*icyMetaInt:]...)
+
+	if calls != len(titles) {
+		t.Errorf("title looked up %d times, want once per block (%d)", calls, len(titles))
+	}
+	if got := out.Bytes(); !bytes.Equal(got, want) {
+		for i := range min(len(got), len(want)) {
+			if got[i] != want[i] {
+				t.Fatalf("output differs at byte %d of %d (want %d bytes)", i, len(got), len(want))
+			}
+		}
+		t.Fatalf("output is %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestICYBlockLongTitle(t *testing.T) {
+	title := strings.Repeat("番組", 1000)
+	iw := newICYWriter(&bytes.Buffer{}, func() string { return title })
+
+	block := iw.block()
+	if len(block) != 1+icyMaxMeta || block[0] != 255 {
+		t.Fatalf("block of %d bytes with length byte %d, want %d bytes and 255", len(block), block[0], 1+icyMaxMeta)
+	}
+	meta := string(bytes.TrimRight(block[1:], "\x00"))
+	if !strings.HasPrefix(meta, "StreamTitle='番組") || !strings.HasSuffix(meta, "';") {
+		t.Errorf("metadata %q...%q is not a StreamTitle", meta[:20], meta[len(meta)-4:])
+	}
+	if !utf8.ValidString(meta) {
+		t.Error("title was cut inside a character")
+	}
+}
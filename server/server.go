@@ -3,18 +3,23 @@ package server
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"radiko-tui/api"
 	"radiko-tui/model"
+	"radiko-tui/recorder"
 )
 
 // getRealIP extracts the real client IP from the request.
@@ -55,11 +60,12 @@ func getRealIP(r *http.Request) string {
 type Server struct {
 	port          int
 	streamManager *StreamManager
-	graceSeconds  int // Grace period before killing ffmpeg after last client disconnects
+	graceSeconds  int                 // Grace period before killing ffmpeg after last client disconnects
+	scheduler     *recorder.Scheduler // Recording reservations (may be nil)
 }
 
 // NewServer creates a new streaming server
-func NewServer(port int, graceSeconds int) *Server {
+func NewServer(port int, graceSeconds int, scheduler *recorder.Scheduler) *Server {
 	if graceSeconds <= 0 {
 		graceSeconds = 10 // Default 10 seconds grace period
 	}
@@ -67,18 +73,33 @@ func NewServer(port int, graceSeconds int) *Server {
 		port:          port,
 		streamManager: NewStreamManager(graceSeconds),
 		graceSeconds:  graceSeconds,
+		scheduler:     scheduler,
 	}
 }
 
+// SetClientPolicy sets how clients are queued and what happens to slow ones.
+// It applies to streams started afterwards.
+func (s *Server) SetClientPolicy(policy ClientPolicy) {
+	s.streamManager.mu.Lock()
+	defer s.streamManager.mu.Unlock()
+	s.streamManager.policy = policy
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/play/{stationID}", s.handlePlayRequest)
 	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/reservations", s.handleReservations)
+	mux.HandleFunc("/api/reservations/{id}", s.handleReservation)
+	mux.HandleFunc("/api/rules", s.handleRules)
+	mux.HandleFunc("/api/rules/preview", s.handleRulesPreview)
+	mux.HandleFunc("/api/rules/{id}", s.handleRule)
 
 	addr := fmt.Sprintf(":%d", s.port)
 	log.Printf("📡 サーバーを開始しました: http://localhost%s", addr)
 	log.Printf("   使用例: vlc http://localhost%s/api/play/QRR", addr)
+	log.Printf("   形式指定: http://localhost%s/api/play/QRR?format=mp3 (aac/mp3/opus/wav)", addr)
 	log.Printf("   ffmpeg保持時間: %d秒", s.graceSeconds)
 
 	return http.ListenAndServe(addr, mux)
@@ -86,9 +107,174 @@ func (s *Server) Start() error {
 
 // handleStatus returns the current stream status
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.streamManager.GetStatus())
+}
+
+// reservationRequest is the body of POST /api/reservations.
+// Either program_id or start/end (RFC3339 or YYYYMMDDHHMMSS in JST) must be set.
+type reservationRequest struct {
+	StationID string `json:"station_id"`
+	ProgramID string `json:"program_id"`
+	Title     string `json:"title"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+}
+
+// parseReservationTime parses an RFC3339 or Radiko (YYYYMMDDHHMMSS, JST) timestamp
+func parseReservationTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return model.ParseRadikoTime(s)
+}
+
+// schedulerErrorStatus returns the HTTP status of a failed change to reservations or
+// rules: 409 while another process runs them, else status
+func schedulerErrorStatus(err error, status int) int {
+	if errors.Is(err, recorder.ErrLocked) {
+		return http.StatusConflict
+	}
+	return status
+}
+
+// handleReservations lists (GET) or creates (POST) recording reservations
+func (s *Server) handleReservations(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.scheduler.List())
+
+	case http.MethodPost:
+		var req reservationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var reservation recorder.Reservation
+		var err error
+		if req.ProgramID != "" {
+			reservation, err = s.scheduler.AddProgramID(req.StationID, req.ProgramID)
+		} else {
+			var start, end time.Time
+			if start, err = parseReservationTime(req.Start); err != nil {
+				http.Error(w, fmt.Sprintf("invalid start: %v", err), http.StatusBadRequest)
+				return
+			}
+			if end, err = parseReservationTime(req.End); err != nil {
+				http.Error(w, fmt.Sprintf("invalid end: %v", err), http.StatusBadRequest)
+				return
+			}
+			reservation, err = s.scheduler.Add(req.StationID, req.Title, start, end)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), schedulerErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		log.Printf("⏰ 録音予約: %s %s (%s - %s)", reservation.StationID, reservation.Title,
+			reservation.Start.Format("01/02 15:04"), reservation.End.Format("15:04"))
+		writeJSON(w, http.StatusCreated, reservation)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleReservation deletes (DELETE) a recording reservation
+func (s *Server) handleReservation(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.scheduler.Remove(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), schedulerErrorStatus(err, http.StatusNotFound))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRules lists (GET) or creates (POST) auto-recording rules
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.scheduler.Rules())
+
+	case http.MethodPost:
+		var rule recorder.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		rule, err := s.scheduler.AddRule(rule)
+		if err != nil {
+			http.Error(w, err.Error(), schedulerErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		log.Printf("📋 自動録音ルール追加: %s", rule.Name)
+		writeJSON(w, http.StatusCreated, rule)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRulesPreview lists upcoming programs matching the rules (GET)
+func (s *Server) handleRulesPreview(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	matches, err := s.scheduler.PreviewRules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// handleRule deletes (DELETE) an auto-recording rule
+func (s *Server) handleRule(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "scheduler is not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.scheduler.RemoveRule(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), schedulerErrorStatus(err, http.StatusNotFound))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	status := s.streamManager.GetStatus()
-	w.Write([]byte(status))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
 
 // handlePlayRequest routes different HTTP methods
@@ -112,13 +298,26 @@ func (s *Server) handlePlayRequest(w http.ResponseWriter, r *http.Request) {
 
 // handleHead handles HEAD requests
 func (s *Server) handleHead(w http.ResponseWriter, r *http.Request, stationID string) {
-	w.Header().Set("Content-Type", "audio/aac")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", formatSpecs[format].contentType)
 	w.Header().Set("Accept-Ranges", "none")
 	w.Header().Set("icy-name", fmt.Sprintf("Radiko - %s", stationID))
 	w.Header().Set("icy-genre", "Radio")
+	if wantsICY(r) {
+		w.Header().Set("icy-metaint", strconv.Itoa(icyMetaInt))
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// wantsICY reports whether the client asked for ICY metadata (Icy-MetaData: 1)
+func wantsICY(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("Icy-MetaData")) == "1"
+}
+
 // handlePlay handles GET requests - stream audio
 func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request, stationID string) {
 	if stationID == "" {
@@ -126,20 +325,31 @@ func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request, stationID st
 		return
 	}
 
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	clientIP := getRealIP(r)
 	clientID := fmt.Sprintf("%s-%d", clientIP, time.Now().UnixNano())
-	log.Printf("🎵 クライアント接続: %s → %s", clientID, stationID)
+	log.Printf("🎵 クライアント接続: %s → %s", clientID, streamKey(stationID, format))
 
 	// Set headers
-	w.Header().Set("Content-Type", "audio/aac")
+	w.Header().Set("Content-Type", formatSpecs[format].contentType)
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Accept-Ranges", "none")
 	w.Header().Set("icy-name", fmt.Sprintf("Radiko - %s", stationID))
 	w.Header().Set("icy-genre", "Radio")
+	icy := wantsICY(r)
+	if icy {
+		// The program title is interleaved with the audio
+		w.Header().Set("icy-metaint", strconv.Itoa(icyMetaInt))
+	}
 
 	// Subscribe to stream
-	err := s.streamManager.Subscribe(r.Context(), w, stationID, clientID)
+	err = s.streamManager.Subscribe(r.Context(), w, stationID, format, clientID, icy)
 	if err != nil {
 		log.Printf("❌ ストリームエラー [%s]: %v", clientID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -156,8 +366,9 @@ func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request, stationID st
 // StreamManager manages all active streams
 type StreamManager struct {
 	mu           sync.RWMutex
-	streams      map[string]*StationStream
+	streams      map[string]*StationStream // By streamKey
 	graceSeconds int
+	policy       ClientPolicy // Queueing of the clients of new streams
 }
 
 // NewStreamManager creates a new stream manager
@@ -165,104 +376,138 @@ func NewStreamManager(graceSeconds int) *StreamManager {
 	return &StreamManager{
 		streams:      make(map[string]*StationStream),
 		graceSeconds: graceSeconds,
+		policy:       DefaultClientPolicy(),
 	}
 }
 
-// GetStatus returns JSON status of all streams
-func (sm *StreamManager) GetStatus() string {
+// StreamStatus is the state of a station stream, reported by /api/status
+type StreamStatus struct {
+	Format    Format         `json:"format"`
+	Clients   int            `json:"clients"`
+	Running   bool           `json:"running"`
+	Restarts  int            `json:"restarts"`          // ffmpeg restarts while the stream ran
+	Program   string         `json:"program,omitempty"` // Program on air, as sent in ICY metadata
+	Listeners []ClientStatus `json:"listeners"`
+}
+
+// GetStatus returns the status of all streams by station ID (AAC) or
+// "stationID:format" (transcoded)
+func (sm *StreamManager) GetStatus() map[string]StreamStatus {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	result := "{"
-	first := true
-	for stationID, stream := range sm.streams {
-		if !first {
-			result += ","
-		}
-		first = false
-		stream.mu.RLock()
-		clientCount := len(stream.clients)
-		stream.mu.RUnlock()
-		result += fmt.Sprintf(`"%s":{"clients":%d,"running":%t}`, stationID, clientCount, stream.running)
+	result := make(map[string]StreamStatus, len(sm.streams))
+	for key, stream := range sm.streams {
+		result[key] = stream.Status()
 	}
-	result += "}"
 	return result
 }
 
-// Subscribe adds a client to a station stream
-func (sm *StreamManager) Subscribe(ctx context.Context, w http.ResponseWriter, stationID, clientID string) error {
-	stream, err := sm.getOrCreateStream(stationID)
+// Subscribe adds a client to a station stream in a format, with ICY metadata if icy is set
+func (sm *StreamManager) Subscribe(ctx context.Context, w http.ResponseWriter, stationID string, format Format, clientID string, icy bool) error {
+	stream, err := sm.getOrCreateStream(stationID, format)
 	if err != nil {
 		return err
 	}
 
-	return stream.AddClient(ctx, w, clientID)
+	return stream.AddClient(ctx, w, clientID, icy)
 }
 
 // getOrCreateStream gets an existing stream or creates a new one
-func (sm *StreamManager) getOrCreateStream(stationID string) (*StationStream, error) {
+func (sm *StreamManager) getOrCreateStream(stationID string, format Format) (*StationStream, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	return sm.getOrCreateStreamLocked(stationID, format)
+}
+
+// getOrCreateStreamLocked gets an existing stream or creates a new one. A transcoded
+// stream subscribes to the station's AAC stream, created as well if needed.
+// sm.mu must be held.
+func (sm *StreamManager) getOrCreateStreamLocked(stationID string, format Format) (*StationStream, error) {
+	key := streamKey(stationID, format)
 
 	// Check if stream already exists
-	if stream, exists := sm.streams[stationID]; exists {
+	if stream, exists := sm.streams[key]; exists {
 		stream.CancelGracePeriod() // Cancel any pending shutdown
-		if stream.running {
-			log.Printf("♻️ 既存のffmpegを再利用: %s", stationID)
+		if stream.isRunning() {
+			log.Printf("♻️ 既存のffmpegを再利用: %s", key)
 			return stream, nil
 		}
 	}
 
 	// Create new stream
-	log.Printf("🆕 新しいffmpegを開始: %s", stationID)
-	stream, err := NewStationStream(stationID, sm.graceSeconds, func() {
-		sm.removeStream(stationID)
-	})
+	log.Printf("🆕 新しいffmpegを開始: %s", key)
+	var stream *StationStream
+	onClose := func() {
+		sm.removeStream(key, stream)
+	}
+	var err error
+	if format == FormatAAC {
+		stream, err = NewStationStream(stationID, sm.graceSeconds, sm.policy, onClose)
+	} else {
+		var source *StationStream
+		if source, err = sm.getOrCreateStreamLocked(stationID, FormatAAC); err != nil {
+			return nil, err
+		}
+		stream, err = NewTranscodeStream(source, format, sm.graceSeconds, sm.policy, func() (*StationStream, error) {
+			return sm.getOrCreateStream(stationID, FormatAAC)
+		}, onClose)
+		if err != nil {
+			source.startGracePeriodIfIdle()
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	sm.streams[stationID] = stream
+	sm.streams[key] = stream
 	return stream, nil
 }
 
-// removeStream removes a stream from the manager
-func (sm *StreamManager) removeStream(stationID string) {
+// removeStream removes a stream from the manager, unless a new stream already
+// replaced it
+func (sm *StreamManager) removeStream(key string, stream *StationStream) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	delete(sm.streams, stationID)
-	log.Printf("🗑️ ストリーム削除: %s", stationID)
+	if sm.streams[key] != stream {
+		return
+	}
+	delete(sm.streams, key)
+	log.Printf("🗑️ ストリーム削除: %s", key)
 }
 
 // ============================================================================
 // StationStream - Manages a single station's ffmpeg process and clients
 // ============================================================================
 
-// Client represents a connected client
-type Client struct {
-	id     string
-	writer http.ResponseWriter
-	done   chan struct{}
-}
-
-// StationStream manages a single station's stream
+// StationStream manages a single station's stream in one format: the live AAC
+// stream, or a transcoder fed by it
 type StationStream struct {
 	stationID    string
+	format       Format
+	key          string // streamKey, used in logs
+	areaID       string // Area authenticated for (AAC)
 	mu           sync.RWMutex
 	clients      map[string]*Client
-	running      bool
-	cmd          *exec.Cmd
+	running      bool // ffmpeg runs or is being restarted
+	restarts     int
+	title        string // Program on air (StreamTitle)
+	start        func(context.Context) (*ffmpegProcess, error)
 	cancel       context.CancelFunc
+	done         chan struct{} // Closed when the supervisor ends
 	graceTimer   *time.Timer
 	graceSeconds int
+	policy       ClientPolicy
+	restart      restartPolicy
 	onClose      func()
-
-	// Broadcast channel
-	broadcast chan []byte
+	burst        burstBuffer // Last frames, for new clients
 }
 
+// errStreamEnded is the reason clients are disconnected when the stream cannot be restarted
+var errStreamEnded = errors.New("stream ended")
+
 // NewStationStream creates and starts a new station stream
-func NewStationStream(stationID string, graceSeconds int, onClose func()) (*StationStream, error) {
+func NewStationStream(stationID string, graceSeconds int, policy ClientPolicy, onClose func()) (*StationStream, error) {
 	// Get area for this station
 	areaID, err := api.GetStationArea(stationID)
 	if err != nil {
@@ -270,50 +515,89 @@ func NewStationStream(stationID string, graceSeconds int, onClose func()) (*Stat
 	}
 	log.Printf("📍 エリア: %s", areaID)
 
+	// Create stream
+	stream := &StationStream{
+		stationID:    stationID,
+		format:       FormatAAC,
+		key:          streamKey(stationID, FormatAAC),
+		areaID:       areaID,
+		clients:      make(map[string]*Client),
+		done:         make(chan struct{}),
+		graceSeconds: graceSeconds,
+		policy:       policy,
+		restart:      defaultRestartPolicy,
+		onClose:      onClose,
+		burst:        burstBuffer{capacity: policy.Burst},
+	}
+
+	stream.start = stream.startLive
+
+	if err := stream.run(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// run starts ffmpeg and its supervisor, and follows the program on air
+func (ss *StationStream) run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := ss.start(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	ss.cancel = cancel
+	ss.running = true
+	go ss.supervise(ctx, proc)
+	go ss.watchProgram(ctx)
+	return nil
+}
+
+// startLive authenticates and starts ffmpeg on the station's live stream
+func (ss *StationStream) startLive(ctx context.Context) (*ffmpegProcess, error) {
+	streamURL, authToken, err := ss.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return ss.startFFmpeg(ctx, streamURL, authToken)
+}
+
+// resolve authenticates and returns the URL of the station's live stream with its token
+func (ss *StationStream) resolve() (streamURL, authToken string, err error) {
 	// Authenticate
 	log.Printf("🔐 認証中...")
-	authToken := api.Auth(areaID)
+	authToken = api.Auth(ss.areaID)
 	if authToken == "" {
-		return nil, fmt.Errorf("authentication failed")
+		return "", "", fmt.Errorf("authentication failed")
 	}
 	log.Printf("✓ 認証成功")
 
 	// Get stream URLs
-	playlistURLs, err := api.GetStreamURLs(stationID)
+	playlistURLs, err := api.GetStreamURLs(ss.stationID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stream URL: %w", err)
+		return "", "", fmt.Errorf("failed to get stream URL: %w", err)
 	}
 	if len(playlistURLs) == 0 {
-		return nil, fmt.Errorf("no stream URLs found")
+		return "", "", fmt.Errorf("no stream URLs found")
 	}
 
 	// Build final stream URL
 	lsid := model.GenLsid()
 	lastURL := playlistURLs[len(playlistURLs)-1]
-	streamURL := fmt.Sprintf("%s?station_id=%s&l=30&lsid=%s&type=b", lastURL, stationID, lsid)
-
-	// Create stream
-	stream := &StationStream{
-		stationID:    stationID,
-		clients:      make(map[string]*Client),
-		graceSeconds: graceSeconds,
-		onClose:      onClose,
-		broadcast:    make(chan []byte, 100),
-	}
-
-	// Start ffmpeg
-	if err := stream.startFFmpeg(streamURL, authToken); err != nil {
-		return nil, err
-	}
-
-	return stream, nil
+	streamURL = fmt.Sprintf("%s?station_id=%s&l=30&lsid=%s&type=b", lastURL, ss.stationID, lsid)
+	return streamURL, authToken, nil
 }
 
-// startFFmpeg starts the ffmpeg process
-func (ss *StationStream) startFFmpeg(streamURL, authToken string) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	ss.cancel = cancel
+// ffmpegProcess is a started ffmpeg relaying the station
+type ffmpegProcess struct {
+	cmd        *exec.Cmd
+	stdout     io.Reader
+	stderrDone chan struct{}      // Closed when the error output is logged to the end
+	stopFeed   context.CancelFunc // Unsubscribes a transcoder from its source (nil for live streams)
+}
 
+// startFFmpeg starts the ffmpeg process; it is killed when ctx ends
+func (ss *StationStream) startFFmpeg(ctx context.Context, streamURL, authToken string) (*ffmpegProcess, error) {
 	cmd := exec.CommandContext(ctx, "ffmpeg",
 		"-reconnect", "1",
 		"-reconnect_streamed", "1",
@@ -328,147 +612,151 @@ func (ss *StationStream) startFFmpeg(streamURL, authToken string) error {
 		"-loglevel", "warning",
 		"pipe:1",
 	)
+	return ss.startProcess(cmd)
+}
 
+// startProcess starts an ffmpeg writing the stream to its standard output
+func (ss *StationStream) startProcess(cmd *exec.Cmd) (*ffmpegProcess, error) {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		cancel()
-		return fmt.Errorf("failed to get stdout pipe: %w", err)
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		cancel()
-		return fmt.Errorf("failed to get stderr pipe: %w", err)
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		cancel()
-		return fmt.Errorf("failed to start ffmpeg: %w", err)
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
-	ss.cmd = cmd
-	ss.running = true
-
 	// Log ffmpeg errors
+	stderrDone := make(chan struct{})
 	go func() {
+		defer close(stderrDone)
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
-			log.Printf("ffmpeg [%s]: %s", ss.stationID, scanner.Text())
+			log.Printf("ffmpeg [%s]: %s", ss.key, scanner.Text())
 		}
 	}()
 
-	// Read from ffmpeg and broadcast to clients
-	go ss.readAndBroadcast(stdout)
-
-	// Broadcast to clients
-	go ss.broadcastLoop()
+	log.Printf("▶ ffmpeg開始: %s", ss.key)
+	return &ffmpegProcess{cmd: cmd, stdout: stdout, stderrDone: stderrDone}, nil
+}
 
-	log.Printf("▶ ffmpeg開始: %s", ss.stationID)
-	return nil
+// relay broadcasts the output of proc to the clients until ffmpeg exits
+func (ss *StationStream) relay(proc *ffmpegProcess) error {
+	ss.readAndBroadcast(proc.stdout)
+	<-proc.stderrDone
+	err := proc.cmd.Wait()
+	if proc.stopFeed != nil {
+		proc.stopFeed()
+	}
+	return err
 }
 
-// readAndBroadcast reads from ffmpeg stdout and sends to broadcast channel
+// readAndBroadcast reads from ffmpeg stdout and queues the data for every client
 func (ss *StationStream) readAndBroadcast(stdout io.Reader) {
 	reader := bufio.NewReaderSize(stdout, 32768)
 	buf := make([]byte, 8192)
+	splitter := formatSpecs[ss.format].newFramer()
 	firstData := true
 
 	for {
 		n, err := reader.Read(buf)
 		if n > 0 {
 			if firstData {
-				log.Printf("📦 最初のデータ受信: %s", ss.stationID)
+				log.Printf("📦 最初のデータ受信: %s", ss.key)
 				firstData = false
 			}
 
-			// Copy data to avoid race conditions
-			data := make([]byte, n)
-			copy(data, buf[:n])
-
-			// Non-blocking send to broadcast channel
-			select {
-			case ss.broadcast <- data:
-			default:
-				// Channel full, drop oldest data
-				select {
-				case <-ss.broadcast:
-				default:
-				}
-				ss.broadcast <- data
+			// Whole frames only, copied out of buf
+			data, frames := splitter.split(buf[:n])
+			if len(frames) > 0 {
+				ss.fanOut(chunk{data: data, at: time.Now()}, frames)
 			}
 		}
 
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("❌ ffmpeg読み取りエラー [%s]: %v", ss.stationID, err)
+				log.Printf("❌ ffmpeg読み取りエラー [%s]: %v", ss.key, err)
 			}
 			break
 		}
 	}
-
-	ss.mu.Lock()
-	ss.running = false
-	ss.mu.Unlock()
-
-	close(ss.broadcast)
-	log.Printf("⏹ ffmpeg終了: %s", ss.stationID)
 }
 
-// broadcastLoop sends data to all connected clients
-func (ss *StationStream) broadcastLoop() {
-	for data := range ss.broadcast {
-		ss.mu.RLock()
-		clients := make([]*Client, 0, len(ss.clients))
-		for _, c := range ss.clients {
-			clients = append(clients, c)
-		}
-		ss.mu.RUnlock()
-
-		for _, client := range clients {
-			select {
-			case <-client.done:
-				continue
-			default:
-				_, err := client.writer.Write(data)
-				if err != nil {
-					close(client.done)
-					continue
-				}
-				if f, ok := client.writer.(http.Flusher); ok {
-					f.Flush()
-				}
-			}
-		}
+// fanOut keeps the frames for the burst and queues them for every client. It never
+// waits for a client: each one writes its own queue, so a slow listener cannot hold
+// back the others.
+func (ss *StationStream) fanOut(ch chunk, frames []audioFrame) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.burst.add(frames)
+	for _, client := range ss.clients {
+		client.enqueue(ch, ss.policy)
 	}
 }
 
-// AddClient adds a client to this stream
-func (ss *StationStream) AddClient(ctx context.Context, w http.ResponseWriter, clientID string) error {
-	client := &Client{
-		id:     clientID,
-		writer: w,
-		done:   make(chan struct{}),
-	}
-
+// AddClient adds a client to this stream and writes the stream to it until the
+// client disconnects, falls too far behind or the stream ends. With icy, the
+// program title is interleaved as ICY metadata.
+func (ss *StationStream) AddClient(ctx context.Context, w io.Writer, clientID string, icy bool) error {
+	// The burst ends where the client's queue starts: both are taken under ss.mu
 	ss.mu.Lock()
+	if !ss.running {
+		ss.mu.Unlock()
+		return errStreamEnded
+	}
+	burst := append(slices.Clip(formatSpecs[ss.format].prefix), ss.burst.bytes()...)
+	client := newClient(clientID, w, ss.policy.QueueSize, burst)
+	if icy {
+		client.out = newICYWriter(w, ss.Title)
+	}
 	ss.clients[clientID] = client
 	clientCount := len(ss.clients)
 	ss.mu.Unlock()
 
-	log.Printf("📊 クライアント追加 [%s]: %d 接続中", ss.stationID, clientCount)
+	log.Printf("📊 クライアント追加 [%s]: %d 接続中", ss.key, clientCount)
+
+	client.run(ctx)
 
-	// Wait for client disconnect or stream end
 	select {
-	case <-ctx.Done():
-		// Client disconnected
 	case <-client.done:
-		// Write error occurred
+		if client.err == errClientLagging {
+			log.Printf("🐢 遅延したクライアントを切断 [%s]: %s", ss.key, clientID)
+		}
+	default:
+		// Client disconnected
 	}
 
 	ss.removeClient(clientID)
 	return nil
 }
 
+// Status returns the state of the stream and its clients
+func (ss *StationStream) Status() StreamStatus {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	status := StreamStatus{
+		Format:    ss.format,
+		Clients:   len(ss.clients),
+		Running:   ss.running,
+		Restarts:  ss.restarts,
+		Program:   ss.title,
+		Listeners: make([]ClientStatus, 0, len(ss.clients)),
+	}
+	for _, client := range ss.clients {
+		status.Listeners = append(status.Listeners, client.status())
+	}
+	slices.SortFunc(status.Listeners, func(a, b ClientStatus) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return status
+}
+
 // removeClient removes a client from this stream
 func (ss *StationStream) removeClient(clientID string) {
 	ss.mu.Lock()
@@ -476,7 +764,7 @@ func (ss *StationStream) removeClient(clientID string) {
 	clientCount := len(ss.clients)
 	ss.mu.Unlock()
 
-	log.Printf("📊 クライアント削除 [%s]: %d 接続中", ss.stationID, clientCount)
+	log.Printf("📊 クライアント削除 [%s]: %d 接続中", ss.key, clientCount)
 
 	// If no clients left, start grace period
 	if clientCount == 0 {
@@ -493,7 +781,7 @@ func (ss *StationStream) startGracePeriod() {
 		return // Already running
 	}
 
-	log.Printf("⏰ 猶予期間開始 [%s]: %d秒", ss.stationID, ss.graceSeconds)
+	log.Printf("⏰ 猶予期間開始 [%s]: %d秒", ss.key, ss.graceSeconds)
 
 	ss.graceTimer = time.AfterFunc(time.Duration(ss.graceSeconds)*time.Second, func() {
 		ss.mu.Lock()
@@ -501,7 +789,7 @@ func (ss *StationStream) startGracePeriod() {
 		ss.mu.Unlock()
 
 		if clientCount == 0 {
-			log.Printf("⏰ 猶予期間終了、ffmpeg停止: %s", ss.stationID)
+			log.Printf("⏰ 猶予期間終了、ffmpeg停止: %s", ss.key)
 			ss.Stop()
 		}
 	})
@@ -515,10 +803,28 @@ func (ss *StationStream) CancelGracePeriod() {
 	if ss.graceTimer != nil {
 		ss.graceTimer.Stop()
 		ss.graceTimer = nil
-		log.Printf("⏰ 猶予期間キャンセル: %s", ss.stationID)
+		log.Printf("⏰ 猶予期間キャンセル: %s", ss.key)
+	}
+}
+
+// startGracePeriodIfIdle starts the grace period of a stream without clients
+func (ss *StationStream) startGracePeriodIfIdle() {
+	ss.mu.RLock()
+	clientCount := len(ss.clients)
+	ss.mu.RUnlock()
+
+	if clientCount == 0 {
+		ss.startGracePeriod()
 	}
 }
 
+// isRunning reports whether ffmpeg runs or is being restarted
+func (ss *StationStream) isRunning() bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.running
+}
+
 // Stop stops the ffmpeg process and cleans up
 func (ss *StationStream) Stop() {
 	ss.mu.Lock()
@@ -528,9 +834,7 @@ func (ss *StationStream) Stop() {
 	ss.running = false
 	ss.mu.Unlock()
 
-	if ss.cmd != nil {
-		ss.cmd.Wait()
-	}
+	<-ss.done
 
 	if ss.onClose != nil {
 		ss.onClose()
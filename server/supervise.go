@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// restartPolicy controls how ffmpeg is restarted after it exits
+type restartPolicy struct {
+	delay       time.Duration // Wait before the first restart, doubled per failed attempt
+	maxDelay    time.Duration // Upper bound of the wait
+	maxRestarts int           // Failed attempts in a row before the clients are let go
+	stable      time.Duration // A run this long counts as a success
+}
+
+// defaultRestartPolicy is the restart policy of every stream
+var defaultRestartPolicy = restartPolicy{
+	delay:       time.Second,
+	maxDelay:    30 * time.Second,
+	maxRestarts: 6,
+	stable:      time.Minute,
+}
+
+// supervise relays proc and restarts ffmpeg into the same stream whenever it exits
+// (expired token, upstream failure beyond ffmpeg's own reconnects), so that the
+// clients keep their connections through a short gap. Each restart of a live
+// stream authenticates again and fetches fresh stream URLs; a transcoder
+// subscribes to the station again. It returns when the stream is stopped or
+// cannot be restarted, letting the remaining clients go.
+func (ss *StationStream) supervise(ctx context.Context, proc *ffmpegProcess) {
+	defer close(ss.done)
+	defer ss.end()
+
+	failures := 0
+	for {
+		started := time.Now()
+		err := ss.relay(proc)
+		if ctx.Err() != nil {
+			log.Printf("⏹ ffmpeg終了: %s", ss.key)
+			return
+		}
+		if err != nil {
+			log.Printf("⚠ ffmpegが終了しました [%s]: %v", ss.key, err)
+		} else {
+			log.Printf("⚠ ffmpegが終了しました [%s]", ss.key)
+		}
+		if time.Since(started) >= ss.restart.stable {
+			failures = 0
+		}
+
+		for proc = nil; proc == nil; {
+			if failures >= ss.restart.maxRestarts {
+				log.Printf("❌ ffmpegを再起動できませんでした [%s]: %d回失敗", ss.key, failures)
+				return
+			}
+			delay := min(ss.restart.delay<<failures, ss.restart.maxDelay)
+			failures++
+			log.Printf("🔄 ffmpeg再起動 [%s]: %v後 (%d/%d)", ss.key, delay, failures, ss.restart.maxRestarts)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			var err error
+			if proc, err = ss.start(ctx); err != nil {
+				log.Printf("❌ ffmpeg再起動失敗 [%s]: %v", ss.key, err)
+			}
+		}
+
+		ss.mu.Lock()
+		ss.restarts++
+		ss.mu.Unlock()
+	}
+}
+
+// end marks the stream as ended and disconnects its clients, which then start
+// the grace period that removes the stream
+func (ss *StationStream) end() {
+	ss.mu.Lock()
+	ss.running = false
+	for _, client := range ss.clients {
+		client.close(errStreamEnded)
+	}
+	ss.mu.Unlock()
+
+	ss.startGracePeriodIfIdle()
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"radiko-tui/internal/adts/adtstest"
+)
+
+// scriptedStarts replaces the start of a stream: each call runs the fake ffmpeg on
+// the next input, and fails once there is none left
+type scriptedStarts struct {
+	mu     sync.Mutex
+	inputs []io.Reader
+	calls  []time.Time
+}
+
+func (s *scriptedStarts) start(ss *StationStream) func(context.Context) (*ffmpegProcess, error) {
+	return func(ctx context.Context) (*ffmpegProcess, error) {
+		s.mu.Lock()
+		s.calls = append(s.calls, time.Now())
+		if len(s.inputs) == 0 {
+			s.mu.Unlock()
+			return nil, errors.New("no input left")
+		}
+		input := s.inputs[0]
+		s.inputs = s.inputs[1:]
+		s.mu.Unlock()
+
+		cmd := exec.CommandContext(ctx, "ffmpeg")
+		cmd.Stdin = input
+		return ss.startProcess(cmd)
+	}
+}
+
+func (s *scriptedStarts) callTimes() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.calls...)
+}
+
+// heldInput keeps ffmpeg running for d from its first read
+type heldInput struct {
+	d     time.Duration
+	once  sync.Once
+	pipe  *io.PipeReader
+	close func()
+}
+
+func (h *heldInput) Read(p []byte) (int, error) {
+	h.once.Do(func() { time.AfterFunc(h.d, h.close) })
+	return h.pipe.Read(p)
+}
+
+// runningFor returns an input that keeps ffmpeg running for d
+func runningFor(t *testing.T, d time.Duration) io.Reader {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return &heldInput{d: d, pipe: r, close: func() { w.Close() }}
+}
+
+// supervised starts ss with its supervisor, without following the program on air
+func supervised(t *testing.T, ss *StationStream) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := ss.start(ctx)
+	if err != nil {
+		cancel()
+		t.Fatalf("start: %v", err)
+	}
+	ss.cancel = cancel
+	go ss.supervise(ctx, proc)
+	t.Cleanup(ss.Stop)
+}
+
+func TestSuperviseRestartKeepsClients(t *testing.T) {
+	starts := fakeFFmpeg(t)
+	ss := testStream(t, FormatAAC, 0)
+	ss.restart = restartPolicy{delay: 10 * time.Millisecond, maxDelay: 10 * time.Millisecond, maxRestarts: 3, stable: time.Minute}
+	first, firstIn := io.Pipe()
+	second, secondIn := io.Pipe()
+	runs := &scriptedStarts{inputs: []io.Reader{first, second}}
+	ss.start = runs.start(ss)
+	supervised(t, ss)
+	t.Cleanup(func() {
+		firstIn.Close()
+		secondIn.Close()
+	})
+	out := addClient(t, ss, "listener")
+
+	var before, after []byte
+	for i := range 5 {
+		before = append(before, adtstest.Frame(100+i, byte(i))...)
+		after = append(after, adtstest.Frame(100+i, byte(0x10+i))...)
+	}
+	firstIn.Write(before)
+	waitSuffix(t, out, before)
+
+	// ffmpeg exits: the next run feeds the same client
+	firstIn.Close()
+	secondIn.Write(after)
+	got := waitSuffix(t, out, after)
+
+	if !bytes.Equal(got, append(before, after...)) {
+		t.Errorf("client received %d bytes, want both runs (%d bytes)", len(got), len(before)+len(after))
+	}
+	if n := starts(); n != 2 {
+		t.Errorf("ffmpeg started %d times, want 2", n)
+	}
+	if status := ss.Status(); !status.Running || status.Restarts != 1 || status.Clients != 1 {
+		t.Errorf("status %+v, want running with the client and one restart", status)
+	}
+}
+
+func TestSuperviseGivesUp(t *testing.T) {
+	const (
+		quick = 0
+		long  = 300 * time.Millisecond // Longer than the stable run of the policy
+	)
+	policy := restartPolicy{delay: 5 * time.Millisecond, maxDelay: 20 * time.Millisecond, stable: 200 * time.Millisecond}
+
+	tests := []struct {
+		name        string
+		maxRestarts int
+		runs        []time.Duration // How long each ffmpeg run lasts; later starts fail
+		wantDelays  []time.Duration // Least time between two starts, in milliseconds
+	}{
+		{"backoff up to the max delay", 4, []time.Duration{quick}, []time.Duration{5, 10, 20, 20}},
+		{"quick runs count as failures", 2, []time.Duration{quick, quick, quick, quick}, []time.Duration{5, 10}},
+		{"a stable run resets the failures", 2, []time.Duration{quick, quick, long, quick, quick}, []time.Duration{5, 10, 300 + 5, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeFFmpeg(t)
+			ss := testStream(t, FormatAAC, 0)
+			ss.restart = policy
+			ss.restart.maxRestarts = tt.maxRestarts
+			runs := &scriptedStarts{}
+			for _, d := range tt.runs {
+				if d == quick {
+					runs.inputs = append(runs.inputs, strings.NewReader(""))
+				} else {
+					runs.inputs = append(runs.inputs, runningFor(t, d))
+				}
+			}
+			ss.start = runs.start(ss)
+			supervised(t, ss)
+			addClient(t, ss, "listener")
+			ss.mu.RLock()
+			client := ss.clients["listener"]
+			ss.mu.RUnlock()
+
+			select {
+			case <-ss.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the supervisor did not give up")
+			}
+
+			calls := runs.callTimes()
+			if len(calls) != len(tt.wantDelays)+1 {
+				t.Fatalf("%d starts, want %d", len(calls), len(tt.wantDelays)+1)
+			}
+			for i, want := range tt.wantDelays {
+				if gap := calls[i+1].Sub(calls[i]); gap < want*time.Millisecond {
+					t.Errorf("start %d after %v, want at least %v", i+2, gap, want*time.Millisecond)
+				}
+			}
+			if ss.isRunning() {
+				t.Error("stream still running after the supervisor gave up")
+			}
+			<-client.done
+			if client.err != errStreamEnded {
+				t.Errorf("client closed with %v, want errStreamEnded", client.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// NewTranscodeStream creates and starts a stream converting the station's AAC
+// stream source to format. The transcoder subscribes to source like a client,
+// so one connection to Radiko serves every format, and has clients, burst and
+// grace period of its own. resubscribe returns the AAC stream when ffmpeg is
+// restarted.
+func NewTranscodeStream(source *StationStream, format Format, graceSeconds int, policy ClientPolicy, resubscribe func() (*StationStream, error), onClose func()) (*StationStream, error) {
+	stream := &StationStream{
+		stationID:    source.stationID,
+		format:       format,
+		key:          streamKey(source.stationID, format),
+		clients:      make(map[string]*Client),
+		done:         make(chan struct{}),
+		graceSeconds: graceSeconds,
+		policy:       policy,
+		restart:      defaultRestartPolicy,
+		onClose:      onClose,
+		burst:        burstBuffer{capacity: policy.Burst},
+	}
+	stream.start = func(ctx context.Context) (*ffmpegProcess, error) {
+		src := source
+		source = nil
+		if src == nil {
+			var err error
+			if src, err = resubscribe(); err != nil {
+				return nil, err
+			}
+		}
+		return stream.startTranscoder(ctx, src)
+	}
+
+	if err := stream.run(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// startTranscoder starts an ffmpeg encoding the AAC of src, which it feeds as a
+// client of src until ffmpeg exits
+func (ss *StationStream) startTranscoder(ctx context.Context, src *StationStream) (*ffmpegProcess, error) {
+	args := []string{"-f", "aac", "-i", "pipe:0", "-vn"}
+	args = append(args, formatSpecs[ss.format].codecArgs...)
+	args = append(args, "-flush_packets", "1", "-loglevel", "warning", "pipe:1")
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+	proc, err := ss.startProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	feedCtx, stopFeed := context.WithCancel(ctx)
+	proc.stopFeed = stopFeed
+	feedID := fmt.Sprintf("%s-%d", ss.key, time.Now().UnixNano())
+	go func() {
+		// Closing the input lets ffmpeg finish when the source ends
+		defer stdin.Close()
+		if err := src.AddClient(feedCtx, stdin, feedID, false); err != nil {
+			log.Printf("❌ 変換元ストリームエラー [%s]: %v", ss.key, err)
+		}
+	}()
+	return proc, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg in PATH that copies its input to its output, and
+// returns a function counting how many times it was started
+func fakeFFmpeg(t *testing.T) func() int {
+	t.Helper()
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	script := "#!/bin/sh\necho >> '" + starts + "'\nexec cat\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() int {
+		data, _ := os.ReadFile(starts)
+		return bytes.Count(data, []byte("\n"))
+	}
+}
+
+// waitClients waits until ss has n clients
+func waitClients(t *testing.T, ss *StationStream, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for ss.Status().Clients != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d clients, want %d", ss.key, ss.Status().Clients, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTranscoderSharedByListeners(t *testing.T) {
+	starts := fakeFFmpeg(t)
+
+	// The AAC stream is fed by the test; the fake transcoder passes MP3 through
+	source := testStream(t, FormatAAC, 0)
+	source.stationID = "TEST"
+	sm := NewStreamManager(60)
+	sm.policy.Burst = 5 * 24 * time.Millisecond
+	sm.streams[source.key] = source
+
+	var stream []byte
+	boundaries := map[int]bool{}
+	send := func(from, to int) {
+		for i := from; i < to; i++ {
+			frame := mp3Frame(0xFB, 0x94, 384, byte(i))
+			boundaries[len(stream)] = true
+			stream = append(stream, frame...)
+			source.fanOut(chunk{data: frame, at: time.Now()}, []audioFrame{{data: frame, duration: 24 * time.Millisecond}})
+		}
+	}
+
+	first, err := sm.getOrCreateStream("TEST", FormatMP3)
+	if err != nil {
+		t.Fatalf("first listener: %v", err)
+	}
+	t.Cleanup(func() {
+		first.Stop()
+		first.CancelGracePeriod()
+	})
+	out1 := addClient(t, first, "listener-1")
+	// The transcoder subscribes to the AAC stream
+	waitClients(t, source, 1)
+
+	send(0, 20)
+	waitSuffix(t, out1, stream[len(stream)-384:])
+
+	second, err := sm.getOrCreateStream("TEST", FormatMP3)
+	if err != nil {
+		t.Fatalf("second listener: %v", err)
+	}
+	if second != first {
+		t.Fatal("second listener got a new transcoder")
+	}
+	out2 := addClient(t, second, "listener-2")
+	joined := len(stream)
+
+	send(20, 30)
+	got1 := waitSuffix(t, out1, stream[len(stream)-384:])
+	got2 := waitSuffix(t, out2, stream[len(stream)-384:])
+
+	if !bytes.Equal(got1, stream) {
+		t.Errorf("first listener received %d bytes, want the whole stream of %d", len(got1), len(stream))
+	}
+	start := len(stream) - len(got2)
+	if !bytes.HasSuffix(stream, got2) || !boundaries[start] {
+		t.Errorf("second listener starts at byte %d, not on a frame", start)
+	}
+	if start == 0 || start >= joined {
+		t.Errorf("second listener starts at byte %d, want a burst before byte %d", start, joined)
+	}
+
+	if n := starts(); n != 1 {
+		t.Errorf("ffmpeg started %d times, want once", n)
+	}
+	if status := first.Status(); !status.Running || status.Restarts != 0 || status.Clients != 2 {
+		t.Errorf("transcoder status %+v, want running with 2 clients and no restart", status)
+	}
+	if n := source.Status().Clients; n != 1 {
+		t.Errorf("AAC stream has %d clients, want the one transcoder", n)
+	}
+}
@@ -3,14 +3,19 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
+	"radiko-tui/alarm"
 	"radiko-tui/api"
 	"radiko-tui/config"
 	"radiko-tui/model"
 	"radiko-tui/player"
+	"radiko-tui/recorder"
 
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
@@ -24,6 +29,7 @@ const (
 	FocusStations FocusMode = iota
 	FocusRegion
 	FocusVolume
+	FocusGuide
 )
 
 // KeyMap defines keyboard shortcuts
@@ -38,6 +44,20 @@ type KeyMap struct {
 	Mute      key.Binding
 	Reconnect key.Binding
 	Record    key.Binding
+	RecordAgo key.Binding
+	Guide     key.Binding
+	Pause     key.Binding
+	SeekBack  key.Binding
+	SeekFwd   key.Binding
+	SkipBack  key.Binding
+	SkipFwd   key.Binding
+	GoLive    key.Binding
+	Sleep     key.Binding
+	SleepRec  key.Binding
+	Snooze    key.Binding
+	EQ        key.Binding
+	Normalize key.Binding
+	Meter     key.Binding
 	Quit      key.Binding
 }
 
@@ -48,7 +68,9 @@ func (k KeyMap) ShortHelp() []key.Binding {
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.Left, k.Right, k.Select},
-		{k.VolUp, k.VolDown, k.Mute, k.Reconnect, k.Quit},
+		{k.VolUp, k.VolDown, k.Mute, k.Reconnect, k.Record, k.RecordAgo, k.Quit},
+		{k.Guide, k.Pause, k.SeekBack, k.SeekFwd, k.SkipBack, k.SkipFwd, k.GoLive},
+		{k.Sleep, k.SleepRec, k.Snooze, k.EQ, k.Normalize, k.Meter},
 	}
 }
 
@@ -63,6 +85,20 @@ var DefaultKeyMap = KeyMap{
 	Mute:      key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "ミュート")),
 	Reconnect: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "再接続")),
 	Record:    key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "録音")),
+	RecordAgo: key.NewBinding(key.WithKeys("S"), key.WithHelp("S", "直前から録音")),
+	Guide:     key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "番組表")),
+	Pause:     key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "一時停止")),
+	SeekBack:  key.NewBinding(key.WithKeys("["), key.WithHelp("[", "30秒戻る")),
+	SeekFwd:   key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "30秒進む")),
+	SkipBack:  key.NewBinding(key.WithKeys("{"), key.WithHelp("{", "5分戻る")),
+	SkipFwd:   key.NewBinding(key.WithKeys("}"), key.WithHelp("}", "5分進む")),
+	GoLive:    key.NewBinding(key.WithKeys("L"), key.WithHelp("L", "ライブへ")),
+	Sleep:     key.NewBinding(key.WithKeys("z"), key.WithHelp("z", "おやすみタイマー")),
+	SleepRec:  key.NewBinding(key.WithKeys("Z"), key.WithHelp("Z", "タイマーで録音も停止")),
+	Snooze:    key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "スヌーズ")),
+	EQ:        key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "EQ切替")),
+	Normalize: key.NewBinding(key.WithKeys("E"), key.WithHelp("E", "音量の自動調整")),
+	Meter:     key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "レベルメーター")),
 	Quit:      key.NewBinding(key.WithKeys("ctrl+c", "esc"), key.WithHelp("Esc", "終了/戻る")),
 }
 
@@ -95,6 +131,20 @@ var (
 	nowPlayingStyle             = lipgloss.NewStyle().Foreground(playingColor).Bold(true)
 	reconnectStyle              = lipgloss.NewStyle().Foreground(warningColor)
 	recordingStyle              = lipgloss.NewStyle().Foreground(recordingColor).Bold(true)
+	guideTitleStyle             = lipgloss.NewStyle().Foreground(textColor).Bold(true)
+	timefreeStyle               = lipgloss.NewStyle().Foreground(regionColor)
+	sleepStyle                  = lipgloss.NewStyle().Foreground(accentColor)
+	boostStyle                  = lipgloss.NewStyle().Foreground(warningColor)
+	meterStyle                  = lipgloss.NewStyle().Foreground(playingColor)
+	meterHotStyle               = lipgloss.NewStyle().Foreground(warningColor)
+	meterClipStyle              = lipgloss.NewStyle().Foreground(recordingColor)
+)
+
+// seekStep and skipStep are the amounts moved by SeekBack/SeekFwd and SkipBack/SkipFwd
+// during timefree or time-shifted live playback
+const (
+	seekStep = 30 * time.Second
+	skipStep = 5 * time.Minute
 )
 
 // PlayingInfo holds information about the currently playing station
@@ -102,16 +152,26 @@ type PlayingInfo struct {
 	StationID      string
 	StationName    string
 	CurrentProgram string
+	Program        *model.GuideProgram // Program being played (nil if unknown)
+	Timefree       bool                // Playing a past broadcast
 }
 
 // SharedState holds shared state between components
 type SharedState struct {
-	Player        *player.FFmpegPlayer
+	Player        player.Player
 	AuthToken     string
 	Volume        float64
 	Muted         bool
 	CurrentAreaID string
 	Playing       *PlayingInfo
+	Scheduler     *recorder.Scheduler    // Recording reservations (may be nil)
+	Recording     config.RecordingConfig // How on-demand recordings are named and split
+	Events        <-chan player.Event    // Events of Player
+	Sleep         config.SleepConfig     // Sleep timer choices
+	Audio         config.AudioConfig     // Processing of the played audio
+	Alarm         *alarm.Clock           // Alarm clock (may be nil)
+	Alarms        chan alarm.Ring        // Alarms rung by Alarm
+	AlarmRamp     context.CancelFunc     // Stops the volume ramp-up of the ringing alarm
 }
 
 // Model is the TUI model
@@ -132,6 +192,30 @@ type Model struct {
 	selectedArea int
 	isLoading    bool
 	focus        FocusMode
+
+	// Program guide (EPG)
+	guideStation  model.Station
+	guidePrograms []model.GuideProgram
+	guideCursor   int
+	guideLoading  bool
+
+	// Reconnection in progress, from player events (nil while connected)
+	connEvent *player.Event
+
+	// Dead air being heard, from player events (nil while the audio is normal)
+	deadAirEvent *player.Event
+
+	// Sleep timer choice: 0 = off, 1..len(Sleep.Minutes) = minutes, then end of program
+	sleepStep int
+
+	// An alarm is playing and can be snoozed
+	alarmRinging bool
+
+	// Generation of the level meter refresh, so that only the latest keeps ticking
+	meterGen int
+
+	// Quitting once the recording file is written
+	quitting bool
 }
 
 // Message types
@@ -145,12 +229,42 @@ type playResultMsg struct {
 	stationIdx  int
 	stationID   string
 	stationName string
+	program     *model.GuideProgram // Set for timefree playback
 }
 type reconnectResultMsg struct{ err error }
-type programUpdateMsg struct{ program string }
+type programUpdateMsg struct {
+	stationID string
+	program   *model.GuideProgram
+}
+type guideLoadedMsg struct {
+	stationID string
+	programs  []model.GuideProgram
+	err       error
+}
+type guideEvaluatedMsg struct {
+	added int
+	err   error
+}
 type tickMsg struct{}
+type meterTickMsg struct{ gen int }
+type playerEventMsg player.Event
+type clipSavedMsg struct {
+	filePath string
+	err      error
+}
+type recordingStartedMsg struct {
+	status string // Status line shown once started
+	err    error
+}
+type alarmRingMsg alarm.Ring
+type alarmWokeMsg struct {
+	ring alarm.Ring
+	err  error
+}
+
+func NewModel(stations []model.Station, authToken string, cfg config.Config, scheduler *recorder.Scheduler) Model {
+	initialVolume, lastStationID, areaID := cfg.Volume, cfg.LastStationID, cfg.AreaID
 
-func NewModel(stations []model.Station, authToken string, initialVolume float64, lastStationID string, areaID string) Model {
 	areas := model.AllAreas()
 
 	currentAreaIdx := 0
@@ -194,11 +308,36 @@ func NewModel(stations []model.Station, authToken string, initialVolume float64,
 		Muted:         false,
 		CurrentAreaID: areaID,
 		Playing:       nil,
+		Scheduler:     scheduler,
+		Recording:     cfg.Recording,
+		Sleep:         cfg.Sleep,
+		Audio:         cfg.Audio,
 	}
 
 	p.SetReconnectCallback(func() string {
 		return api.Auth(shared.CurrentAreaID)
 	})
+	p.SetProgramLookup(api.GetProgramAt)
+	p.SetTimeshiftDuration(time.Duration(cfg.TimeshiftMinutes) * time.Minute)
+	p.SetReconnectPolicy(player.ReconnectPolicyFromConfig(cfg.Reconnect))
+	p.SetSilencePolicy(player.SilencePolicyFromConfig(cfg.Silence))
+	p.SetDSPOptions(player.DSPOptionsFromConfig(cfg.Audio))
+	shared.Events, _ = p.Subscribe()
+
+	// Alarms ring into a channel read by the TUI loop
+	var alarmErr string
+	shared.Alarms = make(chan alarm.Ring, 4)
+	clock, err := alarm.NewClock(cfg.Alarm, func(ring alarm.Ring) {
+		select {
+		case shared.Alarms <- ring:
+		default:
+		}
+	})
+	if err != nil {
+		alarmErr = fmt.Sprintf("アラーム設定エラー: %v", err)
+	}
+	clock.Start()
+	shared.Alarm = clock
 
 	return Model{
 		stations:      stations,
@@ -212,6 +351,7 @@ func NewModel(stations []model.Station, authToken string, initialVolume float64,
 		currentArea:   currentAreaIdx,
 		selectedArea:  currentAreaIdx,
 		focus:         FocusStations,
+		errorMessage:  alarmErr,
 	}
 }
 
@@ -219,22 +359,79 @@ func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		func() tea.Msg { return autoPlayMsg{} },
 		tickCmd(),
+		m.meterTickCmd(),
+		waitForEvent(m.shared.Events),
+		waitForAlarm(m.shared.Alarms),
 	)
 }
 
+// waitForAlarm waits for the next alarm to ring
+func waitForAlarm(alarms <-chan alarm.Ring) tea.Cmd {
+	if alarms == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return alarmRingMsg(<-alarms)
+	}
+}
+
+// waitForEvent waits for the next player event
+func waitForEvent(events <-chan player.Event) tea.Cmd {
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		ev, ok := <-events
+		if !ok {
+			return nil
+		}
+		return playerEventMsg(ev)
+	}
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(1*time.Second, func(t time.Time) tea.Msg {
 		return tickMsg{}
 	})
 }
 
+// meterRefresh is how often the level meter is redrawn
+const meterRefresh = 100 * time.Millisecond
+
+// meterTickCmd redraws the level meter while it is shown
+func (m Model) meterTickCmd() tea.Cmd {
+	if m.shared.Audio.Meter == "" || m.shared.Audio.Meter == "off" {
+		return nil
+	}
+	gen := m.meterGen
+	return tea.Tick(meterRefresh, func(time.Time) tea.Msg {
+		return meterTickMsg{gen: gen}
+	})
+}
+
 func fetchProgramCmd(stationID string) tea.Cmd {
 	return func() tea.Msg {
-		prog, err := api.GetCurrentProgram(stationID)
-		if err != nil || prog == nil {
-			return programUpdateMsg{program: ""}
+		prog, err := api.GetProgramAt(stationID, time.Now())
+		if err != nil {
+			return programUpdateMsg{stationID: stationID}
 		}
-		return programUpdateMsg{program: prog.Title}
+		return programUpdateMsg{stationID: stationID, program: prog}
+	}
+}
+
+func fetchGuideCmd(stationID string) tea.Cmd {
+	return func() tea.Msg {
+		// Start from yesterday so that last night's programs can be played as timefree
+		programs, err := api.GetGuide(stationID, time.Now().AddDate(0, 0, -1), api.GuideDays+1)
+		return guideLoadedMsg{stationID: stationID, programs: programs, err: err}
+	}
+}
+
+// evaluateGuideCmd reserves the programs of a loaded guide that match an auto-recording rule
+func evaluateGuideCmd(scheduler *recorder.Scheduler, programs []model.GuideProgram) tea.Cmd {
+	return func() tea.Msg {
+		added, err := scheduler.EvaluateGuide(programs)
+		return guideEvaluatedMsg{added: added, err: err}
 	}
 }
 
@@ -245,29 +442,80 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 
-	case tickMsg:
-		// Check reconnection status
-		if m.shared.Player != nil {
-			status := m.shared.Player.GetReconnectStatus()
-			if status == player.ReconnectSuccess {
-				m.statusMessage = "再接続成功"
-				m.shared.Player.ClearReconnectStatus()
-			} else if status == player.ReconnectFailed {
-				m.errorMessage = "再接続失敗: " + m.shared.Player.GetLastError()
-				m.shared.Player.ClearReconnectStatus()
-			}
+	case playerEventMsg:
+		m.handlePlayerEvent(player.Event(msg))
+		return m, waitForEvent(m.shared.Events)
+
+	case alarmRingMsg:
+		return m, tea.Batch(m.wakeUp(alarm.Ring(msg)), waitForAlarm(m.shared.Alarms))
+
+	case alarmWokeMsg:
+		if msg.err != nil {
+			m.errorMessage = fmt.Sprintf("アラーム再生失敗 [%s]: %v", msg.ring.Alarm.StationID, msg.err)
+			return m, nil
+		}
+		m.shared.Playing = &PlayingInfo{
+			StationID:   msg.ring.Alarm.StationID,
+			StationName: m.stationName(msg.ring.Alarm.StationID),
 		}
+		m.shared.Muted = false
+		m.alarmRinging = true
+		m.errorMessage = ""
+		m.statusMessage = fmt.Sprintf("⏰ アラーム %s  n スヌーズ", msg.ring.Due.Format("15:04"))
+		return m, fetchProgramCmd(msg.ring.Alarm.StationID)
 
+	case tickMsg:
 		// Refresh program info every 30 seconds
 		var cmd tea.Cmd
-		if m.shared.Playing != nil && time.Now().Second()%30 == 0 {
+		if m.shared.Playing != nil && !m.shared.Playing.Timefree && time.Now().Second()%30 == 0 {
 			cmd = fetchProgramCmd(m.shared.Playing.StationID)
 		}
 		return m, tea.Batch(cmd, tickCmd())
 
+	case meterTickMsg:
+		if msg.gen != m.meterGen {
+			return m, nil
+		}
+		return m, m.meterTickCmd()
+
 	case programUpdateMsg:
-		if m.shared.Playing != nil {
-			m.shared.Playing.CurrentProgram = msg.program
+		if m.shared.Playing != nil && !m.shared.Playing.Timefree && m.shared.Playing.StationID == msg.stationID {
+			m.shared.Playing.Program = msg.program
+			m.shared.Playing.CurrentProgram = ""
+			if msg.program != nil {
+				m.shared.Playing.CurrentProgram = msg.program.Title
+			}
+		}
+		return m, nil
+
+	case guideLoadedMsg:
+		if msg.stationID != m.guideStation.ID {
+			return m, nil
+		}
+		m.guideLoading = false
+		if msg.err != nil {
+			m.errorMessage = fmt.Sprintf("番組表の取得に失敗しました: %v", msg.err)
+			return m, nil
+		}
+		m.guidePrograms = msg.programs
+		m.guideCursor = 0
+		now := time.Now()
+		for i, prog := range msg.programs {
+			if !prog.IsPast(now) {
+				m.guideCursor = i
+				break
+			}
+		}
+		if m.shared.Scheduler != nil {
+			return m, evaluateGuideCmd(m.shared.Scheduler, msg.programs)
+		}
+		return m, nil
+
+	case guideEvaluatedMsg:
+		if msg.err != nil {
+			m.errorMessage = fmt.Sprintf("自動録音ルールの評価に失敗しました: %v", msg.err)
+		} else if msg.added > 0 {
+			m.statusMessage = fmt.Sprintf("自動録音ルール: %d件予約しました", msg.added)
 		}
 		return m, nil
 
@@ -303,6 +551,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m.statusMessage = ""
 			m.errorMessage = ""
+			if msg.program != nil {
+				m.shared.Playing.Program = msg.program
+				m.shared.Playing.CurrentProgram = msg.program.Title
+				m.shared.Playing.Timefree = true
+				m.dismissAlarm()
+				return m, nil
+			}
+			m.dismissAlarm()
 			m.saveConfig()
 			return m, fetchProgramCmd(msg.stationID)
 		}
@@ -316,6 +572,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case clipSavedMsg:
+		if msg.err != nil {
+			m.errorMessage = msg.err.Error()
+		} else {
+			m.statusMessage = fmt.Sprintf("録音保存: %s", msg.filePath)
+		}
+		return m, nil
+
+	case recordingStartedMsg:
+		if msg.err != nil {
+			m.errorMessage = msg.err.Error()
+		} else {
+			m.statusMessage = msg.status
+		}
+		return m, nil
+
 	case tea.KeyMsg:
 		if m.isLoading {
 			return m, nil
@@ -329,6 +601,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.focus == FocusRegion {
 			return m.handleRegionKeys(msg)
 		}
+		if m.focus == FocusGuide {
+			return m.handleGuideKeys(msg)
+		}
 		return m.handleStationKeys(msg)
 	}
 
@@ -404,25 +679,118 @@ func (m Model) handleStationKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case key.Matches(msg, m.keys.Record):
 		if m.shared.Player != nil && m.shared.Playing != nil {
-			started, filePath, err := m.shared.Player.ToggleRecording(m.shared.Playing.StationName)
+			if m.shared.Player.IsRecording() {
+				return m, m.stopRecording()
+			}
+			return m, m.startRecording(m.recordingOptions(), "録音開始")
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.RecordAgo):
+		if m.shared.Player != nil && m.shared.Playing != nil {
+			return m, m.recordAgo()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Guide):
+		if len(m.stations) > 0 {
+			return m, m.openGuide()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Pause):
+		if m.shared.Player != nil && m.shared.Playing != nil {
+			paused, err := m.shared.Player.TogglePause()
 			if err != nil {
 				m.errorMessage = err.Error()
-			} else if started {
-				m.statusMessage = "録音開始"
+			} else if paused {
+				m.statusMessage = "一時停止"
 			} else {
-				m.statusMessage = fmt.Sprintf("録音保存: %s", filePath)
+				m.statusMessage = "再生再開"
 			}
 		}
 		return m, nil
 
+	case key.Matches(msg, m.keys.SeekBack), key.Matches(msg, m.keys.SeekFwd),
+		key.Matches(msg, m.keys.SkipBack), key.Matches(msg, m.keys.SkipFwd):
+		if m.shared.Player != nil && m.shared.Playing != nil {
+			var delta time.Duration
+			switch {
+			case key.Matches(msg, m.keys.SeekBack):
+				delta = -seekStep
+			case key.Matches(msg, m.keys.SeekFwd):
+				delta = seekStep
+			case key.Matches(msg, m.keys.SkipBack):
+				delta = -skipStep
+			default:
+				delta = skipStep
+			}
+			if err := m.shared.Player.SeekRelative(delta); err != nil {
+				m.errorMessage = err.Error()
+			}
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.GoLive):
+		if m.shared.Player != nil && m.shared.Playing != nil && !m.shared.Playing.Timefree {
+			if err := m.shared.Player.GoLive(); err != nil {
+				m.errorMessage = err.Error()
+			} else {
+				m.statusMessage = "ライブに戻りました"
+			}
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Sleep):
+		if m.shared.Player != nil && m.shared.Playing != nil {
+			m.cycleSleepTimer()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.SleepRec):
+		if m.shared.Player != nil {
+			m.toggleSleepRecording()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Snooze):
+		if m.alarmRinging {
+			m.snoozeAlarm()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.EQ):
+		if m.shared.Player != nil && m.shared.Playing != nil {
+			m.cycleEQ()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Normalize):
+		if m.shared.Player != nil {
+			m.toggleNormalize()
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Meter):
+		return m, m.cycleMeter()
+
 	case key.Matches(msg, m.keys.Quit):
+		if m.quitting {
+			return m, nil
+		}
 		m.saveConfig()
-		if m.shared.Player != nil {
-			// Stop recording if active
-			if m.shared.Player.IsRecording() {
-				m.shared.Player.StopRecording()
+		if p := m.shared.Player; p != nil {
+			if p.IsRecording() {
+				// Quit once the recording file is written
+				m.quitting = true
+				m.statusMessage = "録音を保存中..."
+				return m, func() tea.Msg {
+					p.StopRecording()
+					p.Stop()
+					return tea.Quit()
+				}
 			}
-			m.shared.Player.Stop()
+			p.Stop()
 		}
 		return m, tea.Quit
 
@@ -525,6 +893,478 @@ func (m Model) handleVolumeKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleGuideKeys handles keyboard input when the program guide is focused
+func (m Model) handleGuideKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.guideCursor > 0 {
+			m.guideCursor--
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Down):
+		if m.guideCursor < len(m.guidePrograms)-1 {
+			m.guideCursor++
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Left):
+		// Jump to the first program of the previous broadcast day
+		if m.guideCursor < len(m.guidePrograms) {
+			day := model.BroadcastDate(m.guidePrograms[m.guideCursor].Start).AddDate(0, 0, -1)
+			m.guideCursor = m.findGuideDay(day)
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Right):
+		// Jump to the first program of the next broadcast day
+		if m.guideCursor < len(m.guidePrograms) {
+			day := model.BroadcastDate(m.guidePrograms[m.guideCursor].Start).AddDate(0, 0, 1)
+			m.guideCursor = m.findGuideDay(day)
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Select):
+		if m.guideCursor >= len(m.guidePrograms) {
+			return m, nil
+		}
+		prog := m.guidePrograms[m.guideCursor]
+		now := time.Now()
+		switch {
+		case prog.IsOnAir(now):
+			m.focus = FocusStations
+			return m, m.playStation()
+		case prog.IsPast(now):
+			m.focus = FocusStations
+			m.statusMessage = fmt.Sprintf("タイムフリー: %s", prog.Title)
+			return m, m.playTimefree(m.guideStation, prog)
+		default:
+			m.toggleReservation(prog)
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Record):
+		if m.guideCursor < len(m.guidePrograms) {
+			prog := m.guidePrograms[m.guideCursor]
+			if prog.IsPast(time.Now()) {
+				m.errorMessage = "既に終了した番組は予約できません"
+			} else {
+				m.toggleReservation(prog)
+			}
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Guide), key.Matches(msg, m.keys.Quit):
+		m.focus = FocusStations
+		return m, nil
+	}
+	return m, nil
+}
+
+// recordingOptions builds the options of an on-demand recording from the config
+func (m *Model) recordingOptions() player.RecordingOptions {
+	cfg := m.shared.Recording
+	opts := player.RecordingOptions{
+		StationID:   m.shared.Playing.StationID,
+		Program:     m.shared.Playing.Program,
+		MaxDuration: time.Duration(cfg.MaxMinutes) * time.Minute,
+		MaxSize:     int64(cfg.MaxSizeMB) * 1024 * 1024,
+		Output:      recorder.OutputOptionsFromConfig(cfg),
+	}
+	// Past broadcasts are a single program and are not split at program boundaries
+	if cfg.SplitByProgram && !m.shared.Playing.Timefree {
+		opts.ProgramAware = true
+	}
+	return opts
+}
+
+// handlePlayerEvent updates the status line and the reconnection state from a player event
+func (m *Model) handlePlayerEvent(ev player.Event) {
+	switch ev.Type {
+	case player.EventStalled, player.EventReconnecting, player.EventAuthRefreshed:
+		m.connEvent = &ev
+	case player.EventRecovered:
+		m.connEvent = nil
+		m.statusMessage = "再接続成功"
+	case player.EventFailed:
+		m.connEvent = nil
+		m.errorMessage = fmt.Sprintf("再接続失敗: %v", ev.Err)
+		if !ev.NextRetry.IsZero() {
+			m.errorMessage += fmt.Sprintf(" (%sに再試行)", ev.NextRetry.Format("15:04:05"))
+		}
+	case player.EventStarted, player.EventStopped:
+		m.connEvent = nil
+		m.deadAirEvent = nil
+	case player.EventDeadAir:
+		m.deadAirEvent = &ev
+		m.statusMessage = fmt.Sprintf("⚠ %v", errors.Unwrap(ev.Err))
+	case player.EventDeadAirEnded:
+		m.deadAirEvent = nil
+		m.statusMessage = "音声が戻りました"
+		if ev.Gap.Duration > 0 {
+			m.statusMessage += fmt.Sprintf(" (録音に記録: %s)", ev.Gap)
+		}
+	case player.EventRecordingStopped:
+		if files := m.shared.Player.GetRecordingFiles(); len(files) > 1 {
+			m.statusMessage = fmt.Sprintf("録音保存: %s 他%d件", ev.Path, len(files)-1)
+		} else {
+			m.statusMessage = fmt.Sprintf("録音保存: %s", ev.Path)
+		}
+	case player.EventRecordingFailed:
+		m.errorMessage = fmt.Sprintf("録音エラー: %v", ev.Err)
+	case player.EventRecordingResumed:
+		if ev.Gap.Duration > 0 {
+			m.statusMessage = fmt.Sprintf("録音再開 (欠落 %s)", ev.Gap)
+		}
+	case player.EventRecordingDropped:
+		m.statusMessage = fmt.Sprintf("⚠ 録音の書き込みが追いつかず音声が欠落しました (%s)", ev.Gap)
+	case player.EventSleepTimerExpired:
+		m.sleepStep = 0
+		m.connEvent = nil
+		m.deadAirEvent = nil
+		m.statusMessage = "おやすみタイマー: 再生を停止しました"
+		// Keep the station shown while its recording continues, so that it can be stopped
+		if !m.shared.Player.IsRecording() {
+			m.shared.Playing = nil
+		}
+	case player.EventProgramChanged:
+		if ev.Path != "" {
+			m.statusMessage = fmt.Sprintf("録音: 次の番組「%s」", ev.Program.Title)
+		} else {
+			m.statusMessage = fmt.Sprintf("次の番組「%s」", ev.Program.Title)
+		}
+		if playing := m.shared.Playing; playing != nil && !playing.Timefree && playing.StationID == ev.Program.StationID {
+			playing.Program = ev.Program
+			playing.CurrentProgram = ev.Program.Title
+		}
+	}
+}
+
+// wakeUp plays the station of an alarm, ramping its volume up
+func (m *Model) wakeUp(ring alarm.Ring) tea.Cmd {
+	shared := m.shared
+	if shared.AlarmRamp != nil {
+		shared.AlarmRamp()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	shared.AlarmRamp = cancel
+
+	return func() tea.Msg {
+		_, err := alarm.Wake(ctx, shared.Player, ring.Alarm)
+		return alarmWokeMsg{ring: ring, err: err}
+	}
+}
+
+// snoozeAlarm stops the ringing alarm and rings it again after the snooze length
+func (m *Model) snoozeAlarm() {
+	if m.shared.AlarmRamp != nil {
+		m.shared.AlarmRamp()
+		m.shared.AlarmRamp = nil
+	}
+	m.shared.Player.Stop()
+	m.shared.Playing = nil
+	m.alarmRinging = false
+	if at, ok := m.shared.Alarm.Snooze(); ok {
+		m.statusMessage = fmt.Sprintf("💤 スヌーズ: %s に再開", at.Format("15:04"))
+	}
+}
+
+// dismissAlarm ends the ringing or snoozed alarm once the user plays something else
+func (m *Model) dismissAlarm() {
+	if m.shared.AlarmRamp != nil {
+		m.shared.AlarmRamp()
+		m.shared.AlarmRamp = nil
+	}
+	m.alarmRinging = false
+	if m.shared.Alarm != nil {
+		m.shared.Alarm.Dismiss()
+	}
+}
+
+// stationName returns the name of a station in the list, or its ID
+func (m Model) stationName(stationID string) string {
+	for _, s := range m.stations {
+		if s.ID == stationID {
+			return s.Name
+		}
+	}
+	return stationID
+}
+
+// cycleSleepTimer moves to the next sleep timer choice: the configured minutes,
+// the end of the current program, then off
+func (m *Model) cycleSleepTimer() {
+	presets := m.shared.Sleep.Minutes
+	_, stopRecording, active := m.shared.Player.GetSleepTimer()
+	if !active {
+		m.sleepStep = 0
+		stopRecording = m.shared.Sleep.StopRecording
+	}
+
+	for {
+		m.sleepStep = (m.sleepStep + 1) % (len(presets) + 2)
+		if m.sleepStep == 0 {
+			m.shared.Player.CancelSleepTimer()
+			m.statusMessage = "おやすみタイマー解除"
+			return
+		}
+
+		var at time.Time
+		var label string
+		if m.sleepStep <= len(presets) {
+			minutes := presets[m.sleepStep-1]
+			at = time.Now().Add(time.Duration(minutes) * time.Minute)
+			label = fmt.Sprintf("%d分後", minutes)
+		} else {
+			end, ok := m.programEndTime()
+			if !ok {
+				// Unknown program: skip to off
+				continue
+			}
+			at = end
+			label = "番組終了時"
+		}
+		if err := m.shared.Player.SetSleepTimer(at, stopRecording); err != nil {
+			continue
+		}
+
+		m.statusMessage = fmt.Sprintf("おやすみタイマー: %s (%s) に停止", label, at.Format("15:04"))
+		if m.shared.Player.IsRecording() {
+			m.statusMessage += "  " + sleepRecordingLabel(stopRecording) + " (Zで切替)"
+		}
+		return
+	}
+}
+
+// cycleEQ moves the playing station to the next EQ preset. The choice is kept
+// per station, so talk and music stations each keep their own.
+func (m *Model) cycleEQ() {
+	audio := &m.shared.Audio
+	stationID := m.shared.Playing.StationID
+	current, ok := audio.StationEQ[stationID]
+	if !ok {
+		current = audio.EQ
+	}
+
+	next := player.EQPresets[0]
+	for i, preset := range player.EQPresets {
+		if string(preset) == current {
+			next = player.EQPresets[(i+1)%len(player.EQPresets)]
+			break
+		}
+	}
+	// Copy the map, the player keeps the one it was given
+	stationEQ := make(map[string]string, len(audio.StationEQ)+1)
+	for id, preset := range audio.StationEQ {
+		stationEQ[id] = preset
+	}
+	stationEQ[stationID] = string(next)
+	audio.StationEQ = stationEQ
+
+	m.applyAudio()
+	m.statusMessage = fmt.Sprintf("EQ: %s (%s)", eqLabel(next), m.shared.Playing.StationName)
+}
+
+// toggleNormalize turns the loudness normalization on or off
+func (m *Model) toggleNormalize() {
+	m.shared.Audio.Normalize = !m.shared.Audio.Normalize
+	m.applyAudio()
+	if m.shared.Audio.Normalize {
+		m.statusMessage = fmt.Sprintf("音量の自動調整: オン (%.0f LUFS)", m.shared.Audio.TargetLUFS)
+	} else {
+		m.statusMessage = "音量の自動調整: オフ"
+	}
+}
+
+// applyAudio passes the audio settings to the player and saves them
+func (m *Model) applyAudio() {
+	m.shared.Player.SetDSPOptions(player.DSPOptionsFromConfig(m.shared.Audio))
+	m.saveAudio()
+}
+
+// saveAudio saves the audio settings in the background. config.SaveAudio serializes
+// the rewrite of the config file with the other saves.
+func (m *Model) saveAudio() {
+	go config.SaveAudio(m.shared.Audio)
+}
+
+// meterModes lists the level displays in the order the meter key cycles through them
+var meterModes = []string{"off", "vu", "spectrum"}
+
+// cycleMeter moves to the next level display and restarts its refresh
+func (m *Model) cycleMeter() tea.Cmd {
+	next := meterModes[0]
+	for i, mode := range meterModes {
+		if mode == m.shared.Audio.Meter {
+			next = meterModes[(i+1)%len(meterModes)]
+			break
+		}
+	}
+	m.shared.Audio.Meter = next
+	m.saveAudio()
+
+	switch next {
+	case "vu":
+		m.statusMessage = "レベルメーター: VU"
+	case "spectrum":
+		m.statusMessage = "レベルメーター: VU + スペクトラム"
+	default:
+		m.statusMessage = "レベルメーター: オフ"
+	}
+	m.meterGen++
+	return m.meterTickCmd()
+}
+
+// eqLabel returns the name of an EQ preset shown to the user
+func eqLabel(preset player.EQPreset) string {
+	switch preset {
+	case player.EQSpeech:
+		return "トーク"
+	case player.EQMusic:
+		return "音楽"
+	default:
+		return "フラット"
+	}
+}
+
+// toggleSleepRecording chooses whether the sleep timer stops the recording too
+func (m *Model) toggleSleepRecording() {
+	at, stopRecording, active := m.shared.Player.GetSleepTimer()
+	if !active {
+		m.statusMessage = "おやすみタイマーは設定されていません (zで設定)"
+		return
+	}
+	if err := m.shared.Player.SetSleepTimer(at, !stopRecording); err != nil {
+		m.errorMessage = err.Error()
+		return
+	}
+	m.statusMessage = "おやすみタイマー: " + sleepRecordingLabel(!stopRecording)
+}
+
+// sleepRecordingLabel describes what the sleep timer does to the recording
+func sleepRecordingLabel(stopRecording bool) string {
+	if stopRecording {
+		return "録音も停止"
+	}
+	return "録音は継続"
+}
+
+// programEndTime returns when the program being played ends on the speaker
+func (m *Model) programEndTime() (time.Time, bool) {
+	playing := m.shared.Playing
+	if playing == nil || playing.Program == nil {
+		return time.Time{}, false
+	}
+	if playing.Timefree {
+		position, duration := m.shared.Player.GetTimefreePosition()
+		return time.Now().Add(duration - position), true
+	}
+	// Behind live, the program ends that much later than on air
+	behind, _, _ := m.shared.Player.GetTimeshift()
+	return playing.Program.End.Add(behind), true
+}
+
+// stopRecording stops the recording in the background, since ffmpeg may take
+// seconds to finish the file. The result is reported by EventRecordingStopped /
+// EventRecordingFailed.
+func (m *Model) stopRecording() tea.Cmd {
+	p := m.shared.Player
+	return func() tea.Msg {
+		p.StopRecording()
+		return nil
+	}
+}
+
+// startRecording starts a recording in the background, since fetching the cover art
+// may take a few seconds. status is shown once it has started.
+func (m *Model) startRecording(opts player.RecordingOptions, status string) tea.Cmd {
+	p := m.shared.Player
+	stationName := m.shared.Playing.StationName
+	return func() tea.Msg {
+		err := p.StartRecordingWithOptions(stationName, opts)
+		return recordingStartedMsg{status: status, err: err}
+	}
+}
+
+// recordAgo saves the last minutes heard as a clip, or starts a recording that begins
+// that far in the past (recording.retro_continue)
+func (m *Model) recordAgo() tea.Cmd {
+	cfg := m.shared.Recording
+	ago := time.Duration(cfg.RetroMinutes) * time.Minute
+	if ago <= 0 {
+		m.errorMessage = "retro_minutes が設定されていません"
+		return nil
+	}
+
+	opts := m.recordingOptions()
+	if cfg.RetroContinue {
+		if m.shared.Player.IsRecording() {
+			m.errorMessage = "既に録音中です"
+			return nil
+		}
+		opts.Prepend = ago
+		return m.startRecording(opts, fmt.Sprintf("録音開始 (%d分前から)", cfg.RetroMinutes))
+	}
+
+	// Encoding the clip may take a few seconds
+	m.statusMessage = fmt.Sprintf("直前%d分を保存中...", cfg.RetroMinutes)
+	p := m.shared.Player
+	stationName := m.shared.Playing.StationName
+	return func() tea.Msg {
+		filePath, err := p.SaveClip(stationName, ago, opts)
+		return clipSavedMsg{filePath: filePath, err: err}
+	}
+}
+
+// toggleReservation reserves a guide program for recording, or cancels its reservation
+func (m *Model) toggleReservation(prog model.GuideProgram) {
+	scheduler := m.shared.Scheduler
+	if scheduler == nil {
+		m.errorMessage = "録音予約は利用できません"
+		return
+	}
+
+	if r, ok := scheduler.Find(prog.StationID, prog.Start); ok && r.IsActive() {
+		if err := scheduler.Remove(r.ID); err != nil {
+			m.errorMessage = err.Error()
+			return
+		}
+		m.statusMessage = fmt.Sprintf("予約取消: %s", prog.Title)
+		return
+	}
+
+	if _, err := scheduler.AddProgram(prog); err != nil {
+		m.errorMessage = err.Error()
+		return
+	}
+	m.statusMessage = fmt.Sprintf("録音予約: %s", prog.Title)
+}
+
+// openGuide switches to the program guide of the station under the cursor
+func (m *Model) openGuide() tea.Cmd {
+	station := m.stations[m.cursor]
+	m.focus = FocusGuide
+	if station.ID == m.guideStation.ID && len(m.guidePrograms) > 0 {
+		return nil
+	}
+	m.guideStation = station
+	m.guidePrograms = nil
+	m.guideCursor = 0
+	m.guideLoading = true
+	return fetchGuideCmd(station.ID)
+}
+
+// findGuideDay returns the index of the first guide program of a broadcast day,
+// keeping the current cursor if the day is not in the guide
+func (m *Model) findGuideDay(day time.Time) int {
+	for i, prog := range m.guidePrograms {
+		if model.BroadcastDate(prog.Start).Equal(day) {
+			return i
+		}
+	}
+	return m.guideCursor
+}
+
 func (m *Model) getCurrentAreaID() string {
 	if m.currentArea >= 0 && m.currentArea < len(m.areas) {
 		return m.areas[m.currentArea].ID
@@ -610,6 +1450,38 @@ func (m *Model) playStation() tea.Cmd {
 	}
 }
 
+// playTimefree plays a past broadcast of a station
+func (m *Model) playTimefree(station model.Station, prog model.GuideProgram) tea.Cmd {
+	stationIdx := m.cursor
+	shared := m.shared
+	currentAreaID := m.getCurrentAreaID()
+
+	return func() tea.Msg {
+		playlistURL, err := api.GetTimefreeURL(station.ID, prog.Ft(), prog.To())
+		if err != nil {
+			return playResultMsg{err: err, stationIdx: stationIdx}
+		}
+
+		shared.Player.Stop()
+		time.Sleep(100 * time.Millisecond)
+
+		newToken := api.Auth(currentAreaID)
+		if newToken != "" {
+			shared.AuthToken = newToken
+			shared.Player.UpdateAuthToken(newToken)
+		}
+
+		err = shared.Player.PlayTimefree(playlistURL, prog.Start, prog.End)
+		return playResultMsg{
+			err:         err,
+			stationIdx:  stationIdx,
+			stationID:   station.ID,
+			stationName: station.Name,
+			program:     &prog,
+		}
+	}
+}
+
 func (m *Model) reconnect() tea.Cmd {
 	shared := m.shared
 	return func() tea.Msg {
@@ -644,6 +1516,9 @@ func (m Model) View() string {
 	// Title + Volume
 	title := titleStyle.Render("📻 Radiko")
 	volBar := m.renderVolume()
+	if meter := m.renderMeter(); meter != "" {
+		volBar += "  " + meter
+	}
 	content.WriteString(fmt.Sprintf("%s  %s\n", title, volBar))
 
 	// Region line
@@ -676,6 +1551,10 @@ func (m Model) renderContent(maxHeight int) string {
 		return strings.Join(lines, "\n") + "\n"
 	}
 
+	if m.focus == FocusGuide {
+		return m.renderGuide(maxHeight)
+	}
+
 	// Station list
 	maxVisible := maxHeight - 2 // Leave space for status messages
 	if maxVisible > len(m.stations) {
@@ -755,33 +1634,132 @@ func (m Model) renderFooter() string {
 		if m.shared.Playing.CurrentProgram != "" {
 			playLine += "  " + programStyle.Render("♪ "+m.shared.Playing.CurrentProgram)
 		}
+		if prog := m.shared.Playing.Program; prog != nil && !m.shared.Playing.Timefree {
+			playLine += " " + statusStyle.Render(fmt.Sprintf("%s-%s", prog.Start.In(model.JST).Format("15:04"), prog.End.In(model.JST).Format("15:04")))
+		}
 
-		// Check reconnection status
-		if m.shared.Player != nil {
-			switch m.shared.Player.GetReconnectStatus() {
-			case player.ReconnectStarted:
-				playLine += "  " + reconnectStyle.Render("🔄 再接続中...")
-			case player.ReconnectAuth:
-				playLine += "  " + reconnectStyle.Render("🔑 認証取得中...")
-			case player.ReconnectPlaying:
+		// Timefree position
+		if m.shared.Playing.Timefree && m.shared.Player != nil {
+			position, duration := m.shared.Player.GetTimefreePosition()
+			status := "⏪"
+			if m.shared.Player.IsPaused() {
+				status = "⏸"
+			} else if !m.shared.Player.IsPlaying() && position >= duration {
+				status = "⏹"
+			}
+			playLine += "  " + timefreeStyle.Render(fmt.Sprintf("%s %s / %s", status, formatDuration(position), formatDuration(duration)))
+		}
+
+		// Distance behind live while paused or rewound
+		if !m.shared.Playing.Timefree && m.shared.Player != nil {
+			if behind, _, live := m.shared.Player.GetTimeshift(); !live {
+				status := "⏪"
+				if m.shared.Player.IsPaused() {
+					status = "⏸"
+				}
+				playLine += "  " + timefreeStyle.Render(fmt.Sprintf("%s -%s (ライブまで)", status, formatDuration(behind)))
+			}
+		}
+
+		// Reconnection in progress
+		if ev := m.connEvent; ev != nil {
+			switch ev.Type {
+			case player.EventStalled:
+				playLine += "  " + reconnectStyle.Render("🔄 再接続中..."+reconnectReason(ev.Err))
+			case player.EventReconnecting:
+				attempt := fmt.Sprintf("%d回目", ev.Attempt)
+				if ev.MaxAttempts > 0 {
+					attempt = fmt.Sprintf("%d/%d回目", ev.Attempt, ev.MaxAttempts)
+				}
+				if wait := time.Until(ev.NextRetry); wait > 0 {
+					playLine += "  " + reconnectStyle.Render(fmt.Sprintf("🔄 再接続待ち %s %sに再試行 (あと%s)%s",
+						attempt, ev.NextRetry.Format("15:04:05"), formatDuration(wait+time.Second-1), reconnectReason(ev.Err)))
+				} else {
+					playLine += "  " + reconnectStyle.Render(fmt.Sprintf("🔑 認証取得中... (%s)", attempt))
+				}
+			case player.EventAuthRefreshed:
 				playLine += "  " + reconnectStyle.Render("▶ 再生を再開中...")
 			}
+		}
+
+		// Dead air: the stream arrives but is silent or looping
+		if ev := m.deadAirEvent; ev != nil && m.connEvent == nil {
+			label := "🔇 無音"
+			var perr *player.PlaybackError
+			if errors.As(ev.Err, &perr) && perr.Kind == player.ErrorLooping {
+				label = "🔁 ループ"
+			}
+			playLine += "  " + reconnectStyle.Render(fmt.Sprintf("%s %s", label, formatDuration(time.Since(ev.Since))))
+		}
+
+		if m.alarmRinging {
+			playLine += "  " + sleepStyle.Render("⏰ n スヌーズ")
+		}
+
+		// Sleep timer countdown
+		if m.shared.Player != nil {
+			if at, stopRecording, active := m.shared.Player.GetSleepTimer(); active {
+				label := "💤 " + formatDuration(time.Until(at))
+				if stopRecording && m.shared.Player.IsRecording() {
+					label += " (録音も停止)"
+				}
+				playLine += "  " + sleepStyle.Render(label)
+			}
+		}
+
+		if m.shared.Player != nil {
 
 			// Check recording status
 			if m.shared.Player.IsRecording() {
 				_, duration, recordingStation := m.shared.Player.GetRecordingInfo()
 				mins := int(duration.Minutes())
 				secs := int(duration.Seconds()) % 60
+				label := "⏺ 録音中"
+				gaps, resuming := m.shared.Player.GetRecordingGaps()
+				if resuming {
+					label = "⚠ 録音再接続中"
+				}
 				// Check if recording station is different from playing station
 				if m.shared.Playing != nil && recordingStation != m.shared.Playing.StationName {
-					playLine += "  " + recordingStyle.Render(fmt.Sprintf("⏺ 録音中[%s] %02d:%02d", recordingStation, mins, secs))
+					playLine += "  " + recordingStyle.Render(fmt.Sprintf("%s[%s] %02d:%02d", label, recordingStation, mins, secs))
 				} else {
-					playLine += "  " + recordingStyle.Render(fmt.Sprintf("⏺ 録音中 %02d:%02d", mins, secs))
+					playLine += "  " + recordingStyle.Render(fmt.Sprintf("%s %02d:%02d", label, mins, secs))
+				}
+				missing, deadAir := 0, 0
+				for _, gap := range gaps {
+					if gap.DeadAir {
+						deadAir++
+					} else {
+						missing++
+					}
+				}
+				if missing > 0 {
+					playLine += recordingStyle.Render(fmt.Sprintf(" 欠落%d", missing))
+				}
+				if deadAir > 0 {
+					playLine += recordingStyle.Render(fmt.Sprintf(" 無音%d", deadAir))
 				}
 			}
 		}
 	} else {
 		playLine = statusStyle.Render("再生していません")
+		if m.shared.Alarm != nil {
+			if at, ok := m.shared.Alarm.Snoozed(); ok {
+				playLine += "  " + sleepStyle.Render(fmt.Sprintf("💤 スヌーズ %s", at.Format("15:04")))
+			} else if _, at, ok := m.shared.Alarm.Next(); ok {
+				playLine += "  " + statusStyle.Render(fmt.Sprintf("⏰ 次のアラーム %s(%s) %s", at.Format("1/2"), weekdayNames[at.Weekday()], at.Format("15:04")))
+			}
+		}
+	}
+
+	// Scheduled recordings run independently of playback
+	if m.shared.Scheduler != nil {
+		if recording := m.shared.Scheduler.Recording(); len(recording) > 0 {
+			playLine += "  " + recordingStyle.Render(fmt.Sprintf("⏰ 予約録音中[%s]", recording[0].Title))
+			if len(recording) > 1 {
+				playLine += recordingStyle.Render(fmt.Sprintf(" 他%d件", len(recording)-1))
+			}
+		}
 	}
 	lines = append(lines, playLine)
 
@@ -792,22 +1770,186 @@ func (m Model) renderFooter() string {
 		lines = append(lines, statusStyle.Render("← → 音量調整  m ミュート  ↓ 地域へ  Esc 戻る"))
 	case FocusRegion:
 		lines = append(lines, statusStyle.Render("← → 選択  Enter 確定  ↑ 音量へ  ↓/Esc 戻る"))
+	case FocusGuide:
+		lines = append(lines, statusStyle.Render("↑↓ 選択  ←→ 日付  Enter 再生/タイムフリー/予約  s 予約  g/Esc 戻る"))
 	default:
+		if m.shared.Playing != nil && m.shared.Playing.Timefree {
+			lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  g 番組表  p 一時停止  [ ] 30秒  { } 5分  z タイマー  e EQ  +- 音量  m ミュート  Esc 終了"))
+			break
+		}
+		if m.shared.Player != nil && m.shared.Player.IsPlaying() {
+			if _, _, live := m.shared.Player.GetTimeshift(); !live {
+				lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  p 一時停止  [ ] 30秒  { } 5分  L ライブへ  z タイマー  e EQ  +- 音量  m ミュート  Esc 終了"))
+				break
+			}
+		}
 		if isRecording {
-			lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  ←→ 地域切替  +- 音量  m ミュート  ")+recordingStyle.Render("s 停止")+statusStyle.Render("  r 再接続  Esc 終了"))
+			lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  ←→ 地域切替  g 番組表  +- 音量  m ミュート  ")+recordingStyle.Render("s 停止")+statusStyle.Render("  z タイマー  e EQ  r 再接続  Esc 終了"))
 		} else {
-			lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  ←→ 地域切替  +- 音量  m ミュート  s 録音  r 再接続  Esc 終了"))
+			lines = append(lines, statusStyle.Render("↑↓ 選択  Enter 再生  ←→ 地域切替  g 番組表  +- 音量  m ミュート  s 録音  S 直前録音  z タイマー  e EQ  r 再接続  Esc 終了"))
 		}
 	}
 
 	return strings.Join(lines, "\n")
 }
 
+// weekdayNames are the Japanese short weekday names, indexed by time.Weekday
+var weekdayNames = []string{"日", "月", "火", "水", "木", "金", "土"}
+
+// renderGuide renders the program guide with a detail pane for the selected program
+func (m Model) renderGuide(maxHeight int) string {
+	var lines []string
+
+	width := m.width
+	if width <= 0 {
+		width = 80
+	}
+
+	lines = append(lines, titleStyle.Render(fmt.Sprintf("📅 %s 番組表", m.guideStation.Name))+" "+stationIDStyle.Render(m.guideStation.ID))
+
+	if m.guideLoading {
+		lines = append(lines, statusStyle.Render("⏳ 番組表を読み込み中..."))
+		return strings.Join(lines, "\n") + "\n"
+	}
+	if len(m.guidePrograms) == 0 {
+		if m.errorMessage != "" {
+			lines = append(lines, errorStyle.Render("✗ "+m.errorMessage))
+		} else {
+			lines = append(lines, statusStyle.Render("番組がありません"))
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	// Detail pane takes the bottom lines of the content area
+	detailHeight := 6
+	maxVisible := maxHeight - detailHeight - 2
+	if maxVisible > len(m.guidePrograms) {
+		maxVisible = len(m.guidePrograms)
+	}
+	if maxVisible < 3 {
+		maxVisible = 3
+	}
+
+	startIdx := m.guideCursor - maxVisible/2
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	endIdx := startIdx + maxVisible
+	if endIdx > len(m.guidePrograms) {
+		endIdx = len(m.guidePrograms)
+		startIdx = endIdx - maxVisible
+		if startIdx < 0 {
+			startIdx = 0
+		}
+	}
+
+	now := time.Now()
+	lineStyle := lipgloss.NewStyle().MaxWidth(width)
+	for i := startIdx; i < endIdx; i++ {
+		prog := m.guidePrograms[i]
+		start := prog.Start.In(model.JST)
+
+		prefix := "  "
+		if prog.IsOnAir(now) {
+			prefix = "▶ "
+		} else if prog.IsPast(now) {
+			prefix = "⏪"
+		}
+		text := fmt.Sprintf("%s%s(%s) %s  %s", prefix, start.Format("01/02"), weekdayNames[start.Weekday()], start.Format("15:04"), prog.Title)
+		if m.shared.Scheduler != nil {
+			if r, ok := m.shared.Scheduler.Find(prog.StationID, prog.Start); ok {
+				switch r.Status {
+				case recorder.StatusScheduled:
+					text += " ⏰"
+				case recorder.StatusRecording:
+					text += " ⏺"
+				}
+			}
+		}
+
+		var styled string
+		switch {
+		case i == m.guideCursor:
+			styled = stationSelectedStyle.Render(text)
+		case prog.IsOnAir(now):
+			styled = stationPlayingStyle.Render(text)
+		case prog.IsPast(now):
+			styled = statusStyle.Render(text)
+		default:
+			styled = stationNameStyle.Render(text)
+		}
+		lines = append(lines, lineStyle.Render(styled))
+	}
+
+	// Detail pane
+	lines = append(lines, strings.Repeat("─", 50))
+	lines = append(lines, m.renderGuideDetail(width, detailHeight-1)...)
+
+	if m.errorMessage != "" {
+		lines = append(lines, errorStyle.Render("✗ "+m.errorMessage))
+	} else if m.statusMessage != "" {
+		lines = append(lines, statusStyle.Render(m.statusMessage))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// renderGuideDetail renders title, time, performer and description of the selected program
+func (m Model) renderGuideDetail(width, maxLines int) []string {
+	prog := m.guidePrograms[m.guideCursor]
+	start := prog.Start.In(model.JST)
+	end := prog.End.In(model.JST)
+
+	lines := []string{
+		guideTitleStyle.Render(prog.Title),
+		programStyle.Render(fmt.Sprintf("%s(%s) %s-%s (%d分)", start.Format("2006/01/02"), weekdayNames[start.Weekday()], start.Format("15:04"), end.Format("15:04"), int(prog.Duration().Minutes()))),
+	}
+	if prog.Performer != "" {
+		lines = append(lines, stationNameStyle.Render("出演: "+prog.Performer))
+	}
+
+	desc := prog.PlainDescription()
+	if desc != "" {
+		wrapped := strings.Split(lipgloss.NewStyle().Width(width).Render(desc), "\n")
+		for _, line := range wrapped {
+			if len(lines) >= maxLines {
+				break
+			}
+			lines = append(lines, statusStyle.Render(line))
+		}
+	}
+
+	return lines
+}
+
+// formatDuration formats d as H:MM:SS (or MM:SS under an hour)
+// reconnectReason returns the class of a playback failure for the footer
+func reconnectReason(err error) string {
+	var perr *player.PlaybackError
+	if !errors.As(err, &perr) {
+		return ""
+	}
+	return " [" + perr.Kind.String() + "]"
+}
+
+func formatDuration(d time.Duration) string {
+	total := int(d.Seconds())
+	if total < 0 {
+		total = 0
+	}
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
 func (m Model) renderVolume() string {
-	vol := int(m.shared.Volume * 100)
+	volume := m.shared.Volume
 	if m.shared.Player != nil {
-		vol = int(m.shared.Player.GetVolume() * 100)
+		volume = m.shared.Player.GetVolume()
 	}
+	vol := int(math.Round(volume * 100))
 
 	// In volume focus mode, show a detailed volume bar
 	if m.focus == FocusVolume {
@@ -818,13 +1960,19 @@ func (m Model) renderVolume() string {
 	if m.shared.Muted {
 		return statusStyle.Render(fmt.Sprintf("🔇 %d%%", vol))
 	}
+	if vol > 100 {
+		return boostStyle.Render(fmt.Sprintf("🔊 %d%% ブースト", vol))
+	}
 	return volumeStyle.Render(fmt.Sprintf("🔊 %d%%", vol))
 }
 
-// renderVolumeBar renders a detailed volume bar for precise control
+// renderVolumeBar renders a detailed volume bar for precise control. The bar
+// spans up to the maximum boost; the part above 100% is drawn as boost.
 func (m Model) renderVolumeBar(vol int) string {
 	barWidth := 20
-	filled := vol * barWidth / 100
+	maxPercent := int(config.MaxVolume * 100)
+	filled := vol * barWidth / maxPercent
+	unity := barWidth * 100 / maxPercent
 
 	var bar strings.Builder
 
@@ -845,8 +1993,13 @@ func (m Model) renderVolumeBar(vol int) string {
 	// Volume bar
 	bar.WriteString("[")
 	for i := 0; i < barWidth; i++ {
-		if i < filled {
+		if i < filled && i >= unity {
+			bar.WriteString(boostStyle.Render("█"))
+		} else if i < filled {
 			bar.WriteString(volumeStyle.Render("█"))
+		} else if i == unity {
+			// Mark 100%
+			bar.WriteString(statusStyle.Render("│"))
 		} else {
 			bar.WriteString(statusStyle.Render("░"))
 		}
@@ -859,6 +2012,92 @@ func (m Model) renderVolumeBar(vol int) string {
 	return bar.String()
 }
 
+// Level meter display
+const (
+	meterCells   = 10    // Cells per channel, 6 dB each
+	meterFloorDB = -60.0 // Level of an empty meter
+	meterSilence = -60.0 // RMS below this on both channels is shown as silence
+	meterStale   = time.Second
+	spectrumTop  = -12.0 // dBFS of a full spectrum bar
+	spectrumSpan = 60.0  // dB from an empty to a full bar
+)
+
+// spectrumBars are the heights of a spectrum band, from empty to full
+var spectrumBars = []rune(" ▁▂▃▄▅▆▇█")
+
+// renderMeter renders the stereo VU meter (and the spectrum) of the stream played.
+// It tells a silent station (無音) from a stream that stopped delivering (信号なし).
+func (m Model) renderMeter() string {
+	mode := m.shared.Audio.Meter
+	if mode == "" || mode == "off" || m.shared.Player == nil || m.shared.Playing == nil {
+		return ""
+	}
+
+	levels := m.shared.Player.GetLevels()
+	stale := time.Since(levels.Updated) > meterStale
+	if stale {
+		levels = player.Levels{
+			RMS:  [2]float64{player.LevelFloor, player.LevelFloor},
+			Peak: [2]float64{player.LevelFloor, player.LevelFloor},
+		}
+	}
+
+	var b strings.Builder
+	for ch, label := range []string{"L", "R"} {
+		if ch > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(statusStyle.Render(label))
+		b.WriteString(renderMeterBar(levels.RMS[ch], levels.Peak[ch]))
+	}
+
+	if mode == "spectrum" && !stale {
+		b.WriteString(" ")
+		for _, db := range levels.Spectrum {
+			height := int((db - (spectrumTop - spectrumSpan)) / spectrumSpan * float64(len(spectrumBars)-1))
+			height = max(0, min(len(spectrumBars)-1, height))
+			b.WriteString(meterStyle.Render(string(spectrumBars[height])))
+		}
+	}
+
+	switch {
+	case stale && m.shared.Player.IsPaused():
+	case stale:
+		b.WriteString(" " + reconnectStyle.Render("信号なし"))
+	case levels.RMS[0] < meterSilence && levels.RMS[1] < meterSilence:
+		b.WriteString(" " + statusStyle.Render("無音"))
+	}
+	return b.String()
+}
+
+// renderMeterBar renders one channel: cells up to the RMS level and a mark at the peak
+func renderMeterBar(rms, peak float64) string {
+	cell := func(db float64) int {
+		return int(math.Floor((db - meterFloorDB) / -meterFloorDB * meterCells))
+	}
+	filled, peakCell := cell(rms), cell(peak)-1
+
+	var b strings.Builder
+	for i := 0; i < meterCells; i++ {
+		style := meterStyle
+		switch {
+		case i >= meterCells-1:
+			style = meterClipStyle // Above -6 dBFS
+		case i >= meterCells-2:
+			style = meterHotStyle // Above -12 dBFS
+		}
+		switch {
+		case i < filled:
+			b.WriteString(style.Render("█"))
+		case i == peakCell:
+			b.WriteString(style.Render("▏"))
+		default:
+			b.WriteString(statusStyle.Render("░"))
+		}
+	}
+	return b.String()
+}
+
 func (m Model) renderRegionLine() string {
 	var parts []string
 
@@ -910,11 +2149,12 @@ func (m Model) renderRegionLine() string {
 	return strings.Join(parts, "")
 }
 
-func Run(stations []model.Station, authToken string, cfg config.Config) error {
-	m := NewModel(stations, authToken, cfg.Volume, cfg.LastStationID, cfg.AreaID)
+func Run(stations []model.Station, authToken string, cfg config.Config, scheduler *recorder.Scheduler) error {
+	m := NewModel(stations, authToken, cfg, scheduler)
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	_, err := p.Run()
 
+	m.shared.Alarm.Stop()
 	if m.shared.Player != nil {
 		m.shared.Player.Stop()
 	}
@@ -7,10 +7,11 @@ import (
 
 	"radiko-tui/config"
 	"radiko-tui/model"
+	"radiko-tui/recorder"
 )
 
 // Run is a stub that returns an error for noaudio builds
 // The TUI requires audio support and is not available in server-only mode
-func Run(stations []model.Station, authToken string, cfg config.Config) error {
+func Run(stations []model.Station, authToken string, cfg config.Config, scheduler *recorder.Scheduler) error {
 	return fmt.Errorf("TUI モードは noaudio ビルドではサポートされていません。--server フラグを使用してください")
 }